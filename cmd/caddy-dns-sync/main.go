@@ -1,5 +1,13 @@
 package main
 
+import (
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+
+	_ "github.com/caddyserver/caddy/v2/modules/standard"
+
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/app"
+)
+
 func main() {
-	// TODO: wire Caddy module entrypoint.
+	caddycmd.Main()
 }
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+)
+
+func init() {
+	caddy.RegisterModule(new(AdminAPI))
+}
+
+// AdminAPI serves the dns_sync endpoints on Caddy's admin API:
+//
+//	GET /dns_sync/conflicts - hostname requests rejected because another
+//	container owns the hostname
+type AdminAPI struct {
+	// app returns the running dns_sync app; tests replace it.
+	app func() (*App, error)
+}
+
+// CaddyModule returns the Caddy module information.
+func (*AdminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.dns_sync",
+		New: func() caddy.Module { return new(AdminAPI) },
+	}
+}
+
+// Routes returns the admin routes of the dns_sync app.
+func (a *AdminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{Pattern: "/dns_sync/conflicts", Handler: caddy.AdminHandlerFunc(a.handleConflicts)},
+	}
+}
+
+func (a *AdminAPI) handleConflicts(w http.ResponseWriter, r *http.Request) error {
+	app, err := a.activeApp()
+	if err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+	}
+	dns.ConflictsHandler(app.manager).ServeHTTP(w, r)
+	return nil
+}
+
+func (a *AdminAPI) activeApp() (*App, error) {
+	if a.app != nil {
+		return a.app()
+	}
+
+	mod, err := caddy.ActiveContext().AppIfConfigured("dns_sync")
+	if err != nil {
+		return nil, err
+	}
+	app, ok := mod.(*App)
+	if !ok || app.manager == nil {
+		return nil, fmt.Errorf("dns_sync app is not running")
+	}
+	return app, nil
+}
+
+// Interface guards
+var (
+	_ caddy.Module      = (*AdminAPI)(nil)
+	_ caddy.AdminRouter = (*AdminAPI)(nil)
+)
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/controller"
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/docker"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/adguard"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/caddydns"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/cloudflare"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/localfile"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/memory"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/pihole"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/rfc2136"
+	_ "github.com/cpritchett/caddy-dns-plugin/internal/providers/unifi"
+	"github.com/cpritchett/caddy-dns-plugin/internal/reconcile"
+	"github.com/cpritchett/caddy-dns-plugin/internal/target"
+)
+
+func init() {
+	caddy.RegisterModule(new(App))
+}
+
+// App is the dns_sync Caddy app. It watches Docker for labelled containers
+// and keeps the configured DNS providers in sync with them.
+type App struct {
+	config.Config
+
+	manager   *dns.Manager
+	source    docker.EventSource
+	inspector controller.Inspector
+	lister    reconcile.ContainerLister
+	detectors []*target.Detector
+	logger    *zap.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// CaddyModule returns the Caddy module information.
+func (*App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns_sync",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision applies defaults and builds the configured providers.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger()
+
+	if err := a.Config.ApplyDefaults(); err != nil {
+		return err
+	}
+
+	providerList := make([]providers.Provider, 0, len(a.Providers))
+	opts := []dns.ManagerOption{
+		dns.WithStateStore(dns.NewFileStateStore(a.StateFile)),
+		dns.WithOwnerID(a.OwnerID),
+		dns.WithPolicy(dns.Policy(a.Policy)),
+		dns.WithLogger(a.logger.Named("state")),
+	}
+	// Check every provider before building any, so a bad one fails before
+	// other providers load their modules
+	for _, cfg := range a.Providers {
+		if err := providers.Validate(cfg); err != nil {
+			return err
+		}
+	}
+	for _, cfg := range a.Providers {
+		provider, err := providers.New(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		if a.OwnerID != "" && !providers.SupportsRecordType(provider, "TXT") {
+			a.logger.Info("provider cannot store TXT records, owner_id does not apply to it",
+				zap.String("provider", cfg.Name),
+				zap.String("type", cfg.Type))
+		}
+		provider = providers.WithRetry(provider, providers.RetryOptions{
+			OnAttempt: a.recordAttempt,
+		})
+		providerList = append(providerList, provider)
+
+		name := cfg.Name
+		resolver, err := target.New(cfg.TargetMode, target.Options{
+			Logger: a.logger.Named("public_ip").With(zap.String("provider", name)),
+			OnChange: func(ctx context.Context, old, new netip.Addr) error {
+				_, err := a.manager.RetargetRecords(ctx, name, old, new)
+				return err
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", name, err)
+		}
+		if detector, ok := resolver.(*target.Detector); ok {
+			a.detectors = append(a.detectors, detector)
+		}
+		opts = append(opts, dns.WithTargetResolver(name, resolver))
+	}
+
+	a.manager = dns.NewManager(providerList, opts...)
+	client := docker.NewClient(a.DockerSocket, a.logger.Named("docker"))
+	a.source = client
+	inspector := docker.NewInspector(client)
+	a.inspector = inspector
+	a.lister = inspector
+	return nil
+}
+
+// Validate checks the provisioned configuration.
+func (a *App) Validate() error {
+	return a.Config.Validate()
+}
+
+// Start launches the Docker watcher and the reconcile loop.
+func (a *App) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	a.wg.Add(3)
+	go a.watch(ctx)
+	go a.reconcileLoop(ctx)
+	go func() {
+		defer a.wg.Done()
+		a.manager.RunRetries(ctx)
+	}()
+	for _, detector := range a.detectors {
+		a.wg.Add(1)
+		go func(detector *target.Detector) {
+			defer a.wg.Done()
+			detector.Run(ctx)
+		}(detector)
+	}
+
+	a.logger.Info("dns sync started",
+		zap.String("label_prefix", a.LabelPrefix),
+		zap.Duration("reconcile_interval", time.Duration(a.ReconcileInterval)),
+		zap.Int("providers", len(a.Providers)),
+	)
+	return nil
+}
+
+// Stop cancels background work and waits for it to finish so that a config
+// reload never runs two instances side by side.
+func (a *App) Stop() error {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.wg.Wait()
+	a.logger.Info("dns sync stopped")
+	return nil
+}
+
+func (a *App) watch(ctx context.Context) {
+	defer a.wg.Done()
+
+	watcher := docker.NewWatcher(a.source, docker.Options{})
+	events, errs := watcher.Run(ctx)
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for err := range errs {
+			a.logger.Error("docker watcher stopped", zap.Error(err))
+		}
+	}()
+
+	ctrl := controller.New(a.inspector, a.manager, controller.Options{
+		LabelPrefix: a.LabelPrefix,
+		Logger:      a.logger.Named("controller"),
+	})
+	if err := ctrl.Run(ctx, events); err != nil && !errors.Is(err, context.Canceled) {
+		a.logger.Error("event controller stopped", zap.Error(err))
+	}
+}
+
+func (a *App) reconcileLoop(ctx context.Context) {
+	defer a.wg.Done()
+
+	reconciler := reconcile.New(a.lister, a.manager, reconcile.Options{
+		LabelPrefix: a.LabelPrefix,
+		Interval:    time.Duration(a.ReconcileInterval),
+		Logger:      a.logger.Named("reconcile"),
+	})
+	reconciler.Run(ctx)
+}
+
+// recordAttempt counts a provider call and logs the ones that will be retried.
+func (a *App) recordAttempt(attempt providers.Attempt) {
+	dns.RecordMetricAttempt(attempt)
+	if attempt.Retry {
+		a.logger.Debug("retrying provider call",
+			zap.String("provider", attempt.Provider),
+			zap.String("operation", attempt.Operation),
+			zap.Int("attempt", attempt.Number),
+			zap.Duration("delay", attempt.Delay),
+			zap.Error(attempt.Err),
+		)
+	}
+}
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+	_ caddy.Validator   = (*App)(nil)
+)
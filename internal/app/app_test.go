@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/libdns/libdns"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/docker"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+func TestProvisionBuildsProviders(t *testing.T) {
+	app := provisionApp(t, `{
+		"label_prefix": "custom",
+		"providers": [
+			{"name": "cf", "type": "cloudflare", "token": "test-token", "zone_filters": ["example.com"]}
+		]
+	}`)
+
+	if app.LabelPrefix != "custom" {
+		t.Fatalf("label prefix = %q, want %q", app.LabelPrefix, "custom")
+	}
+	if app.DockerSocket == "" {
+		t.Fatal("expected docker socket default to be applied")
+	}
+	if app.manager == nil {
+		t.Fatal("expected manager to be provisioned")
+	}
+	if _, ok := app.source.(*docker.Client); !ok {
+		t.Fatalf("source = %T, want *docker.Client", app.source)
+	}
+	if err := app.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestProvisionRejectsUnsupportedProviderType(t *testing.T) {
+	var app App
+	if err := json.Unmarshal([]byte(`{"providers": [{"name": "x", "type": "bogus", "zone_filters": ["example.com"]}]}`), &app); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	err := app.Provision(ctx)
+	if err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Fatalf("expected unsupported type error, got %v", err)
+	}
+}
+
+func TestStartStopProcessesEvents(t *testing.T) {
+	app := provisionApp(t, `{}`)
+
+	var deletes atomic.Int32
+	provider := &stubProvider{
+		name:    "stub",
+		filters: []string{"example.com"},
+		adapter: &stubAdapter{onDelete: func() { deletes.Add(1) }},
+	}
+	app.manager = dns.NewManager([]providers.Provider{provider})
+	if err := app.manager.CreateRecord(context.Background(), dns.SyncRequest{
+		Hostname:     "app.example.com",
+		ProviderName: "stub",
+		RecordType:   dns.RecordTypeA,
+		Target:       "192.0.2.10",
+		SourceID:     "abc123",
+	}); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	source := &stubSource{events: make(chan docker.Event, 1)}
+	app.source = source
+	// Reconciliation sees the container still running, so only the die
+	// event may remove its record.
+	app.lister = stubInspector{"abc123": {
+		ID:        "abc123",
+		IsRunning: true,
+		IPV4:      []string{"192.0.2.10"},
+		Labels: map[string]string{
+			"caddy_dns.hostname": "app.example.com",
+			"caddy_dns.provider": "stub",
+		},
+	}}
+
+	if err := app.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	source.events <- docker.Event{ID: "abc123", Type: docker.EventTypeContainer, Action: "die"}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for deletes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := app.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if deletes.Load() != 1 {
+		t.Fatalf("deletes = %d, want 1", deletes.Load())
+	}
+	if records := app.manager.GetRecords(); len(records) != 0 {
+		t.Fatalf("expected records to be removed, got %d", len(records))
+	}
+}
+
+func TestStartEventSyncsContainer(t *testing.T) {
+	app := provisionApp(t, `{}`)
+
+	provider := &stubProvider{name: "stub", filters: []string{"example.com"}, adapter: &stubAdapter{}}
+	app.manager = dns.NewManager([]providers.Provider{provider})
+	inspector := stubInspector{
+		"abc123": {
+			ID:        "abc123",
+			IsRunning: true,
+			IPV4:      []string{"192.0.2.10"},
+			Labels: map[string]string{
+				"caddy_dns.hostname": "app.example.com",
+				"caddy_dns.provider": "stub",
+			},
+		},
+	}
+	app.inspector = inspector
+	app.lister = inspector
+
+	source := &stubSource{events: make(chan docker.Event, 1)}
+	app.source = source
+
+	if err := app.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	source.events <- docker.Event{ID: "abc123", Type: docker.EventTypeContainer, Action: "start"}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(app.manager.GetRecords()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := app.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	records := app.manager.GetRecords()
+	if len(records) != 1 {
+		t.Fatalf("records = %d, want 1", len(records))
+	}
+	if records[0].Hostname != "app.example.com" || records[0].SourceID != "abc123" {
+		t.Fatalf("unexpected record: %+v", records[0])
+	}
+}
+
+func TestAdminAPIListsConflicts(t *testing.T) {
+	provider := &stubProvider{name: "stub", filters: []string{"example.com"}, adapter: &stubAdapter{}}
+	app := &App{manager: dns.NewManager([]providers.Provider{provider})}
+	request := func(id, target string) dns.SyncRequest {
+		return dns.SyncRequest{
+			Hostname:     "app.example.com",
+			ProviderName: "stub",
+			RecordType:   dns.RecordTypeA,
+			Target:       target,
+			SourceID:     id,
+		}
+	}
+	for _, req := range []dns.SyncRequest{request("web-1", "192.0.2.10"), request("web-2", "192.0.2.20")} {
+		if _, err := app.manager.Sync(context.Background(), []dns.SyncRequest{req}); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+
+	api := &AdminAPI{app: func() (*App, error) { return app, nil }}
+	var handler caddy.AdminHandler
+	for _, route := range api.Routes() {
+		if route.Pattern == "/dns_sync/conflicts" {
+			handler = route.Handler
+		}
+	}
+	if handler == nil {
+		t.Fatal("no /dns_sync/conflicts route")
+	}
+
+	rec := httptest.NewRecorder()
+	if err := handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns_sync/conflicts", nil)); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	var conflicts []dns.Conflict
+	if err := json.NewDecoder(rec.Body).Decode(&conflicts); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].SourceID != "web-2" || conflicts[0].OwnerID != "web-1" {
+		t.Fatalf("conflicts = %+v, want web-2 rejected in favour of web-1", conflicts)
+	}
+}
+
+func provisionApp(t *testing.T, raw string) *App {
+	t.Helper()
+	t.Setenv("CADDY_DNS_STATE_FILE", filepath.Join(t.TempDir(), "state.json"))
+
+	var app App
+	if err := json.Unmarshal([]byte(raw), &app); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+
+	if err := app.Provision(ctx); err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	return &app
+}
+
+type stubSource struct {
+	events chan docker.Event
+}
+
+func (s *stubSource) Events(ctx context.Context, _ docker.Filters) (<-chan docker.Event, <-chan error) {
+	return s.events, make(chan error)
+}
+
+type stubInspector map[string]dns.ContainerInfo
+
+func (s stubInspector) ListRunning(context.Context) ([]dns.ContainerInfo, error) {
+	var containers []dns.ContainerInfo
+	for _, info := range s {
+		containers = append(containers, info)
+	}
+	return containers, nil
+}
+
+func (s stubInspector) Inspect(_ context.Context, id string) (dns.ContainerInfo, error) {
+	info, ok := s[id]
+	if !ok {
+		return dns.ContainerInfo{}, &docker.APIError{StatusCode: 404, Message: "No such container: " + id}
+	}
+	return info, nil
+}
+
+type stubProvider struct {
+	name    string
+	filters []string
+	adapter *stubAdapter
+}
+
+func (p *stubProvider) Name() string               { return p.name }
+func (p *stubProvider) Type() string               { return "stub" }
+func (p *stubProvider) ZoneFilters() []string      { return p.filters }
+func (p *stubProvider) Adapter() providers.Adapter { return p.adapter }
+
+type stubAdapter struct {
+	onDelete func()
+}
+
+func (a *stubAdapter) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+func (a *stubAdapter) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+func (a *stubAdapter) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+func (a *stubAdapter) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	if a.onDelete != nil {
+		a.onDelete()
+	}
+	return records, nil
+}
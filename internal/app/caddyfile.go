@@ -0,0 +1,44 @@
+package app
+
+import (
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func init() {
+	httpcaddyfile.RegisterGlobalOption("dns_sync", parseGlobalOption)
+}
+
+// parseGlobalOption turns a dns_sync global option block into the app's JSON
+// config:
+//
+//	{
+//		dns_sync {
+//			label_prefix       <prefix>
+//			reconcile_interval <duration>
+//			docker_socket      <path>
+//			policy             sync|upsert-only|create-only
+//			provider <name> <type> [<zone_filters...>] {
+//				...
+//			}
+//		}
+//	}
+//
+// Environment variables and defaults are applied later, during provisioning,
+// so that the adapted JSON only contains what the Caddyfile set.
+func parseGlobalOption(d *caddyfile.Dispenser, existing any) (any, error) {
+	if existing != nil {
+		return nil, d.Err("dns_sync global option may only be specified once")
+	}
+
+	app := new(App)
+	if err := app.Config.UnmarshalCaddyfile(d); err != nil {
+		return nil, err
+	}
+
+	return httpcaddyfile.App{
+		Name:  "dns_sync",
+		Value: caddyconfig.JSON(app, nil),
+	}, nil
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func TestCaddyfileAdapt(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "full block",
+			input: `{
+	dns_sync {
+		label_prefix caddy_dns_custom
+		reconcile_interval 30s
+		docker_socket /var/run/custom.sock
+		state_file /var/lib/caddy/dns_sync.json
+		owner_id edge-1
+		provider cloudflare-primary cloudflare example.com {
+			token abc123
+			ttl 120
+			proxied true
+		}
+	}
+}
+
+example.com {
+	respond "ok"
+}`,
+			expected: `{
+	"label_prefix": "caddy_dns_custom",
+	"reconcile_interval": 30000000000,
+	"docker_socket": "/var/run/custom.sock",
+	"state_file": "/var/lib/caddy/dns_sync.json",
+	"owner_id": "edge-1",
+	"providers": [
+		{
+			"name": "cloudflare-primary",
+			"type": "cloudflare",
+			"zone_filters": ["example.com"],
+			"ttl": 120,
+			"proxied": true,
+			"token": "abc123"
+		}
+	]
+}`,
+		},
+		{
+			name: "empty block leaves defaults to provisioning",
+			input: `{
+	dns_sync
+}`,
+			expected: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := adaptDNSSync(t, tt.input)
+
+			var want map[string]any
+			if err := json.Unmarshal([]byte(tt.expected), &want); err != nil {
+				t.Fatalf("unmarshal expected: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "\t")
+				t.Fatalf("adapted config mismatch\ngot:\n%s\nwant:\n%s", gotJSON, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCaddyfileAdaptRejectsUnknownSubdirective(t *testing.T) {
+	input := `{
+	dns_sync {
+		bogus value
+	}
+}`
+
+	adapter := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}
+	if _, _, err := adapter.Adapt([]byte(input), nil); err == nil {
+		t.Fatal("expected error for unknown subdirective")
+	}
+}
+
+func adaptDNSSync(t *testing.T, input string) map[string]any {
+	t.Helper()
+
+	adapter := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}
+	out, _, err := adapter.Adapt([]byte(input), nil)
+	if err != nil {
+		t.Fatalf("adapt: %v", err)
+	}
+
+	var cfg struct {
+		Apps map[string]json.RawMessage `json:"apps"`
+	}
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		t.Fatalf("unmarshal adapted config: %v", err)
+	}
+
+	raw, ok := cfg.Apps["dns_sync"]
+	if !ok {
+		t.Fatalf("adapted config has no dns_sync app: %s", out)
+	}
+
+	var app map[string]any
+	if err := json.Unmarshal(raw, &app); err != nil {
+		t.Fatalf("unmarshal dns_sync app: %v", err)
+	}
+	return app
+}
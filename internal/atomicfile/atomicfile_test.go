@@ -0,0 +1,54 @@
+package atomicfile
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing fs.FileMode // 0 when the file does not exist yet
+		wantMode fs.FileMode
+	}{
+		{name: "new file", wantMode: 0o600},
+		{name: "keeps mode", existing: 0o640, wantMode: 0o640},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "records")
+			if tt.existing != 0 {
+				if err := os.WriteFile(path, []byte("old"), tt.existing); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				if err := os.Chmod(path, tt.existing); err != nil {
+					t.Fatalf("chmod: %v", err)
+				}
+			}
+
+			if err := WriteFile(path, []byte("new"), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil || string(data) != "new" {
+				t.Fatalf("content = %q, %v, want new", data, err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Fatalf("mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("directory holds %d entries, want no temporary files left", len(entries))
+			}
+		})
+	}
+}
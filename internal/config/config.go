@@ -1,13 +1,19 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 )
 
@@ -15,12 +21,33 @@ const (
 	defaultLabelPrefix       = "caddy_dns"
 	defaultDockerSocket      = "/var/run/docker.sock"
 	defaultReconcileInterval = 5 * time.Minute
+	defaultStateFileName     = "state.json"
+)
+
+// Target modes choose the address a provider's A and AAAA records point at.
+const (
+	TargetModeContainer     = "container"
+	TargetModeStatic        = "static"
+	TargetModeHostInterface = "host-interface"
+	TargetModePublicIP      = "public-ip"
+)
+
+// Policies choose which changes are made to records that already exist,
+// following external-dns: sync creates, updates and deletes, upsert-only
+// never deletes and create-only neither updates nor deletes.
+const (
+	PolicySync       = "sync"
+	PolicyUpsertOnly = "upsert-only"
+	PolicyCreateOnly = "create-only"
 )
 
 type Config struct {
 	LabelPrefix       string           `json:"label_prefix,omitempty"`
 	ReconcileInterval caddy.Duration   `json:"reconcile_interval,omitempty"`
 	DockerSocket      string           `json:"docker_socket,omitempty"`
+	StateFile         string           `json:"state_file,omitempty"`
+	OwnerID           string           `json:"owner_id,omitempty"`
+	Policy            string           `json:"policy,omitempty"`
 	Providers         []ProviderConfig `json:"providers,omitempty"`
 }
 
@@ -34,6 +61,39 @@ type ProviderConfig struct {
 	ControllerURL string   `json:"controller_url,omitempty"`
 	Username      string   `json:"username,omitempty"`
 	Password      string   `json:"password,omitempty"`
+	Server        string   `json:"server,omitempty"`
+	TSIGKeyName   string   `json:"tsig_key_name,omitempty"`
+	TSIGAlgorithm string   `json:"tsig_algorithm,omitempty"`
+	TSIGSecret    string   `json:"tsig_secret,omitempty"`
+	File          string   `json:"file,omitempty"`
+	Format        string   `json:"format,omitempty"`
+
+	// TargetMode points records at the proxy instead of the container. Nil
+	// means the container's own address.
+	TargetMode *TargetConfig `json:"target_mode,omitempty"`
+
+	// DNSProvider is a Caddy dns.providers module, used by the "caddy"
+	// provider type to reuse any libdns provider built into Caddy.
+	DNSProvider json.RawMessage `json:"dns_provider,omitempty" caddy:"namespace=dns.providers inline_key=name"`
+}
+
+// TargetConfig selects where a provider's records point: the container
+// ("container"), a fixed address ("static"), the addresses of a host network
+// interface ("host-interface") or the public address the configured sources
+// agree on ("public-ip"). In public-ip mode the address is polled and records
+// follow it when it changes.
+type TargetConfig struct {
+	Mode      string `json:"mode,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Interface string `json:"interface,omitempty"`
+
+	// Public address sources: HTTP echo services answering with the
+	// caller's address as plain text, STUN servers (host:port) and the
+	// control URL of a UPnP internet gateway's WANIPConnection service.
+	EchoURLs     []string       `json:"echo_urls,omitempty"`
+	STUNServers  []string       `json:"stun_servers,omitempty"`
+	UPnPURL      string         `json:"upnp_url,omitempty"`
+	PollInterval caddy.Duration `json:"poll_interval,omitempty"`
 }
 
 func DefaultConfig() Config {
@@ -41,9 +101,17 @@ func DefaultConfig() Config {
 		LabelPrefix:       defaultLabelPrefix,
 		ReconcileInterval: caddy.Duration(defaultReconcileInterval),
 		DockerSocket:      defaultDockerSocket,
+		StateFile:         DefaultStateFile(),
+		Policy:            PolicySync,
 	}
 }
 
+// DefaultStateFile is where record ownership is persisted when no state_file
+// is configured: a dns_sync directory under Caddy's data directory.
+func DefaultStateFile() string {
+	return filepath.Join(caddy.AppDataDir(), "dns_sync", defaultStateFileName)
+}
+
 func Load(dispenser *caddyfile.Dispenser) (Config, error) {
 	cfg := DefaultConfig()
 	if err := cfg.ApplyEnv(); err != nil {
@@ -77,6 +145,48 @@ func (c *Config) ApplyEnv() error {
 		c.DockerSocket = value
 	}
 
+	if value, ok := os.LookupEnv("CADDY_DNS_STATE_FILE"); ok && value != "" {
+		c.StateFile = value
+	}
+
+	if value, ok := os.LookupEnv("CADDY_DNS_OWNER_ID"); ok && value != "" {
+		c.OwnerID = value
+	}
+
+	if value, ok := os.LookupEnv("CADDY_DNS_POLICY"); ok && value != "" {
+		c.Policy = value
+	}
+
+	return nil
+}
+
+// ApplyDefaults fills any unset fields from the environment and the built-in
+// defaults, leaving explicitly configured values untouched.
+func (c *Config) ApplyDefaults() error {
+	base := DefaultConfig()
+	if err := base.ApplyEnv(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(c.LabelPrefix) == "" {
+		c.LabelPrefix = base.LabelPrefix
+	}
+	if c.ReconcileInterval == 0 {
+		c.ReconcileInterval = base.ReconcileInterval
+	}
+	if strings.TrimSpace(c.DockerSocket) == "" {
+		c.DockerSocket = base.DockerSocket
+	}
+	if strings.TrimSpace(c.StateFile) == "" {
+		c.StateFile = base.StateFile
+	}
+	if strings.TrimSpace(c.OwnerID) == "" {
+		c.OwnerID = base.OwnerID
+	}
+	if strings.TrimSpace(c.Policy) == "" {
+		c.Policy = base.Policy
+	}
+
 	return nil
 }
 
@@ -106,6 +216,24 @@ func (c *Config) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 					return err
 				}
 				c.DockerSocket = value
+			case "state_file":
+				value, err := parseSingleArg(d)
+				if err != nil {
+					return err
+				}
+				c.StateFile = value
+			case "owner_id":
+				value, err := parseSingleArg(d)
+				if err != nil {
+					return err
+				}
+				c.OwnerID = value
+			case "policy":
+				value, err := parseSingleArg(d)
+				if err != nil {
+					return err
+				}
+				c.Policy = value
 			case "provider":
 				provider, err := parseProviderBlock(d)
 				if err != nil {
@@ -130,6 +258,17 @@ func (c *Config) Validate() error {
 	if strings.TrimSpace(c.DockerSocket) == "" {
 		return fmt.Errorf("docker_socket must not be empty")
 	}
+	if strings.TrimSpace(c.StateFile) == "" {
+		return fmt.Errorf("state_file must not be empty")
+	}
+	if strings.ContainsAny(c.OwnerID, ",= \t\"") {
+		return fmt.Errorf("owner_id %q must not contain commas, equals signs, quotes or whitespace", c.OwnerID)
+	}
+	switch c.Policy {
+	case PolicySync, PolicyUpsertOnly, PolicyCreateOnly:
+	default:
+		return fmt.Errorf("policy %q must be one of %s, %s or %s", c.Policy, PolicySync, PolicyUpsertOnly, PolicyCreateOnly)
+	}
 
 	seen := make(map[string]struct{})
 	for i, provider := range c.Providers {
@@ -149,11 +288,56 @@ func (c *Config) Validate() error {
 		if provider.TTL != nil && *provider.TTL <= 0 {
 			return fmt.Errorf("provider %q ttl must be positive", provider.Name)
 		}
+		if provider.TargetMode != nil {
+			if err := provider.TargetMode.validate(); err != nil {
+				return fmt.Errorf("provider %q %w", provider.Name, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+func (t TargetConfig) validate() error {
+	switch t.Mode {
+	case "", TargetModeContainer:
+		return nil
+	case TargetModeStatic:
+		if _, err := netip.ParseAddr(t.Address); err != nil {
+			return fmt.Errorf("target_mode static needs an IP address, got %q", t.Address)
+		}
+	case TargetModeHostInterface:
+		if strings.TrimSpace(t.Interface) == "" {
+			return fmt.Errorf("target_mode host-interface needs an interface name")
+		}
+	case TargetModePublicIP:
+		for _, echoURL := range t.EchoURLs {
+			if !isHTTPURL(echoURL) {
+				return fmt.Errorf("target_mode public-ip echo URL %q must be an http or https URL", echoURL)
+			}
+		}
+		for _, server := range t.STUNServers {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				return fmt.Errorf("target_mode public-ip STUN server %q must be host:port", server)
+			}
+		}
+		if t.UPnPURL != "" && !isHTTPURL(t.UPnPURL) {
+			return fmt.Errorf("target_mode public-ip UPnP URL %q must be an http or https URL", t.UPnPURL)
+		}
+		if t.PollInterval < 0 {
+			return fmt.Errorf("target_mode public-ip poll_interval must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown target_mode %q", t.Mode)
+	}
+	return nil
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func parseSingleArg(d *caddyfile.Dispenser) (string, error) {
 	if !d.NextArg() {
 		return "", d.ArgErr()
@@ -178,7 +362,8 @@ func parseProviderBlock(d *caddyfile.Dispenser) (ProviderConfig, error) {
 		provider.ZoneFilters = append(provider.ZoneFilters, args[2:]...)
 	}
 
-	for d.NextBlock(d.Nesting()) {
+	nesting := d.Nesting()
+	for d.NextBlock(nesting) {
 		switch d.Val() {
 		case "zone_filters":
 			filters := d.RemainingArgs()
@@ -210,6 +395,48 @@ func parseProviderBlock(d *caddyfile.Dispenser) (ProviderConfig, error) {
 				return ProviderConfig{}, err
 			}
 			provider.Password = value
+		case "server":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.Server = value
+		case "tsig_key_name":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.TSIGKeyName = value
+		case "tsig_algorithm":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.TSIGAlgorithm = value
+		case "tsig_secret":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.TSIGSecret = value
+		case "file":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.File = value
+		case "format":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.Format = value
+		case "target_mode":
+			target, err := parseTargetMode(d)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.TargetMode = target
 		case "ttl":
 			value, err := parseSingleArg(d)
 			if err != nil {
@@ -230,6 +457,16 @@ func parseProviderBlock(d *caddyfile.Dispenser) (ProviderConfig, error) {
 				return ProviderConfig{}, d.Errf("invalid proxied %q: %v", value, err)
 			}
 			provider.Proxied = &proxied
+		case "dns":
+			if !d.NextArg() {
+				return ProviderConfig{}, d.ArgErr()
+			}
+			name := d.Val()
+			unm, err := caddyfile.UnmarshalModule(d, "dns.providers."+name)
+			if err != nil {
+				return ProviderConfig{}, err
+			}
+			provider.DNSProvider = caddyconfig.JSONModuleObject(unm, "name", name, nil)
 		default:
 			return ProviderConfig{}, d.Errf("unrecognized provider option %q", d.Val())
 		}
@@ -237,3 +474,81 @@ func parseProviderBlock(d *caddyfile.Dispenser) (ProviderConfig, error) {
 
 	return provider, nil
 }
+
+// parseTargetMode reads "target_mode <mode> [argument...]", where the
+// argument is the address for static, the interface for host-interface and
+// echo URLs for public-ip. public-ip also takes a block:
+//
+//	target_mode public-ip {
+//		echo <url...>
+//		stun <host:port...>
+//		upnp <control-url>
+//		poll_interval <duration>
+//	}
+func parseTargetMode(d *caddyfile.Dispenser) (*TargetConfig, error) {
+	args := d.RemainingArgs()
+	if len(args) == 0 {
+		return nil, d.ArgErr()
+	}
+	target := &TargetConfig{Mode: args[0]}
+	args = args[1:]
+	switch target.Mode {
+	case TargetModeContainer:
+		if len(args) != 0 {
+			return nil, d.ArgErr()
+		}
+	case TargetModeStatic, TargetModeHostInterface:
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		if target.Mode == TargetModeStatic {
+			target.Address = args[0]
+		} else {
+			target.Interface = args[0]
+		}
+	case TargetModePublicIP:
+		target.EchoURLs = args
+	default:
+		return nil, d.Errf("unknown target_mode %q", target.Mode)
+	}
+
+	nesting := d.Nesting()
+	for d.NextBlock(nesting) {
+		if target.Mode != TargetModePublicIP {
+			return nil, d.Errf("target_mode %s takes no options", target.Mode)
+		}
+		switch d.Val() {
+		case "echo":
+			urls := d.RemainingArgs()
+			if len(urls) == 0 {
+				return nil, d.ArgErr()
+			}
+			target.EchoURLs = append(target.EchoURLs, urls...)
+		case "stun":
+			servers := d.RemainingArgs()
+			if len(servers) == 0 {
+				return nil, d.ArgErr()
+			}
+			target.STUNServers = append(target.STUNServers, servers...)
+		case "upnp":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return nil, err
+			}
+			target.UPnPURL = value
+		case "poll_interval":
+			value, err := parseSingleArg(d)
+			if err != nil {
+				return nil, err
+			}
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, d.Errf("invalid poll_interval %q: %v", value, err)
+			}
+			target.PollInterval = caddy.Duration(interval)
+		default:
+			return nil, d.Errf("unrecognized target_mode option %q", d.Val())
+		}
+	}
+	return target, nil
+}
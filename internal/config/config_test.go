@@ -1,9 +1,11 @@
 package config
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 )
 
@@ -109,3 +111,171 @@ func TestLoadRejectsNonPositiveTTL(t *testing.T) {
 		t.Fatal("expected error for non-positive ttl")
 	}
 }
+
+func TestLoadRejectsOwnerIDWithSeparators(t *testing.T) {
+	input := `dns_sync {
+	owner_id "edge,1"
+}`
+
+	d := caddyfile.NewTestDispenser(input)
+	_, err := Load(d)
+	if err == nil {
+		t.Fatal("expected error for owner_id containing a comma")
+	}
+}
+
+func TestLoadParsesPolicy(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Policy != PolicySync {
+		t.Fatalf("default policy = %q, want %q", cfg.Policy, PolicySync)
+	}
+
+	d := caddyfile.NewTestDispenser(`dns_sync {
+	policy upsert-only
+}`)
+	cfg, err = Load(d)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Policy != PolicyUpsertOnly {
+		t.Fatalf("policy = %q, want %q", cfg.Policy, PolicyUpsertOnly)
+	}
+
+	d = caddyfile.NewTestDispenser(`dns_sync {
+	policy delete-everything
+}`)
+	if _, err := Load(d); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
+
+func TestApplyDefaultsKeepsExplicitValues(t *testing.T) {
+	t.Setenv("CADDY_DNS_LABEL_PREFIX", "env_prefix")
+	t.Setenv("CADDY_DNS_DOCKER_SOCKET", "/tmp/docker.sock")
+
+	cfg := Config{LabelPrefix: "explicit"}
+	if err := cfg.ApplyDefaults(); err != nil {
+		t.Fatalf("apply defaults: %v", err)
+	}
+
+	if cfg.LabelPrefix != "explicit" {
+		t.Fatalf("label prefix = %q, want %q", cfg.LabelPrefix, "explicit")
+	}
+	if cfg.DockerSocket != "/tmp/docker.sock" {
+		t.Fatalf("docker socket = %q, want %q", cfg.DockerSocket, "/tmp/docker.sock")
+	}
+	if time.Duration(cfg.ReconcileInterval) != defaultReconcileInterval {
+		t.Fatalf("reconcile interval = %s, want %s", time.Duration(cfg.ReconcileInterval), defaultReconcileInterval)
+	}
+	if cfg.StateFile != DefaultStateFile() {
+		t.Fatalf("state file = %q, want %q", cfg.StateFile, DefaultStateFile())
+	}
+}
+
+func TestLoadParsesProviderBlockOptions(t *testing.T) {
+	input := `dns_sync {
+	provider cloudflare-primary cloudflare {
+		zone_filters example.com example.org
+		token abc123
+		ttl 120
+		proxied true
+	}
+	label_prefix custom
+}`
+
+	d := caddyfile.NewTestDispenser(input)
+	cfg, err := Load(d)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	if cfg.LabelPrefix != "custom" {
+		t.Fatalf("label prefix = %q, want %q", cfg.LabelPrefix, "custom")
+	}
+	if len(cfg.Providers) != 1 {
+		t.Fatalf("providers = %d, want %d", len(cfg.Providers), 1)
+	}
+	provider := cfg.Providers[0]
+	if len(provider.ZoneFilters) != 2 {
+		t.Fatalf("zone filters = %v, want 2 entries", provider.ZoneFilters)
+	}
+	if provider.Token != "abc123" {
+		t.Fatalf("token = %q, want %q", provider.Token, "abc123")
+	}
+	if provider.TTL == nil || *provider.TTL != 120 {
+		t.Fatalf("ttl = %v, want 120", provider.TTL)
+	}
+	if provider.Proxied == nil || !*provider.Proxied {
+		t.Fatalf("proxied = %v, want true", provider.Proxied)
+	}
+}
+
+func TestLoadParsesTargetMode(t *testing.T) {
+	input := `dns_sync {
+	provider public cloudflare example.com {
+		target_mode public-ip https://ip.example.net {
+			echo https://ifconfig.example.org/ip
+			stun stun.example.net:3478
+			upnp http://192.168.1.1:49000/ctl/IPConn
+			poll_interval 2m
+		}
+	}
+	provider lan rfc2136 home.lab {
+		server 192.168.1.1
+		target_mode host-interface eth0
+	}
+	provider edge cloudflare example.org {
+		target_mode static 203.0.113.5
+	}
+}`
+
+	d := caddyfile.NewTestDispenser(input)
+	cfg, err := Load(d)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	want := []TargetConfig{
+		{
+			Mode:         TargetModePublicIP,
+			EchoURLs:     []string{"https://ip.example.net", "https://ifconfig.example.org/ip"},
+			STUNServers:  []string{"stun.example.net:3478"},
+			UPnPURL:      "http://192.168.1.1:49000/ctl/IPConn",
+			PollInterval: caddy.Duration(2 * time.Minute),
+		},
+		{Mode: TargetModeHostInterface, Interface: "eth0"},
+		{Mode: TargetModeStatic, Address: "203.0.113.5"},
+	}
+	for i, provider := range cfg.Providers {
+		if provider.TargetMode == nil || !reflect.DeepEqual(*provider.TargetMode, want[i]) {
+			t.Fatalf("provider %q target_mode = %+v, want %+v", provider.Name, provider.TargetMode, want[i])
+		}
+	}
+}
+
+func TestLoadRejectsInvalidTargetMode(t *testing.T) {
+	tests := map[string]string{
+		"unknown mode":      "target_mode proxy",
+		"static without IP": "target_mode static edge.example.com",
+		"missing interface": "target_mode host-interface",
+		"bad echo URL":      "target_mode public-ip ftp://ip.example.net",
+		"STUN without port": "target_mode public-ip {\n\t\t\tstun stun.example.net\n\t\t}",
+		"option on static":  "target_mode static 203.0.113.5 {\n\t\t\tpoll_interval 1m\n\t\t}",
+	}
+
+	for name, option := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := `dns_sync {
+	provider public cloudflare example.com {
+		` + option + `
+	}
+}`
+			if _, err := Load(caddyfile.NewTestDispenser(input)); err == nil {
+				t.Fatalf("expected error for %q", option)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/docker"
+)
+
+const defaultCoalesceWindow = 500 * time.Millisecond
+
+// Inspector looks up the current state of a single container.
+type Inspector interface {
+	Inspect(ctx context.Context, id string) (dns.ContainerInfo, error)
+}
+
+// Options configures a Controller.
+type Options struct {
+	LabelPrefix string
+	// CoalesceWindow is how long events for one container are collected
+	// before acting on the latest of them.
+	CoalesceWindow time.Duration
+	Logger         *zap.Logger
+}
+
+// Controller applies Docker lifecycle events to the DNS manager. Events are
+// coalesced per container: a burst of start/update/die events for the same
+// container results in a single inspection and at most one provider call.
+type Controller struct {
+	inspector Inspector
+	manager   *dns.Manager
+	opts      Options
+	logger    *zap.Logger
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingEvent
+}
+
+type action int
+
+const (
+	actionSync action = iota
+	actionRemove
+)
+
+type pendingEvent struct {
+	action action
+	due    time.Time
+}
+
+// New returns a controller that inspects containers with inspector and
+// records the outcome in manager.
+func New(inspector Inspector, manager *dns.Manager, opts Options) *Controller {
+	if opts.CoalesceWindow <= 0 {
+		opts.CoalesceWindow = defaultCoalesceWindow
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Controller{
+		inspector: inspector,
+		manager:   manager,
+		opts:      opts,
+		logger:    logger,
+		now:       time.Now,
+		pending:   make(map[string]pendingEvent),
+	}
+}
+
+// Run consumes events until the channel closes or ctx is cancelled. Anything
+// still pending when the channel closes is flushed before returning.
+func (c *Controller) Run(ctx context.Context, events <-chan docker.Event) error {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				c.flush(ctx, time.Time{})
+				return nil
+			}
+			if c.enqueue(event) {
+				c.resetTimer(timer)
+			}
+		case <-timer.C:
+			c.flush(ctx, c.now())
+			c.resetTimer(timer)
+		}
+	}
+}
+
+// enqueue records event and reports whether it was accepted.
+func (c *Controller) enqueue(event docker.Event) bool {
+	if event.Type != "" && event.Type != docker.EventTypeContainer {
+		return false
+	}
+	if event.ID == "" {
+		return false
+	}
+
+	act, ok := classify(event.Action)
+	if !ok {
+		c.logger.Debug("ignoring docker event", zap.String("container", event.ID), zap.String("action", event.Action))
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.pending[event.ID]
+	if !exists {
+		entry.due = c.now().Add(c.opts.CoalesceWindow)
+	}
+	// The latest event decides what happens once the window closes.
+	entry.action = act
+	c.pending[event.ID] = entry
+	return true
+}
+
+func (c *Controller) resetTimer(timer *time.Timer) {
+	c.mu.Lock()
+	var next time.Time
+	for _, entry := range c.pending {
+		if next.IsZero() || entry.due.Before(next) {
+			next = entry.due
+		}
+	}
+	c.mu.Unlock()
+
+	timer.Stop()
+	if next.IsZero() {
+		return
+	}
+
+	wait := next.Sub(c.now())
+	if wait < 0 {
+		wait = 0
+	}
+	timer.Reset(wait)
+}
+
+// flush handles every pending container due at or before now. A zero now
+// flushes everything.
+func (c *Controller) flush(ctx context.Context, now time.Time) {
+	c.mu.Lock()
+	due := make([]string, 0, len(c.pending))
+	actions := make(map[string]action, len(c.pending))
+	for id, entry := range c.pending {
+		if now.IsZero() || !entry.due.After(now) {
+			due = append(due, id)
+			actions[id] = entry.action
+			delete(c.pending, id)
+		}
+	}
+	c.mu.Unlock()
+
+	// Removals go first so that a container recreated under the same
+	// hostname is not judged against the one it replaces.
+	sort.Slice(due, func(i, j int) bool {
+		ri, rj := actions[due[i]] == actionRemove, actions[due[j]] == actionRemove
+		if ri != rj {
+			return ri
+		}
+		return due[i] < due[j]
+	})
+	for _, id := range due {
+		c.handle(ctx, id, actions[id])
+	}
+}
+
+func (c *Controller) handle(ctx context.Context, id string, act action) {
+	var err error
+	switch act {
+	case actionRemove:
+		err = c.remove(ctx, id)
+	default:
+		err = c.sync(ctx, id)
+	}
+
+	if err != nil {
+		c.logger.Error("handle container event",
+			zap.String("container", id),
+			zap.Error(err),
+		)
+	}
+}
+
+func (c *Controller) sync(ctx context.Context, id string) error {
+	info, err := c.inspector.Inspect(ctx, id)
+	if err != nil {
+		if docker.IsNotFound(err) {
+			return c.remove(ctx, id)
+		}
+		return err
+	}
+	if !info.IsRunning {
+		return c.remove(ctx, id)
+	}
+
+	requests, err := c.manager.ComputeDesiredState([]dns.ContainerInfo{info}, c.opts.LabelPrefix)
+	if err != nil {
+		return err
+	}
+
+	// The container's requests are its whole desired state, so records it
+	// no longer asks for, e.g. after its labels were removed, are pruned.
+	c.logger.Debug("syncing container records",
+		zap.String("container", id),
+		zap.Int("requests", len(requests)),
+	)
+	result, err := c.manager.SyncContainers(ctx, []string{id}, requests)
+	for _, entry := range result.Entries {
+		switch entry.Outcome {
+		case dns.SyncOutcomeCreated:
+			dns.RecordMetricCreated(entry.ProviderName)
+		case dns.SyncOutcomeDeleted:
+			dns.RecordMetricDeleted(entry.ProviderName)
+		case dns.SyncOutcomeFailed:
+			dns.RecordMetricError(entry.ProviderName, "sync")
+		}
+	}
+	c.logger.Debug("synced container records",
+		zap.String("container", id),
+		zap.Int("created", result.Count(dns.SyncOutcomeCreated)),
+		zap.Int("updated", result.Count(dns.SyncOutcomeUpdated)),
+		zap.Int("unchanged", result.Count(dns.SyncOutcomeUnchanged)),
+		zap.Int("deleted", result.Count(dns.SyncOutcomeDeleted)),
+		zap.Int("skipped", result.Count(dns.SyncOutcomeSkipped)),
+		zap.Int("failed", result.Count(dns.SyncOutcomeFailed)),
+	)
+	return err
+}
+
+func (c *Controller) remove(ctx context.Context, id string) error {
+	c.logger.Debug("removing container records", zap.String("container", id))
+	return c.manager.DeleteRecordsForContainer(ctx, id)
+}
+
+func classify(eventAction string) (action, bool) {
+	switch eventAction {
+	case "start", "update":
+		return actionSync, true
+	case "die", "stop", "destroy", "remove":
+		return actionRemove, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/docker"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+func TestControllerCoalescesBurstIntoOneProviderCall(t *testing.T) {
+	adapter := &countingAdapter{}
+	manager := newManager(adapter)
+	inspector := &fakeInspector{containers: map[string]dns.ContainerInfo{
+		"web": runningContainer("web", "app.example.com"),
+	}}
+
+	ctrl := New(inspector, manager, Options{LabelPrefix: "caddy_dns", CoalesceWindow: 20 * time.Millisecond})
+
+	events := make(chan docker.Event)
+	done := runController(t, ctrl, events)
+
+	for _, action := range []string{"start", "update", "update", "update"} {
+		events <- docker.Event{ID: "web", Type: docker.EventTypeContainer, Action: action}
+	}
+	close(events)
+	<-done
+
+	if got := adapter.count("append"); got != 1 {
+		t.Fatalf("append calls = %d, want 1", got)
+	}
+	if got := inspector.calls(); got != 1 {
+		t.Fatalf("inspect calls = %d, want 1", got)
+	}
+	if records := manager.GetRecords(); len(records) != 1 {
+		t.Fatalf("records = %d, want 1", len(records))
+	}
+}
+
+func TestControllerLatestEventWins(t *testing.T) {
+	adapter := &countingAdapter{}
+	manager := newManager(adapter)
+	inspector := &fakeInspector{containers: map[string]dns.ContainerInfo{
+		"web": runningContainer("web", "app.example.com"),
+	}}
+	ctrl := New(inspector, manager, Options{LabelPrefix: "caddy_dns", CoalesceWindow: time.Hour})
+
+	ctx := context.Background()
+	if _, err := manager.Sync(ctx, mustDesired(t, manager, inspector.containers["web"])); err != nil {
+		t.Fatalf("seed sync: %v", err)
+	}
+
+	ctrl.enqueue(docker.Event{ID: "web", Type: docker.EventTypeContainer, Action: "start"})
+	ctrl.enqueue(docker.Event{ID: "web", Type: docker.EventTypeContainer, Action: "die"})
+	ctrl.flush(ctx, time.Time{})
+
+	if got := inspector.calls(); got != 0 {
+		t.Fatalf("inspect calls = %d, want 0 for a removal", got)
+	}
+	if got := adapter.count("delete"); got != 1 {
+		t.Fatalf("delete calls = %d, want 1", got)
+	}
+	if records := manager.GetRecords(); len(records) != 0 {
+		t.Fatalf("records = %d, want 0", len(records))
+	}
+}
+
+func TestControllerRemovesRecordsWhenContainerIsGone(t *testing.T) {
+	adapter := &countingAdapter{}
+	manager := newManager(adapter)
+	container := runningContainer("web", "app.example.com")
+	inspector := &fakeInspector{containers: map[string]dns.ContainerInfo{}}
+	ctrl := New(inspector, manager, Options{LabelPrefix: "caddy_dns"})
+
+	ctx := context.Background()
+	if _, err := manager.Sync(ctx, mustDesired(t, manager, container)); err != nil {
+		t.Fatalf("seed sync: %v", err)
+	}
+
+	ctrl.enqueue(docker.Event{ID: "web", Type: docker.EventTypeContainer, Action: "update"})
+	ctrl.flush(ctx, time.Time{})
+
+	if got := adapter.count("delete"); got != 1 {
+		t.Fatalf("delete calls = %d, want 1", got)
+	}
+}
+
+func TestControllerIgnoresUnrelatedEvents(t *testing.T) {
+	ctrl := New(&fakeInspector{}, newManager(&countingAdapter{}), Options{})
+
+	if ctrl.enqueue(docker.Event{ID: "web", Type: docker.EventTypeContainer, Action: "create"}) {
+		t.Fatal("expected create event to be ignored")
+	}
+	if ctrl.enqueue(docker.Event{ID: "svc", Type: docker.EventTypeService, Action: "update"}) {
+		t.Fatal("expected service event to be ignored")
+	}
+	if ctrl.enqueue(docker.Event{Type: docker.EventTypeContainer, Action: "start"}) {
+		t.Fatal("expected event without id to be ignored")
+	}
+}
+
+func TestControllerFlushesOnlyDueContainers(t *testing.T) {
+	adapter := &countingAdapter{}
+	manager := newManager(adapter)
+	inspector := &fakeInspector{containers: map[string]dns.ContainerInfo{
+		"a": runningContainer("a", "a.example.com"),
+		"b": runningContainer("b", "b.example.com"),
+	}}
+	ctrl := New(inspector, manager, Options{LabelPrefix: "caddy_dns", CoalesceWindow: time.Second})
+
+	anchor := time.Date(2026, 2, 2, 12, 0, 0, 0, time.UTC)
+	ctrl.now = func() time.Time { return anchor }
+	ctrl.enqueue(docker.Event{ID: "a", Type: docker.EventTypeContainer, Action: "start"})
+	ctrl.now = func() time.Time { return anchor.Add(500 * time.Millisecond) }
+	ctrl.enqueue(docker.Event{ID: "b", Type: docker.EventTypeContainer, Action: "start"})
+
+	ctrl.flush(context.Background(), anchor.Add(time.Second))
+
+	if got := adapter.count("append"); got != 1 {
+		t.Fatalf("append calls = %d, want 1", got)
+	}
+	if _, pending := ctrl.pending["b"]; !pending {
+		t.Fatal("expected container b to still be pending")
+	}
+}
+
+func TestControllerRemovesBeforeSyncing(t *testing.T) {
+	adapter := &countingAdapter{}
+	manager := newManager(adapter)
+	replacement := runningContainer("a-new", "app.example.com")
+	replacement.IPV4 = []string{"192.0.2.20"}
+	inspector := &fakeInspector{containers: map[string]dns.ContainerInfo{"a-new": replacement}}
+	ctrl := New(inspector, manager, Options{LabelPrefix: "caddy_dns"})
+
+	ctx := context.Background()
+	if _, err := manager.Sync(ctx, mustDesired(t, manager, runningContainer("z-old", "app.example.com"))); err != nil {
+		t.Fatalf("seed sync: %v", err)
+	}
+
+	// The replacement sorts first but must not be judged against z-old
+	ctrl.enqueue(docker.Event{ID: "a-new", Type: docker.EventTypeContainer, Action: "start"})
+	ctrl.enqueue(docker.Event{ID: "z-old", Type: docker.EventTypeContainer, Action: "die"})
+	ctrl.flush(ctx, time.Time{})
+
+	records := manager.GetRecords()
+	if len(records) != 1 || records[0].SourceID != "a-new" || records[0].Value != "192.0.2.20" {
+		t.Fatalf("records = %+v, want a-new's record", records)
+	}
+	if conflicts := manager.GetConflicts(); len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v, want none", conflicts)
+	}
+	if appends, sets := adapter.count("append"), adapter.count("set"); appends != 2 || sets != 0 {
+		t.Fatalf("append = %d, set = %d, want a-new created after z-old was removed", appends, sets)
+	}
+}
+
+func runController(t *testing.T, ctrl *Controller, events <-chan docker.Event) <-chan struct{} {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := ctrl.Run(context.Background(), events); err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}()
+	return done
+}
+
+func mustDesired(t *testing.T, manager *dns.Manager, container dns.ContainerInfo) []dns.SyncRequest {
+	t.Helper()
+
+	requests, err := manager.ComputeDesiredState([]dns.ContainerInfo{container}, "caddy_dns")
+	if err != nil {
+		t.Fatalf("compute desired state: %v", err)
+	}
+	return requests
+}
+
+func runningContainer(id, hostname string) dns.ContainerInfo {
+	return dns.ContainerInfo{
+		ID:        id,
+		Name:      id,
+		IsRunning: true,
+		IPV4:      []string{"192.0.2.10"},
+		Labels: map[string]string{
+			"caddy_dns.hostname": hostname,
+			"caddy_dns.provider": "stub",
+		},
+	}
+}
+
+func newManager(adapter *countingAdapter) *dns.Manager {
+	return dns.NewManager([]providers.Provider{&stubProvider{adapter: adapter}})
+}
+
+type fakeInspector struct {
+	mu         sync.Mutex
+	containers map[string]dns.ContainerInfo
+	inspected  int
+}
+
+func (f *fakeInspector) Inspect(_ context.Context, id string) (dns.ContainerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.inspected++
+	info, ok := f.containers[id]
+	if !ok {
+		return dns.ContainerInfo{}, &docker.APIError{StatusCode: 404, Message: "No such container: " + id}
+	}
+	return info, nil
+}
+
+func (f *fakeInspector) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inspected
+}
+
+type stubProvider struct {
+	adapter *countingAdapter
+}
+
+func (p *stubProvider) Name() string               { return "stub" }
+func (p *stubProvider) Type() string               { return "stub" }
+func (p *stubProvider) ZoneFilters() []string      { return []string{"example.com"} }
+func (p *stubProvider) Adapter() providers.Adapter { return p.adapter }
+
+type countingAdapter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (a *countingAdapter) record(op string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.calls == nil {
+		a.calls = make(map[string]int)
+	}
+	a.calls[op]++
+}
+
+func (a *countingAdapter) count(op string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[op]
+}
+
+func (a *countingAdapter) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	a.record("get")
+	return nil, nil
+}
+
+func (a *countingAdapter) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	a.record("append")
+	return records, nil
+}
+
+func (a *countingAdapter) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	a.record("set")
+	return records, nil
+}
+
+func (a *countingAdapter) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	a.record("delete")
+	return records, nil
+}
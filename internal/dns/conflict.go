@@ -0,0 +1,333 @@
+package dns
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Conflict is a record a container asked for but did not get because another
+// container owns the hostname. Its State is always RecordStateConflict.
+type Conflict struct {
+	DNSRecord
+	// OwnerID is the container that holds the hostname.
+	OwnerID    string    `json:"owner_id"`
+	DetectedAt time.Time `json:"detected_at"`
+
+	requestedAt time.Time // breaks priority ties on promotion
+}
+
+// hostnameClaim is one container's claim on a hostname.
+type hostnameClaim struct {
+	sourceID    string
+	priority    int
+	requestedAt time.Time
+	order       int
+	tracked     bool
+}
+
+// ResolveConflicts drops the requests for hostnames another container owns
+// and records them as conflicts. The first container to claim a hostname
+// keeps it unless a challenger has a higher caddy_dns.priority.
+func (m *Manager) ResolveConflicts(requests []SyncRequest) []SyncRequest {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.resolveConflicts(requests)
+}
+
+// GetConflicts returns the current conflicts ordered by hostname, provider
+// and container.
+func (m *Manager) GetConflicts() []Conflict {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	conflicts := make([]Conflict, 0, len(m.conflicts))
+	for _, conflict := range m.conflicts {
+		conflicts = append(conflicts, *conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if ka, kb := recordKey(a.Hostname, a.ProviderName, a.RecordType, a.Value), recordKey(b.Hostname, b.ProviderName, b.RecordType, b.Value); ka != kb {
+			return ka < kb
+		}
+		return a.SourceID < b.SourceID
+	})
+	return conflicts
+}
+
+// resolveConflicts arbitrates every hostname in requests between the
+// containers asking for it and the container already tracked for it
+// (caller must hold lock).
+func (m *Manager) resolveConflicts(requests []SyncRequest) []SyncRequest {
+	claims := make(map[string][]*hostnameClaim)
+	asked := make(map[string]map[string]map[string]bool) // name, source, type and value
+	for i, req := range requests {
+		name := req.Hostname + ":" + req.ProviderName
+		if asked[name] == nil {
+			asked[name] = make(map[string]map[string]bool)
+		}
+		if asked[name][req.SourceID] == nil {
+			asked[name][req.SourceID] = make(map[string]bool)
+		}
+		asked[name][req.SourceID][string(req.RecordType)+" "+req.Target] = true
+		if _, ok := claims[name]; !ok {
+			if owner, ok := m.trackedOwner(req.Hostname, req.ProviderName); ok {
+				claims[name] = append(claims[name], owner)
+			}
+		}
+
+		var claim *hostnameClaim
+		for _, c := range claims[name] {
+			if c.sourceID == req.SourceID {
+				claim = c
+			}
+		}
+		switch {
+		case claim == nil:
+			claims[name] = append(claims[name], &hostnameClaim{sourceID: req.SourceID, priority: req.Priority, requestedAt: req.RequestedAt, order: i})
+		case claim.order < 0:
+			// The owner asks again; its current label decides.
+			claim.priority, claim.order = req.Priority, i
+		}
+	}
+
+	// A container asking for exactly the records of an owner that did not
+	// ask again takes them over, as when a container is recreated and its
+	// sync runs before the old one's removal. Every record of the hostname
+	// moves to it; the provider is unchanged.
+	for name, candidates := range claims {
+		owner := candidates[0]
+		if !owner.tracked || owner.order >= 0 {
+			continue
+		}
+		hostname, providerName, _ := strings.Cut(name, ":")
+		values := m.trackedValues(hostname, providerName)
+		for _, c := range candidates[1:] {
+			if c.priority >= owner.priority && maps.Equal(asked[name][c.sourceID], values) {
+				owner.tracked, c.tracked = false, true
+				m.reassignHostname(hostname, providerName, c.sourceID)
+				break
+			}
+		}
+	}
+
+	winners := make(map[string]string, len(claims))
+	for name, candidates := range claims {
+		winner := candidates[0]
+		for _, c := range candidates[1:] {
+			if claimOutranks(c, winner) {
+				winner = c
+			}
+		}
+		winners[name] = winner.sourceID
+	}
+
+	// Every container in requests is judged again, so its old conflicts
+	// for these hostnames go; the ones that still hold are recorded anew.
+	judged := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		judged[req.SourceID+"|"+req.Hostname+":"+req.ProviderName] = true
+	}
+	previous := make(map[string]*Conflict)
+	for key, conflict := range m.conflicts {
+		if judged[conflict.SourceID+"|"+conflict.Hostname+":"+conflict.ProviderName] {
+			previous[key] = conflict
+			delete(m.conflicts, key)
+		}
+	}
+
+	kept := make([]SyncRequest, 0, len(requests))
+	for _, req := range requests {
+		owner := winners[req.Hostname+":"+req.ProviderName]
+		if owner == req.SourceID {
+			kept = append(kept, req)
+			continue
+		}
+		m.recordConflict(req, owner, previous)
+	}
+	return kept
+}
+
+// recordConflict stores a rejected request. A conflict already in previous
+// with the same owner keeps its detection time and is not reported again
+// (caller must hold lock).
+func (m *Manager) recordConflict(req SyncRequest, owner string, previous map[string]*Conflict) {
+	key := conflictKey(req)
+	now := time.Now()
+	conflict := &Conflict{
+		DNSRecord: DNSRecord{
+			Hostname:     req.Hostname,
+			RecordType:   req.RecordType,
+			Value:        req.Target,
+			TTL:          requestTTL(req),
+			Proxied:      requestProxied(req),
+			ProviderName: req.ProviderName,
+			Priority:     req.Priority,
+			LastSyncAt:   now,
+			State:        RecordStateConflict,
+			SourceID:     req.SourceID,
+		},
+		OwnerID:     owner,
+		DetectedAt:  now,
+		requestedAt: req.RequestedAt,
+	}
+	if prev, ok := previous[key]; ok && prev.OwnerID == owner {
+		conflict.DetectedAt = prev.DetectedAt
+		m.conflicts[key] = conflict
+		return
+	}
+	m.conflicts[key] = conflict
+
+	RecordMetricConflict(req.ProviderName)
+	m.logger.Warn("hostname is owned by another container, request rejected",
+		zap.String("hostname", req.Hostname),
+		zap.String("provider", req.ProviderName),
+		zap.String("container", req.SourceID),
+		zap.String("owner", owner))
+}
+
+// clearConflicts forgets every conflict of a container (caller must hold lock).
+func (m *Manager) clearConflicts(sourceID string) {
+	for key, conflict := range m.conflicts {
+		if conflict.SourceID == sourceID {
+			delete(m.conflicts, key)
+		}
+	}
+}
+
+// promoteChallenger hands a hostname whose tracked records are all gone to
+// the strongest container that was rejected for it: its records are written
+// and the remaining challengers now conflict with it. A failed write leaves
+// the records in the error state for the retry loop (caller must hold lock).
+func (m *Manager) promoteChallenger(ctx context.Context, hostname, providerName string) {
+	var winner *Conflict
+	for _, conflict := range m.conflicts {
+		if conflict.Hostname != hostname || conflict.ProviderName != providerName {
+			continue
+		}
+		if winner == nil || conflictOutranks(conflict, winner) {
+			winner = conflict
+		}
+	}
+	if winner == nil {
+		return
+	}
+
+	var requests []SyncRequest
+	for key, conflict := range m.conflicts {
+		if conflict.Hostname != hostname || conflict.ProviderName != providerName {
+			continue
+		}
+		if conflict.SourceID != winner.SourceID {
+			conflict.OwnerID = winner.SourceID
+			continue
+		}
+		req := recordRequest(&conflict.DNSRecord)
+		req.RequestedAt = conflict.requestedAt
+		requests = append(requests, req)
+		delete(m.conflicts, key)
+	}
+
+	m.logger.Info("hostname owner is gone, promoting waiting container",
+		zap.String("hostname", hostname),
+		zap.String("provider", providerName),
+		zap.String("container", winner.SourceID))
+	for _, set := range GroupRecordSets(requests) {
+		if err := m.writeRecordSet(ctx, set, m.policy.AllowsUpdate()); err != nil {
+			m.logger.Warn("could not write records of promoted container",
+				zap.String("hostname", hostname),
+				zap.String("provider", providerName),
+				zap.String("container", winner.SourceID),
+				zap.Error(err))
+		}
+	}
+}
+
+// conflictOutranks orders challengers like requests: higher priority, then
+// the earlier request, then the container ID.
+func conflictOutranks(c, current *Conflict) bool {
+	switch {
+	case c.Priority != current.Priority:
+		return c.Priority > current.Priority
+	case !c.requestedAt.Equal(current.requestedAt):
+		return c.requestedAt.Before(current.requestedAt)
+	default:
+		return c.SourceID < current.SourceID
+	}
+}
+
+// trackedValues returns the tracked types and values of a hostname (caller must hold lock).
+func (m *Manager) trackedValues(hostname, providerName string) map[string]bool {
+	values := make(map[string]bool)
+	for _, record := range m.records {
+		if record.Hostname == hostname && record.ProviderName == providerName {
+			values[string(record.RecordType)+" "+record.Value] = true
+		}
+	}
+	return values
+}
+
+// trackedOwner returns the claim of the container whose records are tracked
+// for a hostname. Should records of several containers be tracked, the one
+// with the lowest ID owns it (caller must hold lock).
+func (m *Manager) trackedOwner(hostname, providerName string) (*hostnameClaim, bool) {
+	var owner *DNSRecord
+	for _, record := range m.records {
+		if record.Hostname != hostname || record.ProviderName != providerName {
+			continue
+		}
+		if owner == nil || record.SourceID < owner.SourceID {
+			owner = record
+		}
+	}
+	if owner == nil {
+		return nil, false
+	}
+	return &hostnameClaim{sourceID: owner.SourceID, priority: owner.Priority, order: -1, tracked: true}, true
+}
+
+// reassignHostname tracks every record of a hostname for the container that
+// took it over (caller must hold lock).
+func (m *Manager) reassignHostname(hostname, providerName, sourceID string) {
+	for _, record := range m.records {
+		if record.Hostname == hostname && record.ProviderName == providerName && record.SourceID != sourceID {
+			record.SourceID = sourceID
+			m.dirty = true
+		}
+	}
+}
+
+// claimOutranks reports whether a challenger takes a hostname from the
+// current winner: a higher priority always does, and on a tie the tracked
+// owner, then the earlier request, keeps it.
+func claimOutranks(c, winner *hostnameClaim) bool {
+	switch {
+	case c.priority != winner.priority:
+		return c.priority > winner.priority
+	case winner.tracked || c.tracked:
+		return c.tracked
+	case !c.requestedAt.Equal(winner.requestedAt):
+		return c.requestedAt.Before(winner.requestedAt)
+	default:
+		return c.order < winner.order
+	}
+}
+
+// outranks is claimOutranks for two requests without a tracked owner.
+func outranks(req, current SyncRequest) bool {
+	if req.Priority != current.Priority {
+		return req.Priority > current.Priority
+	}
+	return req.RequestedAt.Before(current.RequestedAt)
+}
+
+func conflictKey(req SyncRequest) string {
+	return req.SourceID + "|" + recordKey(req.Hostname, req.ProviderName, req.RecordType, req.Target)
+}
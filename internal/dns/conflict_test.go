@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func TestConflictFirstOwnerKeepsHostname(t *testing.T) {
+	manager, writes := newConflictManager()
+	ctx := context.Background()
+
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-1", "192.0.2.10", 0)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-2", "192.0.2.20", 0)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if *writes != 1 {
+		t.Fatalf("provider writes = %d, want 1", *writes)
+	}
+	records := manager.GetRecords()
+	if len(records) != 1 || records[0].SourceID != "web-1" {
+		t.Fatalf("records = %+v, want web-1's record", records)
+	}
+
+	conflicts := manager.GetConflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("conflicts = %+v, want one", conflicts)
+	}
+	conflict := conflicts[0]
+	if conflict.SourceID != "web-2" || conflict.OwnerID != "web-1" || conflict.State != RecordStateConflict || conflict.Value != "192.0.2.20" {
+		t.Fatalf("conflict = %+v, want web-2 rejected in favour of web-1", conflict)
+	}
+
+	// Asking again keeps the original detection time
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-2", "192.0.2.20", 0)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	again := manager.GetConflicts()
+	if len(again) != 1 || !again[0].DetectedAt.Equal(conflict.DetectedAt) {
+		t.Fatalf("conflicts = %+v, want the same conflict", again)
+	}
+}
+
+func TestConflictHigherPriorityTakesHostname(t *testing.T) {
+	manager, _ := newConflictManager()
+	ctx := context.Background()
+
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-1", "192.0.2.10", 0)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-2", "192.0.2.20", 10)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	records := manager.GetRecords()
+	if len(records) != 1 || records[0].SourceID != "web-2" || records[0].Value != "192.0.2.20" || records[0].Priority != 10 {
+		t.Fatalf("records = %+v, want web-2's record", records)
+	}
+	if conflicts := manager.GetConflicts(); len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v, want none", conflicts)
+	}
+
+	// The displaced container is rejected when it asks again
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-1", "192.0.2.10", 0)}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	conflicts := manager.GetConflicts()
+	if len(conflicts) != 1 || conflicts[0].SourceID != "web-1" || conflicts[0].OwnerID != "web-2" {
+		t.Fatalf("conflicts = %+v, want web-1 rejected", conflicts)
+	}
+
+	// Removing the container clears its conflicts
+	if err := manager.DeleteRecordsForContainer(ctx, "web-1"); err != nil {
+		t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+	}
+	if conflicts := manager.GetConflicts(); len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v, want none after removal", conflicts)
+	}
+}
+
+func TestConflictPriorityLabel(t *testing.T) {
+	now := time.Now()
+	containers := []ContainerInfo{
+		{ID: "web-1", IsRunning: true, IPV4: []string{"192.0.2.10"}, Labels: map[string]string{
+			"caddy_dns.hostname": "app.example.com",
+			"caddy_dns.provider": "cloudflare",
+		}},
+		{ID: "web-2", IsRunning: true, IPV4: []string{"192.0.2.20"}, Labels: map[string]string{
+			"caddy_dns.hostname": "app.example.com",
+			"caddy_dns.provider": "cloudflare",
+			"caddy_dns.priority": "5",
+		}},
+	}
+
+	manager, _ := newConflictManager()
+	requests, err := manager.ComputeDesiredState(containers, "caddy_dns")
+	if err != nil {
+		t.Fatalf("ComputeDesiredState failed: %v", err)
+	}
+	if len(requests) != 2 || requests[1].Priority != 5 {
+		t.Fatalf("requests = %+v, want web-2 at priority 5", requests)
+	}
+	for i := range requests {
+		requests[i].RequestedAt = now
+	}
+
+	kept := manager.ResolveConflicts(requests)
+	if len(kept) != 1 || kept[0].SourceID != "web-2" {
+		t.Fatalf("kept = %+v, want web-2", kept)
+	}
+	if conflicts := manager.GetConflicts(); len(conflicts) != 1 || conflicts[0].SourceID != "web-1" {
+		t.Fatalf("conflicts = %+v, want web-1", conflicts)
+	}
+}
+
+func TestConflictChallengerTakesOverWhenOwnerIsDeleted(t *testing.T) {
+	manager, writes := newConflictManager()
+	ctx := context.Background()
+
+	for _, req := range []SyncRequest{
+		conflictRequest("web-1", "192.0.2.10", 0),
+		conflictRequest("web-2", "192.0.2.20", 0),
+		conflictRequest("web-3", "192.0.2.30", 0),
+	} {
+		if _, err := manager.Sync(ctx, []SyncRequest{req}); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+	}
+
+	if err := manager.DeleteRecordsForContainer(ctx, "web-1"); err != nil {
+		t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+	}
+
+	if *writes != 2 {
+		t.Fatalf("provider writes = %d, want 2", *writes)
+	}
+	records := manager.GetRecords()
+	if len(records) != 1 || records[0].SourceID != "web-2" || records[0].State != RecordStatePresent {
+		t.Fatalf("records = %+v, want web-2 promoted", records)
+	}
+	conflicts := manager.GetConflicts()
+	if len(conflicts) != 1 || conflicts[0].SourceID != "web-3" || conflicts[0].OwnerID != "web-2" {
+		t.Fatalf("conflicts = %+v, want web-3 waiting on web-2", conflicts)
+	}
+}
+
+func TestConflictRecreatedContainerTakesOverEveryRecord(t *testing.T) {
+	manager, writes := newConflictManager()
+	ctx := context.Background()
+
+	aaaa := conflictRequest("web-1", "2001:db8::10", 0)
+	aaaa.RecordType = RecordTypeAAAA
+	if _, err := manager.Sync(ctx, []SyncRequest{conflictRequest("web-1", "192.0.2.10", 0), aaaa}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	aaaa.SourceID = "web-2"
+	kept := manager.ResolveConflicts([]SyncRequest{conflictRequest("web-2", "192.0.2.10", 0), aaaa})
+	if len(kept) != 2 {
+		t.Fatalf("kept = %+v, want both requests of web-2", kept)
+	}
+	for _, record := range manager.GetRecords() {
+		if record.SourceID != "web-2" {
+			t.Fatalf("record %+v still tracked for %q, want web-2", record, record.SourceID)
+		}
+	}
+
+	if err := manager.DeleteRecordsForContainer(ctx, "web-1"); err != nil {
+		t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+	}
+	if records := manager.GetRecords(); len(records) != 2 || *writes != 2 {
+		t.Fatalf("records = %+v after %d writes, want both records kept", records, *writes)
+	}
+}
+
+func TestConflictTrackedOwnerIsDeterministic(t *testing.T) {
+	manager, _ := newConflictManager()
+	manager.trackRecord(conflictRequest("web-2", "192.0.2.20", 0), "", RecordStatePresent)
+	manager.trackRecord(conflictRequest("web-1", "192.0.2.10", 0), "", RecordStatePresent)
+
+	for i := 0; i < 20; i++ {
+		manager.ResolveConflicts([]SyncRequest{conflictRequest("web-3", "192.0.2.30", 0)})
+		if conflicts := manager.GetConflicts(); len(conflicts) != 1 || conflicts[0].OwnerID != "web-1" {
+			t.Fatalf("conflicts = %+v, want web-3 waiting on web-1", conflicts)
+		}
+	}
+}
+
+func TestConflictsHandler(t *testing.T) {
+	manager, _ := newConflictManager()
+	manager.ResolveConflicts([]SyncRequest{
+		conflictRequest("web-1", "192.0.2.10", 0),
+		conflictRequest("web-2", "192.0.2.20", 0),
+	})
+
+	w := httptest.NewRecorder()
+	ConflictsHandler(manager).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/conflicts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var conflicts []map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&conflicts); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0]["source_id"] != "web-2" || conflicts[0]["owner_id"] != "web-1" || conflicts[0]["state"] != "conflict" {
+		t.Fatalf("conflicts = %v, want web-2 owned by web-1", conflicts)
+	}
+
+	w = httptest.NewRecorder()
+	ConflictsHandler(manager).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/conflicts", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func newConflictManager() (*Manager, *int) {
+	writes := 0
+	adapter := &mockAdapter{
+		appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			writes++
+			return records, nil
+		},
+		setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			writes++
+			return records, nil
+		},
+	}
+	provider := &mockProvider{name: "cloudflare", zoneFilters: []string{"example.com"}, adapter: adapter}
+	return NewManager([]providers.Provider{provider}), &writes
+}
+
+func conflictRequest(sourceID, target string, priority int) SyncRequest {
+	return SyncRequest{
+		Hostname:     "app.example.com",
+		ProviderName: "cloudflare",
+		RecordType:   RecordTypeA,
+		Target:       target,
+		SourceID:     sourceID,
+		RequestedAt:  time.Now(),
+		Priority:     priority,
+	}
+}
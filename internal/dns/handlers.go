@@ -6,6 +6,8 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
 )
 
 var (
@@ -34,6 +36,22 @@ var (
 		[]string{"provider", "operation"},
 	)
 
+	dnsConflicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_conflicts_total",
+			Help: "Total number of hostname requests rejected because another container owns the hostname",
+		},
+		[]string{"provider"},
+	)
+
+	dnsProviderAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_provider_attempts_total",
+			Help: "Total number of provider API calls, including retries",
+		},
+		[]string{"provider", "operation", "result"},
+	)
+
 	dnsRecordsTracked = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "caddy_dns_records_tracked",
@@ -48,6 +66,8 @@ func init() {
 	prometheus.MustRegister(dnsRecordsCreated)
 	prometheus.MustRegister(dnsRecordsDeleted)
 	prometheus.MustRegister(dnsRecordErrors)
+	prometheus.MustRegister(dnsConflicts)
+	prometheus.MustRegister(dnsProviderAttempts)
 	prometheus.MustRegister(dnsRecordsTracked)
 }
 
@@ -76,6 +96,21 @@ func HealthHandler() http.Handler {
 	})
 }
 
+// ConflictsHandler returns an HTTP handler for the conflict list endpoint
+// GET /conflicts - Returns 200 OK with the manager's current conflicts
+func ConflictsHandler(m *Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(m.GetConflicts())
+	})
+}
+
 // MetricsHandler returns an HTTP handler for the Prometheus metrics endpoint
 // GET /metrics - Returns 200 OK with Prometheus-formatted metrics
 func MetricsHandler() http.Handler {
@@ -96,6 +131,12 @@ func (m *Manager) UpdateMetrics() {
 		}
 		providerStateCounts[record.ProviderName][record.State]++
 	}
+	for _, conflict := range m.conflicts {
+		if _, ok := providerStateCounts[conflict.ProviderName]; !ok {
+			providerStateCounts[conflict.ProviderName] = make(map[RecordState]int)
+		}
+		providerStateCounts[conflict.ProviderName][RecordStateConflict]++
+	}
 
 	// Update gauge metrics
 	for providerName, stateCounts := range providerStateCounts {
@@ -104,10 +145,11 @@ func (m *Manager) UpdateMetrics() {
 		}
 	}
 
-	// Reset gauges for providers with no records
+	// Reset gauges for states a provider no longer has records in, so that
+	// resolved conflicts and errors drop back to zero
 	for providerName := range m.providers {
-		if _, ok := providerStateCounts[providerName]; !ok {
-			for _, state := range []RecordState{RecordStatePresent, RecordStatePending, RecordStateError} {
+		for _, state := range []RecordState{RecordStatePresent, RecordStatePending, RecordStateError, RecordStateConflict} {
+			if _, ok := providerStateCounts[providerName][state]; !ok {
 				dnsRecordsTracked.WithLabelValues(providerName, string(state)).Set(0)
 			}
 		}
@@ -124,7 +166,25 @@ func RecordMetricDeleted(providerName string) {
 	dnsRecordsDeleted.WithLabelValues(providerName).Inc()
 }
 
+// RecordMetricConflict increments the conflict counter for a provider
+func RecordMetricConflict(providerName string) {
+	dnsConflicts.WithLabelValues(providerName).Inc()
+}
+
 // RecordMetricError increments the error counter for a provider and operation
 func RecordMetricError(providerName, operation string) {
 	dnsRecordErrors.WithLabelValues(providerName, operation).Inc()
 }
+
+// RecordMetricAttempt counts one provider call. The result is "success",
+// "retry" when another attempt follows, or "error" when the call gave up
+func RecordMetricAttempt(attempt providers.Attempt) {
+	result := "success"
+	switch {
+	case attempt.Retry:
+		result = "retry"
+	case attempt.Err != nil:
+		result = "error"
+	}
+	dnsProviderAttempts.WithLabelValues(attempt.Provider, attempt.Operation, result).Inc()
+}
@@ -6,20 +6,17 @@ import (
 
 "github.com/cpritchett/caddy-dns-plugin/internal/dns"
 "github.com/cpritchett/caddy-dns-plugin/internal/providers"
-"github.com/libdns/libdns"
+"github.com/cpritchett/caddy-dns-plugin/internal/providers/memory"
 )
 
 // This is an example integration test demonstrating the full workflow
 // It shows how the DNS manager would be used in practice
 
 func TestIntegrationExample(t *testing.T) {
-// This test demonstrates the complete workflow but doesn't run by default
-// since it requires actual provider implementations
-t.Skip("Integration example - demonstrates usage pattern")
-
-// Step 1: Set up providers (would be real implementations in production)
-var providerList []providers.Provider
-// providerList = append(providerList, realCloudflareProvider)
+// Step 1: Set up providers (real implementations in production, an
+// in-memory provider here)
+cloudflare := memory.NewMemoryProvider("cloudflare", []string{"example.com"})
+providerList := []providers.Provider{cloudflare}
 
 // Step 2: Create DNS manager
 manager := dns.NewManager(providerList)
@@ -51,16 +48,23 @@ t.Fatal("Expected at least one sync request")
 
 // Step 5: Sync records (create/update)
 ctx := context.Background()
-err = manager.Sync(ctx, requests)
+_, err = manager.Sync(ctx, requests)
 if err != nil {
 t.Fatalf("Failed to sync records: %v", err)
 }
 
-// Step 6: Verify records were created
+// Step 6: Verify records were created, in the manager and at the provider
 records := manager.GetRecords()
 if len(records) == 0 {
 t.Fatal("Expected records to be created")
 }
+zone, err := cloudflare.Adapter().GetRecords(ctx, "example.com")
+if err != nil {
+t.Fatalf("Failed to read zone: %v", err)
+}
+if len(zone) != 1 || zone[0].RR().Name != "app" || zone[0].RR().Data != "192.168.1.100" {
+t.Fatalf("Expected app A 192.168.1.100 in the zone, got %v", zone)
+}
 
 // Step 7: Container stops - cleanup
 err = manager.DeleteRecordsForContainer(ctx, "web-app-123")
@@ -73,40 +77,11 @@ records = manager.GetRecords()
 if len(records) != 0 {
 t.Fatalf("Expected all records to be deleted, got %d", len(records))
 }
+zone, err = cloudflare.Adapter().GetRecords(ctx, "example.com")
+if err != nil {
+t.Fatalf("Failed to read zone: %v", err)
 }
-
-// Example of how to implement a simple mock provider for testing
-type exampleProvider struct {
-name    string
-filters []string
-}
-
-func (p *exampleProvider) Name() string {
-return p.name
-}
-
-func (p *exampleProvider) Type() string {
-return "example"
-}
-
-func (p *exampleProvider) ZoneFilters() []string {
-return p.filters
-}
-
-func (p *exampleProvider) Adapter() providers.Adapter {
-return &exampleAdapter{}
-}
-
-type exampleAdapter struct{}
-
-func (a *exampleAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-return records, nil
-}
-
-func (a *exampleAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-return records, nil
+if len(zone) != 0 {
+t.Fatalf("Expected an empty zone, got %v", zone)
 }
-
-func (a *exampleAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-return records, nil
 }
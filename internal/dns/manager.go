@@ -2,15 +2,19 @@ package dns
 
 import (
 "context"
+"errors"
 "fmt"
 "net"
 "net/netip"
+"sort"
 "strings"
 "sync"
 "time"
+"unicode"
 
 "github.com/cpritchett/caddy-dns-plugin/internal/providers"
 "github.com/libdns/libdns"
+"go.uber.org/zap"
 )
 
 // RecordType represents the type of DNS record
@@ -26,23 +30,25 @@ RecordTypeCNAME RecordType = "CNAME"
 type RecordState string
 
 const (
-RecordStatePresent RecordState = "present"
-RecordStatePending RecordState = "pending"
-RecordStateError   RecordState = "error"
+RecordStatePresent  RecordState = "present"
+RecordStatePending  RecordState = "pending"
+RecordStateError    RecordState = "error"
+RecordStateConflict RecordState = "conflict"
 )
 
 // DNSRecord represents a DNS record managed by the system
 type DNSRecord struct {
-ID           string
-Hostname     string
-RecordType   RecordType
-Value        string
-TTL          int
-Proxied      bool
-ProviderName string
-LastSyncAt   time.Time
-State        RecordState
-SourceID     string // Container ID
+ID           string      `json:"id,omitempty"`
+Hostname     string      `json:"hostname"`
+RecordType   RecordType  `json:"record_type"`
+Value        string      `json:"value"`
+TTL          int         `json:"ttl"`
+Proxied      bool        `json:"proxied,omitempty"`
+ProviderName string      `json:"provider"`
+Priority     int         `json:"priority,omitempty"`
+LastSyncAt   time.Time   `json:"last_sync_at"`
+State        RecordState `json:"state"`
+SourceID     string      `json:"source_id"` // Container ID
 }
 
 // SyncRequest represents a request to sync DNS records for a container
@@ -56,6 +62,7 @@ Labels        map[string]string
 RequestedAt   time.Time
 TTL           *int
 Proxied       *bool
+Priority      int // higher wins a hostname another container owns
 }
 
 // ContainerInfo represents container information needed for DNS sync
@@ -72,26 +79,116 @@ IsRunning  bool
 // Manager orchestrates DNS record creation and deletion
 type Manager struct {
 providers map[string]providers.Provider
-records   map[string]*DNSRecord // key: hostname:provider
-mu        sync.RWMutex
+records   map[string]*DNSRecord // key: hostname:provider:type:value
+store     StateStore
+logger    *zap.Logger
+ownerID   string // enables the TXT ownership registry when set
+targets   map[string]TargetResolver // key: provider name
+lastTargets map[string][]netip.Addr // last addresses each resolver returned
+targetMu  sync.Mutex // guards lastTargets
+conflicts map[string]*Conflict // key: source ID and record key
+policy    Policy
+retries   map[string]*retryState // key: RRset key of records in the error state
+retryBase time.Duration
+retryMax  time.Duration
+dirty     bool // records changed since the last save
+writeMu   sync.Mutex   // serialises changes; held across provider calls
+mu        sync.RWMutex // guards the maps; released during provider calls
+}
+
+// ManagerOption configures optional Manager behaviour
+type ManagerOption func(*Manager)
+
+// WithStateStore persists tracked records to store and restores them when the manager is created
+func WithStateStore(store StateStore) ManagerOption {
+return func(m *Manager) {
+m.store = store
+}
+}
+
+// WithLogger sets the logger used for state persistence problems
+func WithLogger(logger *zap.Logger) ManagerOption {
+return func(m *Manager) {
+if logger != nil {
+m.logger = logger
+}
+}
 }
 
 // NewManager creates a new DNS manager
-func NewManager(providerList []providers.Provider) *Manager {
+func NewManager(providerList []providers.Provider, opts ...ManagerOption) *Manager {
 providerMap := make(map[string]providers.Provider)
 for _, p := range providerList {
 providerMap[p.Name()] = p
 }
 
-return &Manager{
+m := &Manager{
 providers: providerMap,
 records:   make(map[string]*DNSRecord),
+conflicts: make(map[string]*Conflict),
+policy:    PolicySync,
+retries:   make(map[string]*retryState),
+retryBase: defaultRetryBaseDelay,
+retryMax:  defaultRetryMaxDelay,
+logger:    zap.NewNop(),
+}
+for _, opt := range opts {
+opt(m)
+}
+m.loadState()
+
+return m
+}
+
+// loadState restores records from the state store. Records for providers
+// that are no longer configured are dropped because they cannot be managed.
+func (m *Manager) loadState() {
+if m.store == nil {
+return
 }
+
+records, err := m.store.Load()
+if err != nil {
+m.logger.Warn("could not load dns state, starting empty", zap.Error(err))
+return
 }
 
-// ComputeDesiredState computes the desired DNS records from container information
+for _, record := range records {
+if _, ok := m.providers[record.ProviderName]; !ok {
+m.logger.Info("dropping stored record for unknown provider",
+zap.String("hostname", record.Hostname),
+zap.String("provider", record.ProviderName),
+)
+continue
+}
+record := record
+m.records[recordKey(record.Hostname, record.ProviderName, record.RecordType, record.Value)] = &record
+}
+}
+
+// saveState writes the tracked records to the state store if they changed (caller must hold lock)
+func (m *Manager) saveState() {
+if m.store == nil || !m.dirty {
+return
+}
+
+records := make([]DNSRecord, 0, len(m.records))
+for _, record := range m.records {
+records = append(records, *record)
+}
+if err := m.store.Save(records); err != nil {
+m.logger.Error("could not save dns state", zap.Error(err))
+return
+}
+m.dirty = false
+}
+
+// ComputeDesiredState computes the desired DNS records from container
+// information. It fails when a target resolver cannot supply addresses, as
+// the containers' records would otherwise look unwanted and be pruned.
 func (m *Manager) ComputeDesiredState(containers []ContainerInfo, labelPrefix string) ([]SyncRequest, error) {
 var requests []SyncRequest
+var errs []error
 
 for _, container := range containers {
 if !container.IsRunning {
@@ -123,19 +220,12 @@ continue
 }
 }
 
-// Determine target IPs
-var targets []string
-var recordType RecordType
-
-// Prefer IPv4
-if len(container.IPV4) > 0 {
-targets = container.IPV4
-recordType = RecordTypeA
-} else if len(container.IPV6) > 0 {
-targets = container.IPV6
-recordType = RecordTypeAAAA
+// Determine record types and values
+targets, err := m.resolveTargets(container, hostname, providerName, labelPrefix)
+if err != nil {
+errs = append(errs, fmt.Errorf("container %s: %w", container.ID, err))
+continue
 }
-
 if len(targets) == 0 {
 continue
 }
@@ -156,64 +246,311 @@ proxied = &parsed
 }
 }
 
-// Create sync request for first target IP
-// Multiple IPs would need multiple records, but we'll use first for simplicity
+// Parse optional ownership priority
+priority := 0
+if priorityStr, ok := container.Labels[labelPrefix+".priority"]; ok {
+if parsed, err := parseInt(priorityStr); err == nil {
+priority = parsed
+}
+}
+
+// Create one sync request per value; Sync groups them into RRsets
+requestedAt := time.Now()
+for _, target := range targets {
 requests = append(requests, SyncRequest{
 Hostname:     hostname,
 ProviderName: providerName,
-RecordType:   recordType,
-Target:       targets[0],
+RecordType:   target.recordType,
+Target:       target.value,
 SourceID:     container.ID,
 Labels:       container.Labels,
-RequestedAt:  time.Now(),
+RequestedAt:  requestedAt,
 TTL:          ttl,
 Proxied:      proxied,
+Priority:     priority,
 })
 }
+}
+
+return requests, errors.Join(errs...)
+}
 
-return requests, nil
+// Sync processes sync requests and creates/updates DNS records. The requests
+// are the complete desired state of the containers they name, so tracked
+// RRsets those containers no longer ask for are deleted. Callers must pass
+// every request of each container at once: syncing a container one hostname
+// or provider at a time deletes its other records under PolicySync. Every
+// RRset is attempted even when others fail; the result reports each one and
+// the error joins the failures.
+func (m *Manager) Sync(ctx context.Context, requests []SyncRequest) (SyncResult, error) {
+seen := make(map[string]bool)
+var containerIDs []string
+for _, req := range requests {
+if !seen[req.SourceID] {
+seen[req.SourceID] = true
+containerIDs = append(containerIDs, req.SourceID)
+}
+}
+return m.SyncContainers(ctx, containerIDs, requests)
 }
 
-// Sync processes sync requests and creates/updates DNS records
-func (m *Manager) Sync(ctx context.Context, requests []SyncRequest) error {
+// SyncContainers is Sync for the listed containers, whose complete desired
+// state is requests. As with Sync, requests must hold every record of each
+// listed container, since anything missing is pruned. A listed container
+// without requests has all of its records deleted, as when its labels are
+// removed.
+func (m *Manager) SyncContainers(ctx context.Context, containerIDs []string, requests []SyncRequest) (SyncResult, error) {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
 m.mu.Lock()
 defer m.mu.Unlock()
+defer m.saveState()
 
-// Build map of desired records
-desired := make(map[string]SyncRequest)
-for _, req := range requests {
-key := recordKey(req.Hostname, req.ProviderName)
-// If duplicate, keep the one with most recent timestamp
-if existing, ok := desired[key]; ok {
-if req.RequestedAt.After(existing.RequestedAt) {
-desired[key] = req
+var result SyncResult
+desired := m.writeRecordSets(ctx, requests, &result)
+
+// Delete the RRsets the containers no longer ask for
+inScope := make(map[string]bool, len(containerIDs))
+for _, id := range containerIDs {
+inScope[id] = true
 }
-} else {
-desired[key] = req
+stale := m.trackedSets(func(record *DNSRecord) bool {
+return inScope[record.SourceID] && !desired[rrsetKey(record.Hostname, record.ProviderName, record.RecordType)]
+})
+for _, set := range stale {
+first := set[0]
+entry := newSyncEntry(first.Hostname, first.ProviderName, first.RecordType)
+outcome := SyncOutcomeDeleted
+if !m.policy.AllowsDelete() {
+outcome = SyncOutcomeSkipped
+}
+err := m.deleteRecordSet(ctx, set)
+m.finishSyncEntry(&result, entry, outcome, err)
+}
+
+return result, result.Err()
+}
+
+// SyncRecordSets creates or updates the RRsets of requests like Sync but
+// deletes nothing, so requests may hold part of a container's records. Use
+// it to retry the requests SyncResult.Failed returns; passing those to Sync
+// would delete the container's RRsets that did not fail.
+func (m *Manager) SyncRecordSets(ctx context.Context, requests []SyncRequest) (SyncResult, error) {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
+m.mu.Lock()
+defer m.mu.Unlock()
+defer m.saveState()
+
+var result SyncResult
+m.writeRecordSets(ctx, requests, &result)
+return result, result.Err()
+}
+
+// writeRecordSets creates new RRsets and replaces the ones already tracked,
+// leaving out hostnames another container owns, and adds their outcomes to
+// result. It returns the keys of the RRsets requests ask for (caller must
+// hold writeMu and mu)
+func (m *Manager) writeRecordSets(ctx context.Context, requests []SyncRequest, result *SyncResult) map[string]bool {
+desired := make(map[string]bool)
+for _, set := range GroupRecordSets(m.resolveConflicts(requests)) {
+first := set[0]
+entry := newSyncEntry(first.Hostname, first.ProviderName, first.RecordType)
+entry.Requests = set
+desired[entry.Key] = true
+
+outcome, err := m.createOrUpdateRecordSet(ctx, set)
+m.finishSyncEntry(result, entry, outcome, err)
+}
+return desired
+}
+
+func newSyncEntry(hostname, providerName string, recordType RecordType) SyncEntry {
+return SyncEntry{
+Key:          rrsetKey(hostname, providerName, recordType),
+Hostname:     hostname,
+ProviderName: providerName,
+RecordType:   recordType,
 }
 }
 
-// Create or update records
-for key, req := range desired {
-if err := m.createOrUpdateRecord(ctx, req); err != nil {
+// finishSyncEntry records the outcome of one RRset in result
+func (m *Manager) finishSyncEntry(result *SyncResult, entry SyncEntry, outcome SyncOutcome, err error) {
+if err != nil {
 // Log error but continue with other records
-return fmt.Errorf("create/update record %s: %w", key, err)
+entry.Outcome = SyncOutcomeFailed
+if outcome == SyncOutcomeDeleted {
+entry.Err = fmt.Errorf("delete record %s: %w", entry.Key, err)
+} else {
+entry.Err = fmt.Errorf("create/update record %s: %w", entry.Key, err)
 }
+m.logger.Warn("could not sync record",
+zap.String("hostname", entry.Hostname),
+zap.String("provider", entry.ProviderName),
+zap.String("type", string(entry.RecordType)),
+zap.Error(err))
+} else {
+entry.Outcome = outcome
+}
+result.Entries = append(result.Entries, entry)
 }
 
-return nil
+// GroupRecordSets groups requests into RRsets, one per hostname, provider and
+// record type. When several containers ask for the same hostname, only the
+// values of the container with the highest priority are kept, and of those
+// the one that asked first. Sets are ordered by hostname, provider and type.
+func GroupRecordSets(requests []SyncRequest) [][]SyncRequest {
+// Pick the container that owns each hostname
+owners := make(map[string]SyncRequest)
+for _, req := range requests {
+key := req.Hostname + ":" + req.ProviderName
+if existing, ok := owners[key]; ok && !outranks(req, existing) {
+continue
+}
+owners[key] = req
+}
+
+// Collect the owner's values per RRset, dropping duplicates
+sets := make(map[string][]SyncRequest)
+seen := make(map[string]bool)
+for _, req := range requests {
+if owners[req.Hostname+":"+req.ProviderName].SourceID != req.SourceID {
+continue
+}
+valueKey := recordKey(req.Hostname, req.ProviderName, req.RecordType, req.Target)
+if seen[valueKey] {
+continue
+}
+seen[valueKey] = true
+key := rrsetKey(req.Hostname, req.ProviderName, req.RecordType)
+sets[key] = append(sets[key], req)
+}
+
+keys := make([]string, 0, len(sets))
+for key := range sets {
+keys = append(keys, key)
 }
+sort.Strings(keys)
 
-// CreateRecord creates a new DNS record
+grouped := make([][]SyncRequest, 0, len(keys))
+for _, key := range keys {
+grouped = append(grouped, sets[key])
+}
+return grouped
+}
+
+// CreateRecord appends a DNS record to the provider, even when it is already tracked
 func (m *Manager) CreateRecord(ctx context.Context, req SyncRequest) error {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
+m.mu.Lock()
+defer m.mu.Unlock()
+defer m.saveState()
+
+return m.writeRecordSet(ctx, []SyncRequest{req}, false)
+}
+
+// UpdateRecord replaces the provider's records for the hostname with the requested target
+func (m *Manager) UpdateRecord(ctx context.Context, req SyncRequest) error {
+return m.UpdateRecordSet(ctx, []SyncRequest{req})
+}
+
+// UpdateRecordSet replaces the provider's RRset for the requests' hostname and
+// record type with all of their targets in one SetRecords call. All requests
+// must share a hostname, provider and record type. It does nothing when the
+// policy does not allow updates.
+func (m *Manager) UpdateRecordSet(ctx context.Context, reqs []SyncRequest) error {
+if len(reqs) == 0 || !m.policy.AllowsUpdate() {
+return nil
+}
+
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
 m.mu.Lock()
 defer m.mu.Unlock()
+defer m.saveState()
 
-return m.createOrUpdateRecord(ctx, req)
+return m.writeRecordSet(ctx, reqs, true)
 }
 
-// createOrUpdateRecord creates or updates a DNS record (caller must hold lock)
-func (m *Manager) createOrUpdateRecord(ctx context.Context, req SyncRequest) error {
+// AdoptRecord starts tracking a record that already exists at the provider without calling it
+func (m *Manager) AdoptRecord(req SyncRequest) {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
+m.mu.Lock()
+defer m.mu.Unlock()
+defer m.saveState()
+
+m.trackRecord(req, "", RecordStatePresent)
+}
+
+// Provider returns the configured provider with the given name
+func (m *Manager) Provider(name string) (providers.Provider, bool) {
+provider, ok := m.providers[name]
+return provider, ok
+}
+
+// ZoneForHostname returns the zone a hostname belongs to for a provider, or "" if none matches
+func (m *Manager) ZoneForHostname(hostname, providerName string) string {
+provider, ok := m.providers[providerName]
+if !ok {
+return ""
+}
+return extractZone(hostname, provider.ZoneFilters())
+}
+
+// createOrUpdateRecordSet compares an RRset with its tracked records. A new
+// RRset is appended, one whose values, TTL or proxied flag changed is
+// replaced, and an unchanged one makes no provider call (caller must hold lock)
+func (m *Manager) createOrUpdateRecordSet(ctx context.Context, reqs []SyncRequest) (SyncOutcome, error) {
+req := reqs[0]
+tracked := m.trackedSet(req.Hostname, req.ProviderName, req.RecordType)
+if len(tracked) == 0 {
+return SyncOutcomeCreated, m.writeRecordSet(ctx, reqs, false)
+}
+if !m.recordSetUnchanged(reqs, tracked) {
+if !m.policy.AllowsUpdate() {
+return SyncOutcomeSkipped, nil
+}
+return SyncOutcomeUpdated, m.writeRecordSet(ctx, reqs, true)
+}
+
+// Nothing to send; follow a recreated container that kept the addresses
+for _, r := range reqs {
+record := m.records[recordKey(r.Hostname, r.ProviderName, r.RecordType, r.Target)]
+if record.SourceID != r.SourceID {
+record.SourceID = r.SourceID
+m.dirty = true
+}
+}
+return SyncOutcomeUnchanged, nil
+}
+
+// recordSetUnchanged reports whether the tracked keys of an RRset hold
+// exactly the requested values, present at the provider with the requested
+// TTL and proxied flag (caller must hold lock)
+func (m *Manager) recordSetUnchanged(reqs []SyncRequest, tracked []string) bool {
+if len(tracked) != len(reqs) {
+return false
+}
+for _, r := range reqs {
+record, ok := m.records[recordKey(r.Hostname, r.ProviderName, r.RecordType, r.Target)]
+if !ok || record.State != RecordStatePresent {
+return false
+}
+if record.TTL != requestTTL(r) || record.Proxied != requestProxied(r) {
+return false
+}
+}
+return true
+}
+
+// writeRecordSet sends the records of one RRset to the provider, appending
+// them or replacing the existing RRset, and tracks the outcome. All requests
+// must share a hostname, provider and record type (caller must hold writeMu
+// and mu)
+func (m *Manager) writeRecordSet(ctx context.Context, reqs []SyncRequest, replace bool) error {
+req := reqs[0]
 provider, ok := m.providers[req.ProviderName]
 if !ok {
 return fmt.Errorf("provider %q not found", req.ProviderName)
@@ -230,196 +567,324 @@ if zone == "" {
 return fmt.Errorf("could not determine zone for hostname %q", req.Hostname)
 }
 
-// Build libdns record
-ttl := 300 // default TTL
-if req.TTL != nil {
-ttl = *req.TTL
+// Refuse to touch records another owner (or a person) created
+adapter := provider.Adapter()
+if err := m.verifyOwnership(ctx, provider, zone, req.Hostname, true); err != nil {
+return err
 }
 
-// Parse IP address
-ipAddr, err := netip.ParseAddr(req.Target)
+// Build libdns records
+records := make([]libdns.Record, 0, len(reqs))
+for _, r := range reqs {
+record, err := buildRecord(r.Hostname, zone, r.RecordType, r.Target, time.Duration(requestTTL(r))*time.Second)
 if err != nil {
-return fmt.Errorf("invalid IP address %q: %w", req.Target, err)
+return err
 }
-
-record := libdns.Address{
-Name: strings.TrimSuffix(req.Hostname, "."+zone),
-IP:   ipAddr,
-TTL:  time.Duration(ttl) * time.Second,
+records = append(records, record)
 }
 
-// Use the provider adapter to create/append the record
-adapter := provider.Adapter()
-records := []libdns.Record{record}
-
-created, err := adapter.AppendRecords(ctx, zone, records)
+// Use the provider adapter to create/append or replace the RRset
+var written []libdns.Record
+err := m.callProvider(func() (err error) {
+if replace {
+written, err = adapter.SetRecords(ctx, zone, records)
+} else {
+written, err = adapter.AppendRecords(ctx, zone, records)
+}
+return err
+})
 if err != nil {
 // Mark as error state
-dnsRecord := &DNSRecord{
-Hostname:     req.Hostname,
-RecordType:   req.RecordType,
-Value:        req.Target,
-TTL:          ttl,
-ProviderName: req.ProviderName,
-LastSyncAt:   time.Now(),
-State:        RecordStateError,
-SourceID:     req.SourceID,
+for _, r := range reqs {
+m.trackRecord(r, "", RecordStateError)
 }
-if req.Proxied != nil {
-dnsRecord.Proxied = *req.Proxied
+m.scheduleRetry(rrsetKey(req.Hostname, req.ProviderName, req.RecordType), err)
+if replace {
+return fmt.Errorf("set record: %w", err)
 }
-key := recordKey(req.Hostname, req.ProviderName)
-m.records[key] = dnsRecord
 return fmt.Errorf("append record: %w", err)
 }
 
-// Store the created record
-if len(created) > 0 {
-// Extract record info
+// Mark the records as ours
+if err := m.writeOwnership(ctx, provider, zone, req.Hostname, req.SourceID, requestTTL(req), m.writtenValues(reqs, replace)); err != nil {
+for _, r := range reqs {
+m.trackRecord(r, "", RecordStateError)
+}
+m.scheduleRetry(rrsetKey(req.Hostname, req.ProviderName, req.RecordType), err)
+return err
+}
+
+// The provider replaced the whole RRset, so forget values that left it
+if replace {
+kept := make(map[string]bool, len(reqs))
+for _, r := range reqs {
+kept[recordKey(r.Hostname, r.ProviderName, r.RecordType, r.Target)] = true
+}
+for _, key := range m.trackedSet(req.Hostname, req.ProviderName, req.RecordType) {
+if !kept[key] {
+delete(m.records, key)
+m.dirty = true
+}
+}
+}
+
+// Store the written records
+if len(written) > 0 {
+for i, r := range reqs {
 recordID := ""
-if addr, ok := created[0].(libdns.Address); ok && addr.ProviderData != nil {
-// Try to extract ID from provider data if available
-if idMap, ok := addr.ProviderData.(map[string]interface{}); ok {
-if id, ok := idMap["id"].(string); ok {
-recordID = id
+if i < len(written) {
+recordID = providerRecordID(written[i])
+}
+m.trackRecord(r, recordID, RecordStatePresent)
+}
+}
+
+return nil
+}
+
+// trackedSet returns the keys of the tracked values of one RRset (caller must hold lock)
+func (m *Manager) trackedSet(hostname, providerName string, recordType RecordType) []string {
+var keys []string
+for key, record := range m.records {
+if record.Hostname == hostname && record.ProviderName == providerName && record.RecordType == recordType {
+keys = append(keys, key)
 }
 }
+sort.Strings(keys)
+return keys
 }
 
+// trackRecord stores the tracked state for a request (caller must hold lock)
+func (m *Manager) trackRecord(req SyncRequest, recordID string, state RecordState) {
 dnsRecord := &DNSRecord{
 ID:           recordID,
 Hostname:     req.Hostname,
 RecordType:   req.RecordType,
 Value:        req.Target,
-TTL:          ttl,
+TTL:          requestTTL(req),
+Proxied:      requestProxied(req),
 ProviderName: req.ProviderName,
 LastSyncAt:   time.Now(),
-State:        RecordStatePresent,
+State:        state,
 SourceID:     req.SourceID,
+Priority:     req.Priority,
 }
-if req.Proxied != nil {
-dnsRecord.Proxied = *req.Proxied
-}
-key := recordKey(req.Hostname, req.ProviderName)
+key := recordKey(req.Hostname, req.ProviderName, req.RecordType, req.Target)
 m.records[key] = dnsRecord
+m.dirty = true
 }
 
-return nil
+// callProvider runs call, which talks to a provider, without holding mu so
+// readers are not held up while the provider answers or backs off. The
+// caller keeps writeMu, so nothing else changes the tracked state meanwhile
+// (caller must hold writeMu and mu)
+func (m *Manager) callProvider(call func() error) error {
+m.mu.Unlock()
+defer m.mu.Lock()
+return call()
 }
 
-// DeleteRecord deletes a DNS record for a container
+// DeleteRecord deletes the DNS records of every type for a hostname owned by a container
 func (m *Manager) DeleteRecord(ctx context.Context, hostname, providerName, containerID string) error {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
 m.mu.Lock()
 defer m.mu.Unlock()
+defer m.saveState()
 
-key := recordKey(hostname, providerName)
-record, ok := m.records[key]
-if !ok {
+return m.deleteOwnedRecords(ctx, containerID, func(record *DNSRecord) bool {
+return record.Hostname == hostname && record.ProviderName == providerName
+})
+}
+
+// DeleteRecordSet deletes one RRset for a hostname owned by a container,
+// leaving the hostname's records of other types in place
+func (m *Manager) DeleteRecordSet(ctx context.Context, hostname, providerName string, recordType RecordType, containerID string) error {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
+m.mu.Lock()
+defer m.mu.Unlock()
+defer m.saveState()
+
+return m.deleteOwnedRecords(ctx, containerID, func(record *DNSRecord) bool {
+return record.Hostname == hostname && record.ProviderName == providerName && record.RecordType == recordType
+})
+}
+
+// deleteOwnedRecords deletes the tracked records match selects after checking
+// they all belong to the container (caller must hold lock)
+func (m *Manager) deleteOwnedRecords(ctx context.Context, containerID string, match func(*DNSRecord) bool) error {
+sets := m.trackedSets(match)
+if len(sets) == 0 {
 // Record not found, nothing to delete
 return nil
 }
 
-// Verify the record belongs to this container
+// Verify the records belong to this container
+for _, set := range sets {
+for _, record := range set {
 if record.SourceID != containerID {
 return fmt.Errorf("record does not belong to container %q", containerID)
 }
-
-provider, ok := m.providers[providerName]
-if !ok {
-return fmt.Errorf("provider %q not found", providerName)
 }
-
-// Extract zone from hostname
-zone := extractZone(hostname, provider.ZoneFilters())
-if zone == "" {
-return fmt.Errorf("could not determine zone for hostname %q", hostname)
 }
 
-// Parse IP address for deletion
-ipAddr, err := netip.ParseAddr(record.Value)
-if err != nil {
-return fmt.Errorf("invalid IP address %q: %w", record.Value, err)
+var errs []error
+for _, set := range sets {
+if err := m.deleteRecordSet(ctx, set); err != nil {
+errs = append(errs, fmt.Errorf("delete record: %w", err))
 }
-
-// Build libdns record for deletion
-libdnsRecord := libdns.Address{
-Name: strings.TrimSuffix(hostname, "."+zone),
-IP:   ipAddr,
 }
-
-// Use the provider adapter to delete the record
-adapter := provider.Adapter()
-records := []libdns.Record{libdnsRecord}
-
-_, err = adapter.DeleteRecords(ctx, zone, records)
-if err != nil {
-return fmt.Errorf("delete record: %w", err)
-}
-
-// Remove from tracking
-delete(m.records, key)
-
-return nil
+return errors.Join(errs...)
 }
 
 // DeleteRecordsForContainer deletes all DNS records associated with a container
 func (m *Manager) DeleteRecordsForContainer(ctx context.Context, containerID string) error {
+m.writeMu.Lock()
+defer m.writeMu.Unlock()
 m.mu.Lock()
 defer m.mu.Unlock()
+defer m.saveState()
 
 var errs []error
 
+// The container no longer competes for any hostname
+m.clearConflicts(containerID)
+
 // Find all records for this container
-for key, record := range m.records {
-if record.SourceID != containerID {
-continue
+sets := m.trackedSets(func(record *DNSRecord) bool {
+return record.SourceID == containerID
+})
+for _, set := range sets {
+if err := m.deleteRecordSet(ctx, set); err != nil {
+key := rrsetKey(set[0].Hostname, set[0].ProviderName, set[0].RecordType)
+errs = append(errs, fmt.Errorf("delete record %s: %w", key, err))
+}
+}
+
+if len(errs) > 0 {
+return fmt.Errorf("delete records: %v", errs)
+}
+
+return nil
+}
+
+// deleteRecordSet removes the values of one tracked RRset from the provider
+// in a single call and stops tracking them. Once the hostname has no tracked
+// records left its ownership record goes and a container waiting for the
+// hostname takes it over. When the policy does not allow deletes the RRset
+// is only forgotten (caller must hold writeMu and mu)
+func (m *Manager) deleteRecordSet(ctx context.Context, set []*DNSRecord) error {
+first := set[0]
+if !m.policy.AllowsDelete() {
+for _, record := range set {
+delete(m.records, recordKey(record.Hostname, record.ProviderName, record.RecordType, record.Value))
+}
+m.dirty = true
+m.logger.Info("policy does not allow deletes, leaving record at provider",
+zap.String("hostname", first.Hostname),
+zap.String("provider", first.ProviderName),
+zap.String("type", string(first.RecordType)),
+zap.String("policy", string(m.policy)))
+if !m.hostnameTracked(first.Hostname, first.ProviderName) {
+m.promoteChallenger(ctx, first.Hostname, first.ProviderName)
+}
+return nil
 }
 
-provider, ok := m.providers[record.ProviderName]
+provider, ok := m.providers[first.ProviderName]
 if !ok {
-errs = append(errs, fmt.Errorf("provider %q not found", record.ProviderName))
-continue
+return fmt.Errorf("provider %q not found", first.ProviderName)
 }
 
 // Extract zone from hostname
-zone := extractZone(record.Hostname, provider.ZoneFilters())
+zone := extractZone(first.Hostname, provider.ZoneFilters())
 if zone == "" {
-errs = append(errs, fmt.Errorf("could not determine zone for hostname %q", record.Hostname))
-continue
+return fmt.Errorf("could not determine zone for hostname %q", first.Hostname)
 }
 
-// Parse IP address for deletion
-ipAddr, err := netip.ParseAddr(record.Value)
+// Build libdns records for deletion
+records := make([]libdns.Record, 0, len(set))
+for _, record := range set {
+libdnsRecord, err := buildRecord(record.Hostname, zone, record.RecordType, record.Value, 0)
 if err != nil {
-errs = append(errs, fmt.Errorf("invalid IP address %q: %w", record.Value, err))
-continue
+return err
+}
+records = append(records, libdnsRecord)
 }
 
-// Build libdns record for deletion
-libdnsRecord := libdns.Address{
-Name: strings.TrimSuffix(record.Hostname, "."+zone),
-IP:   ipAddr,
+untrack := func() {
+for _, record := range set {
+delete(m.records, recordKey(record.Hostname, record.ProviderName, record.RecordType, record.Value))
+}
+m.dirty = true
 }
 
-// Use the provider adapter to delete the record
+// Only delete records this instance owns; forget the ones it does not
 adapter := provider.Adapter()
-records := []libdns.Record{libdnsRecord}
+if err := m.verifyOwnership(ctx, provider, zone, first.Hostname, false); err != nil {
+if errors.Is(err, ErrNotOwned) {
+untrack()
+}
+return err
+}
 
-_, err = adapter.DeleteRecords(ctx, zone, records)
+// Use the provider adapter to delete the records
+err := m.callProvider(func() error {
+_, err := adapter.DeleteRecords(ctx, zone, records)
+return err
+})
 if err != nil {
-errs = append(errs, fmt.Errorf("delete record %s: %w", key, err))
-continue
+return err
 }
 
 // Remove from tracking
-delete(m.records, key)
+untrack()
+
+if m.hostnameTracked(first.Hostname, first.ProviderName) {
+return m.refreshOwnership(ctx, provider, zone, first.Hostname)
+}
+if err := m.deleteOwnership(ctx, provider, zone, first.Hostname); err != nil {
+return err
+}
+m.promoteChallenger(ctx, first.Hostname, first.ProviderName)
+return nil
 }
 
-if len(errs) > 0 {
-return fmt.Errorf("delete records: %v", errs)
+// hostnameTracked reports whether any record of the hostname is tracked (caller must hold lock)
+func (m *Manager) hostnameTracked(hostname, providerName string) bool {
+for _, record := range m.records {
+if record.Hostname == hostname && record.ProviderName == providerName {
+return true
+}
+}
+return false
 }
 
-return nil
+// trackedSets returns the tracked records match selects, grouped into RRsets
+// and ordered by hostname, provider and type (caller must hold lock)
+func (m *Manager) trackedSets(match func(*DNSRecord) bool) [][]*DNSRecord {
+sets := make(map[string][]*DNSRecord)
+for _, record := range m.records {
+if match(record) {
+key := rrsetKey(record.Hostname, record.ProviderName, record.RecordType)
+sets[key] = append(sets[key], record)
+}
+}
+
+keys := make([]string, 0, len(sets))
+for key := range sets {
+keys = append(keys, key)
+}
+sort.Strings(keys)
+
+grouped := make([][]*DNSRecord, 0, len(keys))
+for _, key := range keys {
+set := sets[key]
+sort.Slice(set, func(i, j int) bool { return set[i].Value < set[j].Value })
+grouped = append(grouped, set)
+}
+return grouped
 }
 
 // GetRecords returns all tracked DNS records
@@ -459,8 +924,93 @@ return false
 
 // Helper functions
 
-func recordKey(hostname, provider string) string {
-return hostname + ":" + provider
+// buildRecord converts a hostname and target to the libdns record of the given
+// type. Address records need an IP target; CNAME records need a hostname
+// target and cannot sit at the zone apex.
+func buildRecord(hostname, zone string, recordType RecordType, value string, ttl time.Duration) (libdns.Record, error) {
+name := relativeName(hostname, zone)
+
+if recordType == RecordTypeCNAME {
+target := strings.TrimSuffix(strings.TrimSpace(value), ".")
+if !isHostname(target) {
+return nil, fmt.Errorf("invalid CNAME target %q", value)
+}
+if name == "@" {
+return nil, fmt.Errorf("cannot create a CNAME for %q at the zone apex", hostname)
+}
+if strings.EqualFold(target, strings.TrimSuffix(hostname, ".")) {
+return nil, fmt.Errorf("CNAME for %q cannot point at itself", hostname)
+}
+return libdns.CNAME{Name: name, Target: target, TTL: ttl}, nil
+}
+
+ipAddr, err := netip.ParseAddr(value)
+if err != nil {
+return nil, fmt.Errorf("invalid IP address %q: %w", value, err)
+}
+return libdns.Address{Name: name, IP: ipAddr, TTL: ttl}, nil
+}
+
+// providerRecordID returns the provider's ID for a written record, if it reports one
+func providerRecordID(record libdns.Record) string {
+var data any
+switch r := record.(type) {
+case libdns.Address:
+data = r.ProviderData
+case libdns.CNAME:
+data = r.ProviderData
+}
+if idMap, ok := data.(map[string]interface{}); ok {
+if id, ok := idMap["id"].(string); ok {
+return id
+}
+}
+return ""
+}
+
+// isHostname reports whether s looks like a DNS hostname rather than an IP
+// address or free text
+func isHostname(s string) bool {
+if s == "" || len(s) > 253 {
+return false
+}
+if _, err := netip.ParseAddr(s); err == nil {
+return false
+}
+for _, label := range strings.Split(s, ".") {
+if label == "" || len(label) > 63 {
+return false
+}
+for _, c := range label {
+if !(c == '-' || c == '_' || c == '*' || unicode.IsLetter(c) || unicode.IsDigit(c)) {
+return false
+}
+}
+}
+return true
+}
+
+func requestTTL(req SyncRequest) int {
+ttl := 300 // default TTL
+if req.TTL != nil {
+ttl = *req.TTL
+}
+return ttl
+}
+
+func requestProxied(req SyncRequest) bool {
+return req.Proxied != nil && *req.Proxied
+}
+
+// recordKey identifies one tracked value. Each value of an RRset is tracked
+// on its own so a hostname can hold several A and AAAA records.
+func recordKey(hostname, provider string, recordType RecordType, value string) string {
+return rrsetKey(hostname, provider, recordType) + ":" + value
+}
+
+// rrsetKey identifies the records of one type for a hostname at a provider.
+func rrsetKey(hostname, provider string, recordType RecordType) string {
+return hostname + ":" + provider + ":" + string(recordType)
 }
 
 func extractZone(hostname string, zoneFilters []string) string {
@@ -484,6 +1034,84 @@ longestMatch = filter
 return longestMatch
 }
 
+// recordTarget is one value a container's hostname should point at.
+type recordTarget struct {
+recordType RecordType
+value      string
+}
+
+// resolveTargets picks the record types and values for a container. An
+// explicit target label wins: an IP address makes an A or AAAA record and a
+// hostname makes a CNAME. Without one, every address from the provider's
+// target resolver or the container is published, IPv4 as A and IPv6 as AAAA,
+// unless the type label restricts it to one family.
+func (m *Manager) resolveTargets(container ContainerInfo, hostname, providerName, labelPrefix string) ([]recordTarget, error) {
+wantType := RecordType(strings.ToUpper(strings.TrimSpace(container.Labels[labelPrefix+".type"])))
+switch wantType {
+case "", RecordTypeA, RecordTypeAAAA, RecordTypeCNAME:
+default:
+m.logger.Warn("unsupported record type label, skipping",
+zap.String("container", container.ID),
+zap.String("hostname", hostname),
+zap.String("type", string(wantType)))
+return nil, nil
+}
+
+if target := strings.TrimSpace(container.Labels[labelPrefix+".target"]); target != "" {
+recordType := RecordTypeCNAME
+if _, err := netip.ParseAddr(target); err == nil {
+recordType = DetermineRecordType(target)
+} else {
+target = strings.TrimSuffix(target, ".")
+}
+if wantType != "" && wantType != recordType {
+m.logger.Warn("record type label does not match target, skipping",
+zap.String("container", container.ID),
+zap.String("hostname", hostname),
+zap.String("type", string(wantType)),
+zap.String("target", target))
+return nil, nil
+}
+return []recordTarget{{recordType: recordType, value: target}}, nil
+}
+
+if wantType == RecordTypeCNAME {
+m.logger.Warn("CNAME requested without a target label, skipping",
+zap.String("container", container.ID),
+zap.String("hostname", hostname))
+return nil, nil
+}
+
+ipv4, ipv6 := container.IPV4, container.IPV6
+resolved4, resolved6, ok, err := m.resolverTargets(providerName)
+if err != nil {
+return nil, err
+}
+if ok {
+ipv4, ipv6 = resolved4, resolved6
+}
+
+var targets []recordTarget
+seen := make(map[string]bool)
+add := func(recordType RecordType, values []string) {
+for _, value := range values {
+value = strings.TrimSpace(value)
+if value == "" || seen[value] {
+continue
+}
+seen[value] = true
+targets = append(targets, recordTarget{recordType: recordType, value: value})
+}
+}
+if wantType != RecordTypeAAAA {
+add(RecordTypeA, ipv4)
+}
+if wantType != RecordTypeA {
+add(RecordTypeAAAA, ipv6)
+}
+return targets, nil
+}
+
 func inferHostnameFromCaddy(value string) string {
 trimmed := strings.TrimSpace(value)
 if trimmed == "" {
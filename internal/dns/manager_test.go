@@ -37,11 +37,19 @@ return m.adapter
 
 // Mock adapter for testing
 type mockAdapter struct {
+getRecords     func(ctx context.Context, zone string) ([]libdns.Record, error)
 appendRecords  func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error)
 setRecords     func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error)
 deleteRecords  func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error)
 }
 
+func (m *mockAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+if m.getRecords != nil {
+return m.getRecords(ctx, zone)
+}
+return nil, nil
+}
+
 func (m *mockAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 if m.appendRecords != nil {
 return m.appendRecords(ctx, zone, records)
@@ -271,6 +279,267 @@ t.Errorf("TTL = %d, want %d", *requests[0].TTL, 600)
 }
 }
 
+func TestComputeDesiredState_CNAMETarget(t *testing.T) {
+manager := NewManager([]providers.Provider{})
+
+containers := []ContainerInfo{
+{
+ID:        "container123",
+Name:      "web-app",
+IsRunning: true,
+IPV4:      []string{"192.168.1.10"},
+Labels: map[string]string{
+"caddy_dns.hostname": "app.example.com",
+"caddy_dns.provider": "cloudflare",
+"caddy_dns.target":   "edge.example.com.",
+},
+},
+}
+
+requests, err := manager.ComputeDesiredState(containers, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+
+if len(requests) != 1 {
+t.Fatalf("expected 1 request, got %d", len(requests))
+}
+
+if requests[0].RecordType != RecordTypeCNAME {
+t.Errorf("recordType = %q, want %q", requests[0].RecordType, RecordTypeCNAME)
+}
+if requests[0].Target != "edge.example.com" {
+t.Errorf("target = %q, want %q", requests[0].Target, "edge.example.com")
+}
+}
+
+func TestComputeDesiredState_TypeLabel(t *testing.T) {
+tests := []struct {
+name       string
+labels     map[string]string
+wantType   RecordType
+wantTarget string
+}{
+{
+name:       "static IPv4 target",
+labels:     map[string]string{"caddy_dns.target": "203.0.113.5"},
+wantType:   RecordTypeA,
+wantTarget: "203.0.113.5",
+},
+{
+name:       "AAAA prefers container IPv6",
+labels:     map[string]string{"caddy_dns.type": "aaaa"},
+wantType:   RecordTypeAAAA,
+wantTarget: "2001:db8::1",
+},
+{
+name:   "CNAME without target",
+labels: map[string]string{"caddy_dns.type": "CNAME"},
+},
+{
+name:   "type does not match target",
+labels: map[string]string{"caddy_dns.type": "A", "caddy_dns.target": "edge.example.com"},
+},
+{
+name:   "unsupported type",
+labels: map[string]string{"caddy_dns.type": "MX"},
+},
+}
+
+for _, tt := range tests {
+t.Run(tt.name, func(t *testing.T) {
+labels := map[string]string{
+"caddy_dns.hostname": "app.example.com",
+"caddy_dns.provider": "cloudflare",
+}
+for k, v := range tt.labels {
+labels[k] = v
+}
+containers := []ContainerInfo{{
+ID:        "container123",
+IsRunning: true,
+IPV4:      []string{"192.168.1.10"},
+IPV6:      []string{"2001:db8::1"},
+Labels:    labels,
+}}
+
+requests, err := NewManager(nil).ComputeDesiredState(containers, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+if tt.wantType == "" {
+if len(requests) != 0 {
+t.Fatalf("expected no requests, got %+v", requests)
+}
+return
+}
+if len(requests) != 1 {
+t.Fatalf("expected 1 request, got %d", len(requests))
+}
+if requests[0].RecordType != tt.wantType || requests[0].Target != tt.wantTarget {
+t.Errorf("request = %s %s, want %s %s", requests[0].RecordType, requests[0].Target, tt.wantType, tt.wantTarget)
+}
+})
+}
+}
+
+type staticResolver struct {
+addrs []netip.Addr
+err   error
+}
+
+func (r staticResolver) Addresses(context.Context) ([]netip.Addr, error) {
+return r.addrs, r.err
+}
+
+func TestComputeDesiredState_TargetResolver(t *testing.T) {
+manager := NewManager(nil,
+WithTargetResolver("cloudflare", staticResolver{addrs: []netip.Addr{
+netip.MustParseAddr("203.0.113.5"),
+netip.MustParseAddr("2001:db8::5"),
+}}),
+)
+
+container := func(provider string, extra map[string]string) ContainerInfo {
+labels := map[string]string{
+"caddy_dns.hostname": "app.example.com",
+"caddy_dns.provider": provider,
+}
+for k, v := range extra {
+labels[k] = v
+}
+return ContainerInfo{
+ID:        "container-" + provider,
+IsRunning: true,
+IPV4:      []string{"172.17.0.2"},
+Labels:    labels,
+}
+}
+
+tests := []struct {
+name       string
+container  ContainerInfo
+wantTarget string
+}{
+{name: "resolver IPv4", container: container("cloudflare", map[string]string{"caddy_dns.type": "A"}), wantTarget: "203.0.113.5"},
+{name: "resolver IPv6", container: container("cloudflare", map[string]string{"caddy_dns.type": "AAAA"}), wantTarget: "2001:db8::5"},
+{name: "target label wins", container: container("cloudflare", map[string]string{"caddy_dns.target": "198.51.100.1"}), wantTarget: "198.51.100.1"},
+{name: "no resolver uses container", container: container("unifi", nil), wantTarget: "172.17.0.2"},
+}
+
+for _, tt := range tests {
+t.Run(tt.name, func(t *testing.T) {
+requests, err := manager.ComputeDesiredState([]ContainerInfo{tt.container}, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+if len(requests) != 1 || requests[0].Target != tt.wantTarget {
+t.Fatalf("requests = %+v, want target %s", requests, tt.wantTarget)
+}
+})
+}
+}
+
+// flakyResolver returns addrs until failing is set
+type flakyResolver struct {
+addrs   []netip.Addr
+failing bool
+}
+
+func (r *flakyResolver) Addresses(context.Context) ([]netip.Addr, error) {
+if r.failing {
+return nil, errors.New("echo service down")
+}
+return r.addrs, nil
+}
+
+func TestComputeDesiredState_ResolverErrorKeepsRecords(t *testing.T) {
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     &mockAdapter{},
+}
+resolver := &flakyResolver{addrs: []netip.Addr{netip.MustParseAddr("203.0.113.5")}, failing: true}
+manager := NewManager([]providers.Provider{provider}, WithTargetResolver("cloudflare", resolver))
+containers := []ContainerInfo{{
+ID:        "container123",
+IsRunning: true,
+IPV4:      []string{"172.17.0.2"},
+Labels: map[string]string{
+"caddy_dns.hostname": "app.example.com",
+"caddy_dns.provider": "cloudflare",
+},
+}}
+
+// Without a known address the failure is an error, not an empty state
+if requests, err := manager.ComputeDesiredState(containers, "caddy_dns"); err == nil {
+t.Fatalf("expected error from failing resolver, got %+v", requests)
+}
+
+resolver.failing = false
+requests, err := manager.ComputeDesiredState(containers, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+if _, err := manager.Sync(context.Background(), requests); err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+// Later failures fall back to the last address, so nothing is pruned
+resolver.failing = true
+requests, err = manager.ComputeDesiredState(containers, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+result, err := manager.SyncContainers(context.Background(), []string{"container123"}, requests)
+if err != nil {
+t.Fatalf("SyncContainers failed: %v", err)
+}
+if deleted := result.Count(SyncOutcomeDeleted); deleted != 0 {
+t.Fatalf("deleted = %d, want 0", deleted)
+}
+if records := manager.GetRecords(); len(records) != 1 || records[0].Value != "203.0.113.5" {
+t.Fatalf("records = %+v, want the resolved address kept", records)
+}
+}
+
+func TestComputeDesiredState_DualStack(t *testing.T) {
+containers := []ContainerInfo{{
+ID:        "container123",
+IsRunning: true,
+IPV4:      []string{"192.168.1.10", "10.0.0.10", "192.168.1.10"},
+IPV6:      []string{"2001:db8::1", "2001:db8::2"},
+Labels: map[string]string{
+"caddy_dns.hostname": "app.example.com",
+"caddy_dns.provider": "cloudflare",
+},
+}}
+
+requests, err := NewManager(nil).ComputeDesiredState(containers, "caddy_dns")
+if err != nil {
+t.Fatalf("ComputeDesiredState failed: %v", err)
+}
+
+var got []string
+for _, req := range requests {
+got = append(got, string(req.RecordType)+" "+req.Target)
+}
+want := []string{"A 192.168.1.10", "A 10.0.0.10", "AAAA 2001:db8::1", "AAAA 2001:db8::2"}
+if len(got) != len(want) {
+t.Fatalf("requests = %v, want %v", got, want)
+}
+for i := range want {
+if got[i] != want[i] {
+t.Fatalf("requests = %v, want %v", got, want)
+}
+}
+
+sets := GroupRecordSets(requests)
+if len(sets) != 2 || len(sets[0]) != 2 || len(sets[1]) != 2 {
+t.Fatalf("sets = %+v, want an A and an AAAA set of two values", sets)
+}
+}
+
 func TestCreateRecord_Success(t *testing.T) {
 appendCalled := false
 adapter := &mockAdapter{
@@ -417,20 +686,19 @@ t.Errorf("state = %q, want %q", records[0].State, RecordStateError)
 }
 }
 
-func TestDeleteRecord_Success(t *testing.T) {
-deleteCalled := false
+func TestCreateRecord_CNAME(t *testing.T) {
 adapter := &mockAdapter{
 appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-return records, nil
-},
-deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-deleteCalled = true
-if zone != "example.com" {
-t.Errorf("zone = %q, want %q", zone, "example.com")
-}
 if len(records) != 1 {
 t.Fatalf("expected 1 record, got %d", len(records))
 }
+cname, ok := records[0].(libdns.CNAME)
+if !ok {
+t.Fatalf("expected CNAME record, got %T", records[0])
+}
+if cname.Name != "app" || cname.Target != "edge.example.com" {
+t.Errorf("record = %s -> %s, want app -> edge.example.com", cname.Name, cname.Target)
+}
 return records, nil
 },
 }
@@ -443,56 +711,77 @@ adapter:     adapter,
 
 manager := NewManager([]providers.Provider{provider})
 
-// First create a record
 req := SyncRequest{
 Hostname:     "app.example.com",
 ProviderName: "cloudflare",
-RecordType:   RecordTypeA,
-Target:       "192.168.1.10",
+RecordType:   RecordTypeCNAME,
+Target:       "edge.example.com",
 SourceID:     "container123",
 }
 
-err := manager.CreateRecord(context.Background(), req)
-if err != nil {
+if err := manager.CreateRecord(context.Background(), req); err != nil {
 t.Fatalf("CreateRecord failed: %v", err)
 }
 
-// Now delete it
-err = manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "container123")
-if err != nil {
+deleted := false
+adapter.deleteRecords = func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deleted = true
+if cname, ok := records[0].(libdns.CNAME); !ok || cname.Target != "edge.example.com" {
+t.Errorf("deleted %#v, want the CNAME", records[0])
+}
+return records, nil
+}
+if err := manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "container123"); err != nil {
 t.Fatalf("DeleteRecord failed: %v", err)
 }
-
-if !deleteCalled {
+if !deleted {
 t.Error("DeleteRecords was not called")
 }
-
-// Verify record was removed
-records := manager.GetRecords()
-if len(records) != 0 {
-t.Fatalf("expected 0 stored records, got %d", len(records))
-}
 }
 
-func TestDeleteRecord_NotFound(t *testing.T) {
+func TestCreateRecord_InvalidCNAME(t *testing.T) {
 provider := &mockProvider{
 name:        "cloudflare",
 zoneFilters: []string{"example.com"},
 adapter:     &mockAdapter{},
 }
-
 manager := NewManager([]providers.Provider{provider})
 
-// Try to delete non-existent record (should not error)
-err := manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "container123")
-if err != nil {
-t.Fatalf("DeleteRecord failed: %v", err)
+tests := []struct {
+name     string
+hostname string
+target   string
+}{
+{name: "zone apex", hostname: "example.com", target: "edge.example.net"},
+{name: "points at itself", hostname: "app.example.com", target: "APP.example.com"},
+{name: "not a hostname", hostname: "app.example.com", target: "edge example"},
+}
+
+for _, tt := range tests {
+t.Run(tt.name, func(t *testing.T) {
+req := SyncRequest{
+Hostname:     tt.hostname,
+ProviderName: "cloudflare",
+RecordType:   RecordTypeCNAME,
+Target:       tt.target,
+SourceID:     "container123",
+}
+if err := manager.CreateRecord(context.Background(), req); err == nil {
+t.Fatal("expected an error")
+}
+})
 }
 }
 
-func TestDeleteRecord_WrongContainer(t *testing.T) {
+func TestUpdateRecord_UsesSetRecords(t *testing.T) {
+setCalled := false
 adapter := &mockAdapter{
 appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+t.Error("AppendRecords should not be called for an update")
+return records, nil
+},
+setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+setCalled = true
 return records, nil
 },
 }
@@ -505,41 +794,32 @@ adapter:     adapter,
 
 manager := NewManager([]providers.Provider{provider})
 
-// Create a record
 req := SyncRequest{
 Hostname:     "app.example.com",
 ProviderName: "cloudflare",
 RecordType:   RecordTypeA,
-Target:       "192.168.1.10",
+Target:       "192.168.1.20",
 SourceID:     "container123",
 }
 
-err := manager.CreateRecord(context.Background(), req)
-if err != nil {
-t.Fatalf("CreateRecord failed: %v", err)
+if err := manager.UpdateRecord(context.Background(), req); err != nil {
+t.Fatalf("UpdateRecord failed: %v", err)
 }
 
-// Try to delete with different container ID
-err = manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "different-container")
-if err == nil {
-t.Fatal("expected error when deleting record from different container")
+if !setCalled {
+t.Error("SetRecords was not called")
 }
 
-// Verify record still exists
 records := manager.GetRecords()
-if len(records) != 1 {
-t.Fatalf("expected 1 stored record, got %d", len(records))
+if len(records) != 1 || records[0].Value != "192.168.1.20" {
+t.Fatalf("unexpected records: %+v", records)
 }
 }
 
-func TestDeleteRecordsForContainer(t *testing.T) {
-deleteCount := 0
+func TestAdoptRecord_TracksWithoutProviderCall(t *testing.T) {
 adapter := &mockAdapter{
 appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-return records, nil
-},
-deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-deleteCount++
+t.Error("AppendRecords should not be called when adopting")
 return records, nil
 },
 }
@@ -552,47 +832,260 @@ adapter:     adapter,
 
 manager := NewManager([]providers.Provider{provider})
 
-// Create multiple records for same container
-for _, hostname := range []string{"app1.example.com", "app2.example.com"} {
-req := SyncRequest{
-Hostname:     hostname,
+manager.AdoptRecord(SyncRequest{
+Hostname:     "app.example.com",
 ProviderName: "cloudflare",
 RecordType:   RecordTypeA,
 Target:       "192.168.1.10",
 SourceID:     "container123",
-}
-
-err := manager.CreateRecord(context.Background(), req)
-if err != nil {
-t.Fatalf("CreateRecord failed: %v", err)
-}
-}
+})
 
-// Verify we have 2 records
 records := manager.GetRecords()
-if len(records) != 2 {
-t.Fatalf("expected 2 records, got %d", len(records))
-}
-
-// Delete all records for the container
-err := manager.DeleteRecordsForContainer(context.Background(), "container123")
-if err != nil {
-t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+if len(records) != 1 {
+t.Fatalf("expected 1 stored record, got %d", len(records))
 }
-
-if deleteCount != 2 {
-t.Errorf("DeleteRecords called %d times, want 2", deleteCount)
+if records[0].State != RecordStatePresent {
+t.Errorf("state = %q, want %q", records[0].State, RecordStatePresent)
 }
 
-// Verify all records were removed
-records = manager.GetRecords()
-if len(records) != 0 {
-t.Fatalf("expected 0 records, got %d", len(records))
+if zone := manager.ZoneForHostname("app.example.com", "cloudflare"); zone != "example.com" {
+t.Errorf("ZoneForHostname = %q, want %q", zone, "example.com")
 }
 }
 
-func TestSync_DeduplicatesRequests(t *testing.T) {
-appendCount := 0
+func TestDeleteRecord_Success(t *testing.T) {
+deleteCalled := false
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+return records, nil
+},
+deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deleteCalled = true
+if zone != "example.com" {
+t.Errorf("zone = %q, want %q", zone, "example.com")
+}
+if len(records) != 1 {
+t.Fatalf("expected 1 record, got %d", len(records))
+}
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+// First create a record
+req := SyncRequest{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     "container123",
+}
+
+err := manager.CreateRecord(context.Background(), req)
+if err != nil {
+t.Fatalf("CreateRecord failed: %v", err)
+}
+
+// Now delete it
+err = manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "container123")
+if err != nil {
+t.Fatalf("DeleteRecord failed: %v", err)
+}
+
+if !deleteCalled {
+t.Error("DeleteRecords was not called")
+}
+
+// Verify record was removed
+records := manager.GetRecords()
+if len(records) != 0 {
+t.Fatalf("expected 0 stored records, got %d", len(records))
+}
+}
+
+func TestDeleteRecord_NotFound(t *testing.T) {
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     &mockAdapter{},
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+// Try to delete non-existent record (should not error)
+err := manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "container123")
+if err != nil {
+t.Fatalf("DeleteRecord failed: %v", err)
+}
+}
+
+func TestDeleteRecord_WrongContainer(t *testing.T) {
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+// Create a record
+req := SyncRequest{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     "container123",
+}
+
+err := manager.CreateRecord(context.Background(), req)
+if err != nil {
+t.Fatalf("CreateRecord failed: %v", err)
+}
+
+// Try to delete with different container ID
+err = manager.DeleteRecord(context.Background(), "app.example.com", "cloudflare", "different-container")
+if err == nil {
+t.Fatal("expected error when deleting record from different container")
+}
+
+// Verify record still exists
+records := manager.GetRecords()
+if len(records) != 1 {
+t.Fatalf("expected 1 stored record, got %d", len(records))
+}
+}
+
+func TestDeleteRecordsForContainer(t *testing.T) {
+deleteCount := 0
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+return records, nil
+},
+deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deleteCount++
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+// Create multiple records for same container
+for _, hostname := range []string{"app1.example.com", "app2.example.com"} {
+req := SyncRequest{
+Hostname:     hostname,
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     "container123",
+}
+
+err := manager.CreateRecord(context.Background(), req)
+if err != nil {
+t.Fatalf("CreateRecord failed: %v", err)
+}
+}
+
+// Verify we have 2 records
+records := manager.GetRecords()
+if len(records) != 2 {
+t.Fatalf("expected 2 records, got %d", len(records))
+}
+
+// Delete all records for the container
+err := manager.DeleteRecordsForContainer(context.Background(), "container123")
+if err != nil {
+t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+}
+
+if deleteCount != 2 {
+t.Errorf("DeleteRecords called %d times, want 2", deleteCount)
+}
+
+// Verify all records were removed
+records = manager.GetRecords()
+if len(records) != 0 {
+t.Fatalf("expected 0 records, got %d", len(records))
+}
+}
+
+func TestDeleteRecordsForContainer_WaitsForSyncInFlight(t *testing.T) {
+entered := make(chan struct{})
+release := make(chan struct{})
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+close(entered)
+<-release
+return records, nil
+},
+}
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+manager := NewManager([]providers.Provider{provider})
+ctx := context.Background()
+
+synced := make(chan error)
+go func() {
+_, err := manager.Sync(ctx, []SyncRequest{{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "5.6.7.8",
+SourceID:     "c1",
+}})
+synced <- err
+}()
+<-entered
+
+// The container goes while its record is being written
+deleted := make(chan error)
+go func() {
+deleted <- manager.DeleteRecordsForContainer(ctx, "c1")
+}()
+
+// Readers are not held up by the provider call, but the delete is
+manager.GetRecords()
+select {
+case err := <-deleted:
+t.Fatalf("DeleteRecordsForContainer returned during the sync's provider call: %v", err)
+case <-time.After(20 * time.Millisecond):
+}
+
+close(release)
+if err := <-synced; err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+if err := <-deleted; err != nil {
+t.Fatalf("DeleteRecordsForContainer failed: %v", err)
+}
+if records := manager.GetRecords(); len(records) != 0 {
+t.Fatalf("records = %+v, want the removed container's record gone", records)
+}
+}
+
+func TestSync_DeduplicatesRequests(t *testing.T) {
+appendCount := 0
 adapter := &mockAdapter{
 appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 appendCount++
@@ -628,12 +1121,12 @@ RequestedAt:  time.Now(), // More recent
 },
 }
 
-err := manager.Sync(context.Background(), requests)
+_, err := manager.Sync(context.Background(), requests)
 if err != nil {
 t.Fatalf("Sync failed: %v", err)
 }
 
-// Should only create one record (the most recent one)
+// Should only create one record (the first one)
 if appendCount != 1 {
 t.Errorf("AppendRecords called %d times, want 1", appendCount)
 }
@@ -643,12 +1136,455 @@ if len(records) != 1 {
 t.Fatalf("expected 1 record, got %d", len(records))
 }
 
-// Should be the more recent request
-if records[0].SourceID != "container2" {
-t.Errorf("sourceID = %q, want %q", records[0].SourceID, "container2")
+// Should be the earlier request; the later one is a conflict
+if records[0].SourceID != "container1" {
+t.Errorf("sourceID = %q, want %q", records[0].SourceID, "container1")
+}
+if records[0].Value != "192.168.1.10" {
+t.Errorf("value = %q, want %q", records[0].Value, "192.168.1.10")
+}
+if conflicts := manager.GetConflicts(); len(conflicts) != 1 || conflicts[0].SourceID != "container2" {
+t.Errorf("conflicts = %+v, want one for container2", conflicts)
+}
+}
+
+func TestSync_WritesRecordSets(t *testing.T) {
+var appended, set [][]libdns.Record
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+appended = append(appended, records)
+return records, nil
+},
+setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+set = append(set, records)
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+request := func(recordType RecordType, target string) SyncRequest {
+return SyncRequest{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   recordType,
+Target:       target,
+SourceID:     "container123",
+}
+}
+
+_, err := manager.Sync(context.Background(), []SyncRequest{
+request(RecordTypeA, "192.168.1.10"),
+request(RecordTypeA, "192.168.1.11"),
+request(RecordTypeAAAA, "2001:db8::1"),
+})
+if err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+if len(appended) != 2 || len(appended[0]) != 2 || len(appended[1]) != 1 {
+t.Fatalf("appended = %v, want the A set of two and the AAAA set of one", appended)
+}
+if records := manager.GetRecords(); len(records) != 3 {
+t.Fatalf("expected 3 tracked records, got %d", len(records))
+}
+
+// Dropping an address replaces the A set in one call and leaves AAAA alone
+_, err = manager.Sync(context.Background(), []SyncRequest{
+request(RecordTypeA, "192.168.1.11"),
+request(RecordTypeAAAA, "2001:db8::1"),
+})
+if err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+if len(set) != 1 || len(set[0]) != 1 {
+t.Fatalf("set = %v, want one SetRecords call with the remaining address", set)
+}
+values := make(map[string]bool)
+for _, record := range manager.GetRecords() {
+values[record.Value] = true
+}
+if len(values) != 2 || !values["192.168.1.11"] || !values["2001:db8::1"] {
+t.Fatalf("tracked values = %v, want 192.168.1.11 and 2001:db8::1", values)
+}
+}
+
+func TestSync_SkipsUnchangedAndReplacesChanged(t *testing.T) {
+appendCount, setCount := 0, 0
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+appendCount++
+return records, nil
+},
+setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+setCount++
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+ttl := 300
+proxied := false
+req := SyncRequest{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     "container1",
+TTL:          &ttl,
+Proxied:      &proxied,
+}
+
+syncRequest := func(req SyncRequest) {
+t.Helper()
+if _, err := manager.Sync(context.Background(), []SyncRequest{req}); err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+}
+
+syncRequest(req)
+syncRequest(req)
+if appendCount != 1 || setCount != 0 {
+t.Fatalf("append = %d, set = %d after an unchanged sync, want 1 and 0", appendCount, setCount)
+}
+
+// A recreated container with the same address only moves tracking
+recreated := req
+recreated.SourceID = "container2"
+syncRequest(recreated)
+if appendCount != 1 || setCount != 0 {
+t.Fatalf("append = %d, set = %d after a new source, want 1 and 0", appendCount, setCount)
+}
+if records := manager.GetRecords(); len(records) != 1 || records[0].SourceID != "container2" {
+t.Fatalf("records = %+v, want the record tracked for container2", records)
+}
+
+changes := []func(*SyncRequest){
+func(r *SyncRequest) { r.Target = "192.168.1.20" },
+func(r *SyncRequest) { longer := 600; r.TTL = &longer },
+func(r *SyncRequest) { on := true; r.Proxied = &on },
+}
+for i, change := range changes {
+changed := recreated
+change(&changed)
+syncRequest(changed)
+recreated = changed
+if setCount != i+1 {
+t.Fatalf("set = %d after change %d, want %d", setCount, i, i+1)
+}
+}
+if appendCount != 1 {
+t.Errorf("AppendRecords called %d times, want 1", appendCount)
+}
+
+records := manager.GetRecords()
+if len(records) != 1 || records[0].Value != "192.168.1.20" || records[0].TTL != 600 || !records[0].Proxied {
+t.Fatalf("records = %+v, want the updated record", records)
+}
+}
+
+func TestSync_ContinuesPastFailures(t *testing.T) {
+errRejected := errors.New("provider rejected record")
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+if records[0].RR().Name == "bad" {
+return nil, errRejected
+}
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+
+request := func(hostname, sourceID string) SyncRequest {
+return SyncRequest{
+Hostname:     hostname,
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     sourceID,
+}
+}
+
+if _, err := manager.Sync(context.Background(), []SyncRequest{request("same.example.com", "container1")}); err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+result, err := manager.Sync(context.Background(), []SyncRequest{
+request("bad.example.com", "container2"),
+request("good.example.com", "container3"),
+request("same.example.com", "container1"),
+request("outside.example.org", "container4"),
+})
+if !errors.Is(err, errRejected) {
+t.Fatalf("err = %v, want the provider error", err)
+}
+if result.Err() == nil || result.Err().Error() != err.Error() {
+t.Errorf("result.Err() = %v, want %v", result.Err(), err)
+}
+
+outcomes := make(map[string]SyncOutcome)
+for _, entry := range result.Entries {
+outcomes[entry.Hostname] = entry.Outcome
+}
+want := map[string]SyncOutcome{
+"bad.example.com":     SyncOutcomeFailed,
+"good.example.com":    SyncOutcomeCreated,
+"same.example.com":    SyncOutcomeUnchanged,
+"outside.example.org": SyncOutcomeFailed,
+}
+for hostname, outcome := range want {
+if outcomes[hostname] != outcome {
+t.Errorf("outcome for %s = %q, want %q", hostname, outcomes[hostname], outcome)
+}
+}
+if result.Count(SyncOutcomeFailed) != 2 {
+t.Errorf("failed = %d, want 2", result.Count(SyncOutcomeFailed))
+}
+
+failed := result.Failed()
+if len(failed) != 2 || failed[0].Hostname != "bad.example.com" || failed[1].Hostname != "outside.example.org" {
+t.Errorf("failed requests = %+v, want bad and outside", failed)
+}
+
+records := manager.GetRecords()
+hosts := make(map[string]RecordState)
+for _, record := range records {
+hosts[record.Hostname] = record.State
+}
+if hosts["good.example.com"] != RecordStatePresent || hosts["bad.example.com"] != RecordStateError {
+t.Errorf("tracked states = %v, want good present and bad in error", hosts)
+}
+}
+
+func TestSyncRecordSets_RetriesFailedWithoutPruning(t *testing.T) {
+failAAAA := true
+deletes := 0
+adapter := &mockAdapter{
+appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+if records[0].RR().Type == "AAAA" && failAAAA {
+return nil, errors.New("provider unavailable")
+}
+return records, nil
+},
+deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deletes++
+return records, nil
+},
+}
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+manager := NewManager([]providers.Provider{provider})
+ctx := context.Background()
+
+result, err := manager.Sync(ctx, []SyncRequest{
+{Hostname: "app.example.com", ProviderName: "cloudflare", RecordType: RecordTypeA, Target: "192.168.1.10", SourceID: "container123"},
+{Hostname: "app.example.com", ProviderName: "cloudflare", RecordType: RecordTypeAAAA, Target: "2001:db8::1", SourceID: "container123"},
+})
+if err == nil || result.Count(SyncOutcomeFailed) != 1 {
+t.Fatalf("Sync = %+v, %v, want the AAAA RRset to fail", result.Entries, err)
+}
+
+failAAAA = false
+retry, err := manager.SyncRecordSets(ctx, result.Failed())
+if err != nil {
+t.Fatalf("SyncRecordSets failed: %v", err)
+}
+if len(retry.Entries) != 1 || retry.Entries[0].Outcome != SyncOutcomeUpdated {
+t.Fatalf("retry entries = %+v, want the AAAA RRset rewritten", retry.Entries)
+}
+
+if deletes != 0 {
+t.Fatalf("deletes = %d, want the A RRset kept", deletes)
+}
+records := manager.GetRecords()
+if len(records) != 2 {
+t.Fatalf("records = %+v, want both RRsets tracked", records)
+}
+for _, record := range records {
+if record.State != RecordStatePresent {
+t.Errorf("record %s state = %s, want present", record.Value, record.State)
+}
+}
+}
+
+func TestDeleteRecordSet_KeepsOtherTypes(t *testing.T) {
+var deleted []libdns.Record
+adapter := &mockAdapter{
+deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deleted = append(deleted, records...)
+return records, nil
+},
+}
+
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+
+manager := NewManager([]providers.Provider{provider})
+for _, req := range []SyncRequest{
+{Hostname: "app.example.com", ProviderName: "cloudflare", RecordType: RecordTypeA, Target: "192.168.1.10", SourceID: "container123"},
+{Hostname: "app.example.com", ProviderName: "cloudflare", RecordType: RecordTypeAAAA, Target: "2001:db8::1", SourceID: "container123"},
+} {
+manager.AdoptRecord(req)
+}
+
+if err := manager.DeleteRecordSet(context.Background(), "app.example.com", "cloudflare", RecordTypeAAAA, "container123"); err != nil {
+t.Fatalf("DeleteRecordSet failed: %v", err)
+}
+
+if len(deleted) != 1 || deleted[0].RR().Type != "AAAA" {
+t.Fatalf("deleted = %v, want the AAAA record", deleted)
+}
+records := manager.GetRecords()
+if len(records) != 1 || records[0].RecordType != RecordTypeA {
+t.Fatalf("records = %+v, want the A record", records)
+}
+}
+
+func TestSyncContainers_PrunesStaleRecordSets(t *testing.T) {
+tests := []struct {
+name        string
+policy      Policy
+wantDeletes int
+wantOutcome SyncOutcome
+}{
+{name: "sync deletes", policy: PolicySync, wantDeletes: 1, wantOutcome: SyncOutcomeDeleted},
+{name: "upsert-only forgets", policy: PolicyUpsertOnly, wantDeletes: 0, wantOutcome: SyncOutcomeSkipped},
+}
+
+for _, tt := range tests {
+t.Run(tt.name, func(t *testing.T) {
+deletes := 0
+adapter := &mockAdapter{
+deleteRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+deletes++
+return records, nil
+},
+}
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+manager := NewManager([]providers.Provider{provider}, WithPolicy(tt.policy))
+
+request := func(hostname, sourceID string) SyncRequest {
+return SyncRequest{
+Hostname:     hostname,
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       "192.168.1.10",
+SourceID:     sourceID,
+}
+}
+_, err := manager.Sync(context.Background(), []SyncRequest{
+request("app.example.com", "container1"),
+request("old.example.com", "container1"),
+request("other.example.com", "container2"),
+})
+if err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+// container1 dropped old.example.com; container2 is out of scope
+result, err := manager.SyncContainers(context.Background(), []string{"container1"}, []SyncRequest{
+request("app.example.com", "container1"),
+})
+if err != nil {
+t.Fatalf("SyncContainers failed: %v", err)
+}
+
+if deletes != tt.wantDeletes {
+t.Fatalf("deletes = %d, want %d", deletes, tt.wantDeletes)
+}
+if got := result.Count(tt.wantOutcome); got != 1 {
+t.Fatalf("%s outcomes = %d, want 1", tt.wantOutcome, got)
+}
+hostnames := make(map[string]bool)
+for _, record := range manager.GetRecords() {
+hostnames[record.Hostname] = true
+}
+if len(hostnames) != 2 || !hostnames["app.example.com"] || !hostnames["other.example.com"] {
+t.Fatalf("tracked hostnames = %v, want app and other", hostnames)
+}
+
+// A container without requests loses all of its records
+if _, err := manager.SyncContainers(context.Background(), []string{"container2"}, nil); err != nil {
+t.Fatalf("SyncContainers failed: %v", err)
+}
+if records := manager.GetRecords(); len(records) != 1 || records[0].Hostname != "app.example.com" {
+t.Fatalf("records = %v, want only app.example.com", records)
+}
+})
+}
+}
+
+func TestSync_CreateOnlySkipsChangedRecordSets(t *testing.T) {
+setCount := 0
+adapter := &mockAdapter{
+setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+setCount++
+return records, nil
+},
+}
+provider := &mockProvider{
+name:        "cloudflare",
+zoneFilters: []string{"example.com"},
+adapter:     adapter,
+}
+manager := NewManager([]providers.Provider{provider}, WithPolicy(PolicyCreateOnly))
+
+request := func(target string) SyncRequest {
+return SyncRequest{
+Hostname:     "app.example.com",
+ProviderName: "cloudflare",
+RecordType:   RecordTypeA,
+Target:       target,
+SourceID:     "container123",
+}
+}
+if _, err := manager.Sync(context.Background(), []SyncRequest{request("192.168.1.10")}); err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+
+result, err := manager.Sync(context.Background(), []SyncRequest{request("192.168.1.11")})
+if err != nil {
+t.Fatalf("Sync failed: %v", err)
+}
+if setCount != 0 {
+t.Fatalf("SetRecords calls = %d, want 0", setCount)
+}
+if got := result.Count(SyncOutcomeSkipped); got != 1 {
+t.Fatalf("skipped outcomes = %d, want 1", got)
 }
-if records[0].Value != "192.168.1.20" {
-t.Errorf("value = %q, want %q", records[0].Value, "192.168.1.20")
+if records := manager.GetRecords(); len(records) != 1 || records[0].Value != "192.168.1.10" {
+t.Fatalf("records = %v, want the original address", records)
 }
 }
 
@@ -0,0 +1,43 @@
+package dns
+
+import "github.com/cpritchett/caddy-dns-plugin/internal/config"
+
+// Policy chooses which changes the manager makes to records it already
+// tracks, following external-dns. Its values are the policy option of the
+// config package.
+type Policy string
+
+const (
+	// PolicySync creates, updates and deletes records.
+	PolicySync Policy = config.PolicySync
+	// PolicyUpsertOnly creates and updates records but never deletes them.
+	// Records that would be deleted are forgotten and left at the provider.
+	PolicyUpsertOnly Policy = config.PolicyUpsertOnly
+	// PolicyCreateOnly creates records and leaves existing ones alone.
+	PolicyCreateOnly Policy = config.PolicyCreateOnly
+)
+
+// WithPolicy sets the policy for changes to tracked records. The default is
+// PolicySync.
+func WithPolicy(policy Policy) ManagerOption {
+	return func(m *Manager) {
+		if policy != "" {
+			m.policy = policy
+		}
+	}
+}
+
+// Policy returns the manager's policy.
+func (m *Manager) Policy() Policy {
+	return m.policy
+}
+
+// AllowsUpdate reports whether records that exist may be replaced.
+func (p Policy) AllowsUpdate() bool {
+	return p != PolicyCreateOnly
+}
+
+// AllowsDelete reports whether records may be deleted from the provider.
+func (p Policy) AllowsDelete() bool {
+	return p == PolicySync
+}
@@ -0,0 +1,301 @@
+package dns
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+// ownershipPrefix is prepended to a record's name to form the name of the TXT
+// record that marks it as managed by this plugin.
+const ownershipPrefix = "_caddy-dns"
+
+const ownershipHeritage = "caddy-dns"
+
+// ErrNotOwned is returned when a record exists at the provider but is not
+// marked as owned by this instance.
+var ErrNotOwned = errors.New("record is not owned by this instance")
+
+// Ownership is the content of an ownership TXT record.
+type Ownership struct {
+	Owner    string
+	SourceID string
+	// Hash fingerprints the A, AAAA and CNAME records the owner wrote for the
+	// name, so records a person changed since are not taken for the owner's.
+	Hash string
+}
+
+// WithOwnerID enables the TXT registry: every record the manager writes gets
+// a companion _caddy-dns TXT record naming owner, and records are only
+// updated or deleted when that TXT record names owner and its hash matches
+// the records at the name. Providers that cannot store TXT records or list
+// records are left out of the registry.
+func WithOwnerID(owner string) ManagerOption {
+	return func(m *Manager) {
+		m.ownerID = owner
+	}
+}
+
+// registryEnabled reports whether the TXT registry applies to a provider.
+func (m *Manager) registryEnabled(provider providers.Provider) bool {
+	return m.ownerID != "" && providers.SupportsRecordType(provider, "TXT") && providers.SupportsListing(provider)
+}
+
+// OwnsRecord reports whether records, as read from hostname's zone at the
+// provider, mark hostname as owned by this instance and hold the records it
+// wrote. It always returns true when ownership is disabled for the provider.
+func (m *Manager) OwnsRecord(records []libdns.Record, hostname, providerName, zone string) bool {
+	provider, ok := m.providers[providerName]
+	if !ok || !m.registryEnabled(provider) {
+		return true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := relativeName(hostname, zone)
+	ownership, ok := findOwnership(records, name)
+	return ok && ownership.Owner == m.ownerID && m.unchangedSince(ownership, hostname, providerName, managedValues(records, name))
+}
+
+// verifyOwnership checks the provider's records before hostname is changed.
+// A write may claim a name that holds nothing yet, or write again the
+// records of an owned name that lost them; otherwise the name needs an
+// ownership record naming this instance whose hash matches the records
+// there (caller must hold writeMu and mu).
+func (m *Manager) verifyOwnership(ctx context.Context, provider providers.Provider, zone, hostname string, claimUnused bool) error {
+	if !m.registryEnabled(provider) {
+		return nil
+	}
+	name := relativeName(hostname, zone)
+
+	var records []libdns.Record
+	err := m.callProvider(func() (err error) {
+		records, err = provider.Adapter().GetRecords(ctx, zone)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("check ownership: %w", err)
+	}
+
+	ownership, ok := findOwnership(records, name)
+	values := managedValues(records, name)
+	switch {
+	case ok && ownership.Owner != m.ownerID:
+		return fmt.Errorf("%w: %q is owned by %q", ErrNotOwned, name, ownership.Owner)
+	case ok && m.unchangedSince(ownership, hostname, provider.Name(), values):
+		return nil
+	case claimUnused && len(values) == 0:
+		return nil
+	case ok:
+		return fmt.Errorf("%w: %q was changed since %q wrote it", ErrNotOwned, name, m.ownerID)
+	default:
+		return fmt.Errorf("%w: %q has no ownership record", ErrNotOwned, name)
+	}
+}
+
+// unchangedSince reports whether the provider's managed values of hostname
+// are the ones ownership was written for, or the ones this instance tracks,
+// as when a write reached the provider but its ownership record did not
+// (caller must hold lock).
+func (m *Manager) unchangedSince(ownership Ownership, hostname, providerName string, values map[string]bool) bool {
+	hash := ownershipHash(hostname, values)
+	return hash == ownership.Hash || hash == ownershipHash(hostname, m.trackedValues(hostname, providerName))
+}
+
+// writeOwnership replaces the ownership TXT record of hostname with one
+// whose hash covers values, the types and values of the records it holds.
+func (m *Manager) writeOwnership(ctx context.Context, provider providers.Provider, zone, hostname, sourceID string, ttl int, values map[string]bool) error {
+	if !m.registryEnabled(provider) {
+		return nil
+	}
+
+	txt := libdns.TXT{
+		Name: ownershipName(relativeName(hostname, zone)),
+		TTL:  time.Duration(ttl) * time.Second,
+		Text: formatOwnership(Ownership{
+			Owner:    m.ownerID,
+			SourceID: sourceID,
+			Hash:     ownershipHash(hostname, values),
+		}),
+	}
+	err := m.callProvider(func() error {
+		_, err := provider.Adapter().SetRecords(ctx, zone, []libdns.Record{txt})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("write ownership record: %w", err)
+	}
+	return nil
+}
+
+// refreshOwnership rewrites the hash of a hostname's ownership record after
+// some of its records were deleted (caller must hold writeMu and mu).
+func (m *Manager) refreshOwnership(ctx context.Context, provider providers.Provider, zone, hostname string) error {
+	sets := m.trackedSets(func(record *DNSRecord) bool {
+		return record.Hostname == hostname && record.ProviderName == provider.Name()
+	})
+	if len(sets) == 0 {
+		return nil
+	}
+	record := sets[0][0]
+	return m.writeOwnership(ctx, provider, zone, hostname, record.SourceID, record.TTL, m.presentValues(hostname, provider.Name()))
+}
+
+// deleteOwnership removes the ownership TXT record once its record is gone.
+func (m *Manager) deleteOwnership(ctx context.Context, provider providers.Provider, zone, hostname string) error {
+	if !m.registryEnabled(provider) {
+		return nil
+	}
+
+	txt := libdns.TXT{Name: ownershipName(relativeName(hostname, zone))}
+	err := m.callProvider(func() error {
+		_, err := provider.Adapter().DeleteRecords(ctx, zone, []libdns.Record{txt})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete ownership record: %w", err)
+	}
+	return nil
+}
+
+// relativeName returns hostname relative to zone, "@" for the apex.
+func relativeName(hostname, zone string) string {
+	return libdns.RelativeName(strings.ToLower(strings.TrimSuffix(hostname, ".")), zone)
+}
+
+// ownershipName returns the relative name of the TXT record that marks name.
+func ownershipName(name string) string {
+	if name == "" || name == "@" {
+		return ownershipPrefix
+	}
+	return ownershipPrefix + "." + name
+}
+
+// presentValues returns the types and values of the hostname's records
+// known to be at the provider (caller must hold lock).
+func (m *Manager) presentValues(hostname, providerName string) map[string]bool {
+	values := make(map[string]bool)
+	for _, record := range m.records {
+		if record.Hostname == hostname && record.ProviderName == providerName && record.State == RecordStatePresent {
+			values[string(record.RecordType)+" "+record.Value] = true
+		}
+	}
+	return values
+}
+
+// writtenValues returns the types and values the hostname of reqs holds
+// once they are written: its present records, without the RRset of reqs
+// when it is replaced, and reqs (caller must hold lock).
+func (m *Manager) writtenValues(reqs []SyncRequest, replace bool) map[string]bool {
+	req := reqs[0]
+	values := m.presentValues(req.Hostname, req.ProviderName)
+	if replace {
+		for value := range values {
+			if strings.HasPrefix(value, string(req.RecordType)+" ") {
+				delete(values, value)
+			}
+		}
+	}
+	for _, r := range reqs {
+		values[string(r.RecordType)+" "+r.Target] = true
+	}
+	return values
+}
+
+// ownershipHash fingerprints the types and values of a hostname's records.
+func ownershipHash(hostname string, values map[string]bool) string {
+	lines := make([]string, 0, len(values))
+	for value := range values {
+		recordType, data, _ := strings.Cut(value, " ")
+		lines = append(lines, recordType+" "+canonicalValue(RecordType(recordType), data))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSuffix(hostname, ".")) + "\n" + strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// canonicalValue spells a record value the same way whether it was
+// requested or read back from the provider.
+func canonicalValue(recordType RecordType, value string) string {
+	if recordType == RecordTypeCNAME {
+		return strings.ToLower(strings.TrimSuffix(value, "."))
+	}
+	if ip, err := netip.ParseAddr(value); err == nil {
+		return ip.Unmap().String()
+	}
+	return value
+}
+
+func formatOwnership(o Ownership) string {
+	return fmt.Sprintf("heritage=%s,owner=%s,source=%s,hash=%s", ownershipHeritage, o.Owner, o.SourceID, o.Hash)
+}
+
+// parseOwnership parses a TXT value written by formatOwnership. Values
+// written by anything else are rejected.
+func parseOwnership(text string) (Ownership, bool) {
+	var o Ownership
+	heritage := false
+	for _, field := range strings.Split(strings.Trim(text, `"`), ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Ownership{}, false
+		}
+		switch key {
+		case "heritage":
+			heritage = value == ownershipHeritage
+		case "owner":
+			o.Owner = value
+		case "source":
+			o.SourceID = value
+		case "hash":
+			o.Hash = value
+		}
+	}
+	if !heritage || o.Owner == "" || o.Hash == "" {
+		return Ownership{}, false
+	}
+	return o, true
+}
+
+// findOwnership returns the ownership record for the relative name, if any.
+func findOwnership(records []libdns.Record, name string) (Ownership, bool) {
+	want := ownershipName(name)
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(rr.Type, "TXT") || !strings.EqualFold(rr.Name, want) {
+			continue
+		}
+		if o, ok := parseOwnership(rr.Data); ok {
+			return o, true
+		}
+	}
+	return Ownership{}, false
+}
+
+// managedValues returns the types and values of the records at name of the
+// types this plugin manages.
+func managedValues(records []libdns.Record, name string) map[string]bool {
+	values := make(map[string]bool)
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(rr.Name, name) {
+			continue
+		}
+		switch recordType := RecordType(strings.ToUpper(rr.Type)); recordType {
+		case RecordTypeA, RecordTypeAAAA, RecordTypeCNAME:
+			values[string(recordType)+" "+rr.Data] = true
+		}
+	}
+	return values
+}
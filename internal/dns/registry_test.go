@@ -0,0 +1,351 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func TestOwnershipWritesCompanionTXTRecord(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+
+	if err := manager.CreateRecord(context.Background(), ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	txt := zone.get("_caddy-dns.app", "TXT")
+	if len(txt) != 1 {
+		t.Fatalf("ownership records = %v, want one", txt)
+	}
+	ownership, ok := parseOwnership(txt[0].RR().Data)
+	if !ok {
+		t.Fatalf("could not parse ownership record %q", txt[0].RR().Data)
+	}
+	want := Ownership{Owner: "edge-1", SourceID: "web", Hash: ownershipHash("app.example.com", map[string]bool{"A 192.0.2.10": true})}
+	if ownership != want {
+		t.Fatalf("ownership = %+v, want %+v", ownership, want)
+	}
+}
+
+func TestOwnershipRefusesRecordChangedByHand(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	ctx := context.Background()
+	if err := manager.CreateRecord(ctx, ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	// Someone points the name elsewhere and leaves the ownership record.
+	if _, err := zone.SetRecords(ctx, "example.com", []libdns.Record{libdns.Address{Name: "app", IP: netip.MustParseAddr("198.51.100.7")}}); err != nil {
+		t.Fatalf("set record: %v", err)
+	}
+
+	req := ownedRequest("web")
+	req.Target = "192.0.2.20"
+	if err := manager.UpdateRecord(ctx, req); !errors.Is(err, ErrNotOwned) {
+		t.Fatalf("update error = %v, want ErrNotOwned", err)
+	}
+	if manager.OwnsRecord(zone.all(), "app.example.com", "test", "example.com") {
+		t.Fatal("expected a record changed by hand not to be owned")
+	}
+	if err := manager.DeleteRecordsForContainer(ctx, "web"); err == nil || !strings.Contains(err.Error(), ErrNotOwned.Error()) {
+		t.Fatalf("delete error = %v, want not owned", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 1 || got[0].RR().Data != "198.51.100.7" {
+		t.Fatalf("app records = %v, want the hand-made record untouched", got)
+	}
+}
+
+func TestOwnershipWritesLostRecordsAgain(t *testing.T) {
+	zone := newMemoryZone()
+	ctx := context.Background()
+	if err := newOwnedManager(zone, "edge-1").CreateRecord(ctx, ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	zone.remove("app")
+
+	if err := newOwnedManager(zone, "edge-1").UpdateRecord(ctx, ownedRequest("web")); err != nil {
+		t.Fatalf("update record: %v", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 1 {
+		t.Fatalf("app records = %v, want the record written again", got)
+	}
+}
+
+func TestOwnershipHashCoversEveryRecordType(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	ctx := context.Background()
+	aaaa := ownedRequest("web")
+	aaaa.RecordType, aaaa.Target = RecordTypeAAAA, "2001:db8::10"
+	for _, req := range []SyncRequest{ownedRequest("web"), aaaa} {
+		if err := manager.CreateRecord(ctx, req); err != nil {
+			t.Fatalf("create %s record: %v", req.RecordType, err)
+		}
+	}
+
+	// A restarted instance without state recognises both records as its own,
+	// also once one of them is deleted.
+	if !newOwnedManager(zone, "edge-1").OwnsRecord(zone.all(), "app.example.com", "test", "example.com") {
+		t.Fatal("expected edge-1 to own the A and AAAA records")
+	}
+	if err := manager.DeleteRecordSet(ctx, "app.example.com", "test", RecordTypeAAAA, "web"); err != nil {
+		t.Fatalf("delete AAAA record: %v", err)
+	}
+	if !newOwnedManager(zone, "edge-1").OwnsRecord(zone.all(), "app.example.com", "test", "example.com") {
+		t.Fatal("expected edge-1 to own the A record left")
+	}
+}
+
+func TestOwnershipRefusesToOverwriteUnownedRecord(t *testing.T) {
+	zone := newMemoryZone()
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("198.51.100.1")})
+	manager := newOwnedManager(zone, "edge-1")
+
+	err := manager.UpdateRecord(context.Background(), ownedRequest("web"))
+	if !errors.Is(err, ErrNotOwned) {
+		t.Fatalf("update error = %v, want ErrNotOwned", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 1 || got[0].RR().Data != "198.51.100.1" {
+		t.Fatalf("app records = %v, want the hand-made record untouched", got)
+	}
+}
+
+func TestOwnershipRefusesRecordOwnedByAnotherInstance(t *testing.T) {
+	zone := newMemoryZone()
+	other := newOwnedManager(zone, "edge-2")
+	if err := other.CreateRecord(context.Background(), ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	manager := newOwnedManager(zone, "edge-1")
+	err := manager.CreateRecord(context.Background(), ownedRequest("web"))
+	if !errors.Is(err, ErrNotOwned) || !strings.Contains(err.Error(), "edge-2") {
+		t.Fatalf("create error = %v, want ErrNotOwned naming edge-2", err)
+	}
+}
+
+func TestOwnershipDeleteRemovesRecordAndTXT(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	if err := manager.CreateRecord(context.Background(), ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	if err := manager.DeleteRecord(context.Background(), "app.example.com", "test", "web"); err != nil {
+		t.Fatalf("delete record: %v", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 0 {
+		t.Fatalf("app records = %v, want none", got)
+	}
+	if got := zone.get("_caddy-dns.app", "TXT"); len(got) != 0 {
+		t.Fatalf("ownership records = %v, want none", got)
+	}
+}
+
+func TestOwnershipDeleteSkipsRecordWhoseOwnerChanged(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	if err := manager.CreateRecord(context.Background(), ownedRequest("web")); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	// Someone takes the name over by hand.
+	zone.remove("_caddy-dns.app")
+
+	err := manager.DeleteRecordsForContainer(context.Background(), "web")
+	if err == nil || !strings.Contains(err.Error(), ErrNotOwned.Error()) {
+		t.Fatalf("delete error = %v, want not owned", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 1 {
+		t.Fatalf("app records = %v, want the record left in place", got)
+	}
+	if records := manager.GetRecords(); len(records) != 0 {
+		t.Fatalf("tracked = %+v, want the unowned record forgotten", records)
+	}
+}
+
+func TestOwnershipSkipsProvidersWithoutTXT(t *testing.T) {
+	zone := newMemoryZone()
+	provider := &noTXTProvider{mockProvider{name: "test", zoneFilters: []string{"example.com"}, adapter: &mockAdapter{
+		getRecords:    zone.GetRecords,
+		appendRecords: zone.AppendRecords,
+		setRecords: func(ctx context.Context, name string, records []libdns.Record) ([]libdns.Record, error) {
+			for _, record := range records {
+				if record.RR().Type == "TXT" {
+					return nil, errors.New("TXT records are not supported")
+				}
+			}
+			return zone.SetRecords(ctx, name, records)
+		},
+		deleteRecords: zone.DeleteRecords,
+	}}}
+	manager := NewManager([]providers.Provider{provider}, WithOwnerID("edge-1"))
+	ctx := context.Background()
+
+	if _, err := manager.Sync(ctx, []SyncRequest{ownedRequest("web")}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if records := manager.GetRecords(); len(records) != 1 || records[0].State != RecordStatePresent {
+		t.Fatalf("records = %+v, want the record present", records)
+	}
+	if got := zone.get("_caddy-dns.app", "TXT"); len(got) != 0 {
+		t.Fatalf("ownership records = %v, want none", got)
+	}
+	if !manager.OwnsRecord(nil, "app.example.com", "test", "example.com") {
+		t.Fatal("expected records of a provider without TXT to be treated as owned")
+	}
+
+	if err := manager.DeleteRecordsForContainer(ctx, "web"); err != nil {
+		t.Fatalf("delete records: %v", err)
+	}
+	if got := zone.get("app", "A"); len(got) != 0 {
+		t.Fatalf("app records = %v, want none", got)
+	}
+}
+
+func TestOwnsRecord(t *testing.T) {
+	records := []libdns.Record{
+		libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")},
+		libdns.TXT{Name: "_caddy-dns.app", Text: formatOwnership(Ownership{
+			Owner:    "edge-1",
+			SourceID: "web",
+			Hash:     ownershipHash("app.example.com", map[string]bool{"A 192.0.2.10": true}),
+		})},
+	}
+
+	if !newOwnedManager(newMemoryZone(), "edge-1").OwnsRecord(records, "app.example.com", "test", "example.com") {
+		t.Fatal("expected edge-1 to own app.example.com")
+	}
+	if newOwnedManager(newMemoryZone(), "edge-2").OwnsRecord(records, "app.example.com", "test", "example.com") {
+		t.Fatal("expected edge-2 not to own app.example.com")
+	}
+	if !NewManager(nil).OwnsRecord(nil, "app.example.com", "test", "example.com") {
+		t.Fatal("expected every record to be owned when ownership is disabled")
+	}
+}
+
+func TestParseOwnershipRejectsForeignTXT(t *testing.T) {
+	for _, text := range []string{
+		"v=spf1 -all",
+		"heritage=external-dns,external-dns/owner=default",
+		"heritage=caddy-dns,source=web,hash=0123abcd",
+		"heritage=caddy-dns,owner=edge-1,source=web",
+	} {
+		if _, ok := parseOwnership(text); ok {
+			t.Fatalf("parseOwnership(%q) succeeded, want rejection", text)
+		}
+	}
+}
+
+func newOwnedManager(zone *memoryZone, owner string) *Manager {
+	provider := &mockProvider{name: "test", zoneFilters: []string{"example.com"}, adapter: &mockAdapter{
+		getRecords:    zone.GetRecords,
+		appendRecords: zone.AppendRecords,
+		setRecords:    zone.SetRecords,
+		deleteRecords: zone.DeleteRecords,
+	}}
+	return NewManager([]providers.Provider{provider}, WithOwnerID(owner))
+}
+
+// noTXTProvider is a provider that cannot store TXT records, like Pi-hole.
+type noTXTProvider struct {
+	mockProvider
+}
+
+func (p *noTXTProvider) SupportsRecordType(recordType string) bool {
+	return recordType != "TXT"
+}
+
+func ownedRequest(sourceID string) SyncRequest {
+	return SyncRequest{
+		Hostname:     "app.example.com",
+		ProviderName: "test",
+		RecordType:   RecordTypeA,
+		Target:       "192.0.2.10",
+		SourceID:     sourceID,
+	}
+}
+
+// memoryZone holds the records of a single zone keyed by name and type.
+type memoryZone struct {
+	mu      sync.Mutex
+	records map[string][]libdns.Record
+}
+
+func newMemoryZone() *memoryZone {
+	return &memoryZone{records: make(map[string][]libdns.Record)}
+}
+
+func memoryKey(rr libdns.RR) string {
+	return strings.ToLower(rr.Name) + "/" + rr.Type
+}
+
+func (z *memoryZone) put(record libdns.Record) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	key := memoryKey(record.RR())
+	z.records[key] = append(z.records[key], record)
+}
+
+func (z *memoryZone) get(name, recordType string) []libdns.Record {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.records[strings.ToLower(name)+"/"+recordType]
+}
+
+func (z *memoryZone) remove(name string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for key := range z.records {
+		if strings.HasPrefix(key, strings.ToLower(name)+"/") {
+			delete(z.records, key)
+		}
+	}
+}
+
+func (z *memoryZone) all() []libdns.Record {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var all []libdns.Record
+	for _, records := range z.records {
+		all = append(all, records...)
+	}
+	return all
+}
+
+func (z *memoryZone) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return z.all(), nil
+}
+
+func (z *memoryZone) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	for _, record := range records {
+		z.put(record)
+	}
+	return records, nil
+}
+
+func (z *memoryZone) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	z.mu.Lock()
+	for _, record := range records {
+		delete(z.records, memoryKey(record.RR()))
+	}
+	z.mu.Unlock()
+	return z.AppendRecords(context.Background(), "", records)
+}
+
+func (z *memoryZone) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, record := range records {
+		delete(z.records, memoryKey(record.RR()))
+	}
+	return records, nil
+}
@@ -0,0 +1,75 @@
+package dns
+
+import "errors"
+
+// SyncOutcome is what Sync did with one RRset.
+type SyncOutcome string
+
+const (
+	SyncOutcomeCreated   SyncOutcome = "created"
+	SyncOutcomeUpdated   SyncOutcome = "updated"
+	SyncOutcomeUnchanged SyncOutcome = "unchanged"
+	SyncOutcomeDeleted   SyncOutcome = "deleted"
+	// SyncOutcomeSkipped means the policy did not allow the change.
+	SyncOutcomeSkipped SyncOutcome = "skipped"
+	SyncOutcomeFailed  SyncOutcome = "failed"
+)
+
+// SyncEntry is the outcome of one RRset in a Sync call.
+type SyncEntry struct {
+	// Key identifies the RRset as hostname:provider:type.
+	Key          string
+	Hostname     string
+	ProviderName string
+	RecordType   RecordType
+	Outcome      SyncOutcome
+	// Requests are the requests that made up the RRset, so a failed entry
+	// can be passed to SyncRecordSets again. They are empty for deletes.
+	Requests []SyncRequest
+	// Err is set when Outcome is SyncOutcomeFailed.
+	Err error
+}
+
+// SyncResult reports what a Sync call did with every RRset it attempted, in
+// the order they were attempted. Requests rejected because another container
+// owns the hostname are not attempted; GetConflicts lists them.
+type SyncResult struct {
+	Entries []SyncEntry
+}
+
+// Count returns the number of RRsets with the given outcome.
+func (r SyncResult) Count(outcome SyncOutcome) int {
+	n := 0
+	for _, entry := range r.Entries {
+		if entry.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the requests of every RRset that failed to be created or
+// updated, ready to retry with SyncRecordSets. They are only part of their
+// containers' desired state, so passing them to Sync would delete the
+// containers' other RRsets. Failed deletes are left for the next Sync.
+func (r SyncResult) Failed() []SyncRequest {
+	var requests []SyncRequest
+	for _, entry := range r.Entries {
+		if entry.Outcome == SyncOutcomeFailed {
+			requests = append(requests, entry.Requests...)
+		}
+	}
+	return requests
+}
+
+// Err joins the errors of every failed RRset with errors.Join, or returns
+// nil when nothing failed.
+func (r SyncResult) Err() error {
+	var errs []error
+	for _, entry := range r.Entries {
+		if entry.Err != nil {
+			errs = append(errs, entry.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
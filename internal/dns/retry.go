@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+const (
+	defaultRetryBaseDelay = 30 * time.Second
+	defaultRetryMaxDelay  = 15 * time.Minute
+
+	// retryCheckInterval is how often RunRetries looks for RRsets that are
+	// due another attempt
+	retryCheckInterval = 5 * time.Second
+)
+
+// retryState is the backoff of an RRset left in the error state
+type retryState struct {
+	attempts  int
+	next      time.Time
+	permanent bool // the last failure will not go away by retrying
+}
+
+// WithRetryBackoff sets the backoff for rewriting RRsets left in the error
+// state: base after the first failure, doubling up to max.
+func WithRetryBackoff(base, max time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.retryBase = base
+		m.retryMax = max
+	}
+}
+
+// RunRetries re-queues RRsets that failed to write until ctx is done.
+func (m *Manager) RunRetries(ctx context.Context) {
+	ticker := time.NewTicker(retryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		retried, err := m.RetryFailed(ctx)
+		if err != nil {
+			m.logger.Warn("retry of failed records did not succeed",
+				zap.Int("retried", retried),
+				zap.Error(err))
+		} else if retried > 0 {
+			m.logger.Info("retried failed records", zap.Int("retried", retried))
+		}
+	}
+}
+
+// RetryFailed rewrites the RRsets a failed provider call left in the error
+// state once their backoff has passed, and returns how many it tried. A set
+// that fails again waits twice as long, up to the maximum delay. Sets that
+// failed permanently, e.g. because the provider rejected the record, are
+// left for the next sync to change. Under PolicyCreateOnly nothing is
+// retried: a retry replaces the RRset, which the policy rules out, and
+// appending again could duplicate records a failed append still created.
+func (m *Manager) RetryFailed(ctx context.Context) (int, error) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.saveState()
+
+	now := time.Now()
+	failed := m.trackedSets(func(record *DNSRecord) bool {
+		return record.State == RecordStateError
+	})
+
+	pending := make(map[string]bool, len(failed))
+	retried := 0
+	var errs []error
+	for _, set := range failed {
+		first := set[0]
+		key := rrsetKey(first.Hostname, first.ProviderName, first.RecordType)
+		pending[key] = true
+
+		// The failure was not seen by this process, e.g. it was restored
+		// from saved state; wait before the first retry
+		retry, ok := m.retries[key]
+		if !ok {
+			m.scheduleRetry(key, nil)
+			continue
+		}
+		if retry.permanent || now.Before(retry.next) {
+			continue
+		}
+
+		reqs := make([]SyncRequest, 0, len(set))
+		for _, record := range set {
+			reqs = append(reqs, recordRequest(record))
+		}
+
+		// Setting the RRset is safe to repeat even if an earlier append
+		// reached the provider
+		retried++
+		attempts := retry.attempts
+		if err := m.writeRecordSet(ctx, reqs, true); err != nil {
+			// Failures before the provider call leave the backoff to us
+			if retry.attempts == attempts {
+				m.scheduleRetry(key, err)
+			}
+			errs = append(errs, fmt.Errorf("retry record %s: %w", key, err))
+			continue
+		}
+		delete(m.retries, key)
+		delete(pending, key)
+	}
+
+	// Forget the backoff of sets a sync fixed or removed in the meantime
+	for key := range m.retries {
+		if !pending[key] {
+			delete(m.retries, key)
+		}
+	}
+
+	return retried, errors.Join(errs...)
+}
+
+// scheduleRetry counts a failure of the RRset key and sets when to try
+// again, or marks the set terminal when err is permanent or the policy does
+// not allow retrying it. A nil err counts as transient (caller must hold lock)
+func (m *Manager) scheduleRetry(key string, err error) {
+	retry, ok := m.retries[key]
+	if !ok {
+		retry = &retryState{}
+		m.retries[key] = retry
+	}
+	retry.attempts++
+	retry.next = time.Now().Add(providers.Backoff(m.retryBase, m.retryMax, retry.attempts))
+
+	retryable, _ := providers.IsRetryable(err)
+	switch {
+	case !m.policy.AllowsUpdate():
+		retry.permanent = true
+		m.logger.Warn("record failed; not retrying as the policy does not allow updates",
+			zap.String("rrset", key),
+			zap.String("policy", string(m.policy)),
+			zap.Error(err))
+	case err != nil && !retryable:
+		retry.permanent = true
+		m.logger.Warn("record failed permanently; not retrying until the next sync changes it",
+			zap.String("rrset", key),
+			zap.Error(err))
+	default:
+		retry.permanent = false
+	}
+}
+
+// recordRequest rebuilds the sync request a tracked record was written from
+func recordRequest(record *DNSRecord) SyncRequest {
+	ttl := record.TTL
+	proxied := record.Proxied
+	return SyncRequest{
+		Hostname:     record.Hostname,
+		ProviderName: record.ProviderName,
+		RecordType:   record.RecordType,
+		Target:       record.Value,
+		SourceID:     record.SourceID,
+		TTL:          &ttl,
+		Proxied:      &proxied,
+		Priority:     record.Priority,
+	}
+}
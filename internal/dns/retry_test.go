@@ -0,0 +1,176 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func TestRetryFailedRequeuesRecordSets(t *testing.T) {
+	appendErr := &providers.APIError{API: "test", StatusCode: 503, Message: "provider unavailable"}
+	setFailures := 1
+	var set [][]libdns.Record
+	adapter := &mockAdapter{
+		appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			return nil, appendErr
+		},
+		setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			if setFailures > 0 {
+				setFailures--
+				return nil, &providers.APIError{API: "test", StatusCode: 503, Message: "still unavailable"}
+			}
+			set = append(set, records)
+			return records, nil
+		},
+	}
+	provider := &mockProvider{
+		name:        "cloudflare",
+		zoneFilters: []string{"example.com"},
+		adapter:     adapter,
+	}
+	manager := NewManager([]providers.Provider{provider}, WithRetryBackoff(0, 0))
+	ctx := context.Background()
+
+	request := func(target string) SyncRequest {
+		return SyncRequest{
+			Hostname:     "app.example.com",
+			ProviderName: "cloudflare",
+			RecordType:   RecordTypeA,
+			Target:       target,
+			SourceID:     "container123",
+		}
+	}
+	if _, err := manager.Sync(ctx, []SyncRequest{request("192.168.1.10"), request("192.168.1.11")}); !errors.Is(err, appendErr) {
+		t.Fatalf("Sync error = %v, want the append failure", err)
+	}
+
+	if retried, err := manager.RetryFailed(ctx); retried != 1 || err == nil {
+		t.Fatalf("RetryFailed = %d, %v, want one failed retry", retried, err)
+	}
+	if retried, err := manager.RetryFailed(ctx); retried != 1 || err != nil {
+		t.Fatalf("RetryFailed = %d, %v, want one successful retry", retried, err)
+	}
+
+	if len(set) != 1 || len(set[0]) != 2 {
+		t.Fatalf("set = %v, want the whole RRset in one call", set)
+	}
+	for _, record := range manager.GetRecords() {
+		if record.State != RecordStatePresent {
+			t.Fatalf("record %s state = %s, want present", record.Value, record.State)
+		}
+	}
+	if retried, err := manager.RetryFailed(ctx); retried != 0 || err != nil {
+		t.Fatalf("RetryFailed = %d, %v, want nothing left to retry", retried, err)
+	}
+}
+
+func TestRetryFailedWaitsForBackoff(t *testing.T) {
+	adapter := &mockAdapter{
+		appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			return nil, &providers.APIError{API: "test", StatusCode: 503, Message: "provider unavailable"}
+		},
+	}
+	provider := &mockProvider{
+		name:        "cloudflare",
+		zoneFilters: []string{"example.com"},
+		adapter:     adapter,
+	}
+	manager := NewManager([]providers.Provider{provider}, WithRetryBackoff(time.Hour, time.Hour))
+	ctx := context.Background()
+
+	manager.Sync(ctx, []SyncRequest{{
+		Hostname:     "app.example.com",
+		ProviderName: "cloudflare",
+		RecordType:   RecordTypeA,
+		Target:       "192.168.1.10",
+		SourceID:     "container123",
+	}})
+
+	for i := 0; i < 2; i++ {
+		if retried, err := manager.RetryFailed(ctx); retried != 0 || err != nil {
+			t.Fatalf("RetryFailed = %d, %v, want the set to wait for its backoff", retried, err)
+		}
+	}
+}
+
+func TestRetryFailedSkipsPermanentFailures(t *testing.T) {
+	sets := 0
+	adapter := &mockAdapter{
+		appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			return nil, &providers.APIError{API: "test", StatusCode: 400, Message: "invalid record"}
+		},
+		setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			sets++
+			return records, nil
+		},
+	}
+	provider := &mockProvider{
+		name:        "cloudflare",
+		zoneFilters: []string{"example.com"},
+		adapter:     adapter,
+	}
+	manager := NewManager([]providers.Provider{provider}, WithRetryBackoff(0, 0))
+	ctx := context.Background()
+
+	manager.Sync(ctx, []SyncRequest{{
+		Hostname:     "app.example.com",
+		ProviderName: "cloudflare",
+		RecordType:   RecordTypeA,
+		Target:       "192.168.1.10",
+		SourceID:     "container123",
+	}})
+
+	for i := 0; i < 2; i++ {
+		if retried, err := manager.RetryFailed(ctx); retried != 0 || err != nil {
+			t.Fatalf("RetryFailed = %d, %v, want the permanent failure left alone", retried, err)
+		}
+	}
+	if sets != 0 {
+		t.Fatalf("sets = %d, want no rewrite", sets)
+	}
+	if records := manager.GetRecords(); len(records) != 1 || records[0].State != RecordStateError {
+		t.Fatalf("records = %+v, want the record left in the error state", records)
+	}
+}
+
+func TestRetryFailedLeavesCreateOnlyAppends(t *testing.T) {
+	appends, sets := 0, 0
+	adapter := &mockAdapter{
+		appendRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			appends++
+			return nil, &providers.APIError{API: "test", StatusCode: 503, Message: "provider unavailable"}
+		},
+		setRecords: func(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+			sets++
+			return records, nil
+		},
+	}
+	provider := &mockProvider{
+		name:        "cloudflare",
+		zoneFilters: []string{"example.com"},
+		adapter:     adapter,
+	}
+	manager := NewManager([]providers.Provider{provider}, WithRetryBackoff(0, 0), WithPolicy(PolicyCreateOnly))
+	ctx := context.Background()
+
+	manager.Sync(ctx, []SyncRequest{{
+		Hostname:     "app.example.com",
+		ProviderName: "cloudflare",
+		RecordType:   RecordTypeA,
+		Target:       "192.168.1.10",
+		SourceID:     "container123",
+	}})
+
+	for i := 0; i < 2; i++ {
+		if retried, err := manager.RetryFailed(ctx); retried != 0 || err != nil {
+			t.Fatalf("RetryFailed = %d, %v, want the failed append left alone", retried, err)
+		}
+	}
+	if appends != 1 || sets != 0 {
+		t.Fatalf("appends = %d, sets = %d, want only the first append", appends, sets)
+	}
+}
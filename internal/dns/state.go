@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/atomicfile"
+)
+
+const stateFileVersion = 1
+
+// StateStore persists the records a Manager owns so they survive restarts.
+type StateStore interface {
+	// Load returns the previously saved records. A store that has never been
+	// saved returns no records and no error.
+	Load() ([]DNSRecord, error)
+	// Save replaces the stored records with records.
+	Save(records []DNSRecord) error
+}
+
+// FileStateStore is a StateStore backed by a JSON file. Saves write a
+// temporary file in the same directory and rename it over the old one, so a
+// crash leaves either the previous or the new state on disk.
+type FileStateStore struct {
+	path string
+}
+
+// NewFileStateStore returns a store that keeps its state at path. The parent
+// directory is created on the first save.
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+// Path returns the file the store reads and writes.
+func (s *FileStateStore) Path() string {
+	return s.path
+}
+
+type stateFile struct {
+	Version int         `json:"version"`
+	Records []DNSRecord `json:"records"`
+}
+
+// Load reads the state file. A missing file is not an error.
+func (s *FileStateStore) Load() ([]DNSRecord, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decode state file %s: %w", s.path, err)
+	}
+	if state.Version != stateFileVersion {
+		return nil, fmt.Errorf("state file %s has unsupported version %d", s.path, state.Version)
+	}
+	return state.Records, nil
+}
+
+// Save atomically replaces the state file with records.
+func (s *FileStateStore) Save(records []DNSRecord) error {
+	sorted := make([]DNSRecord, len(records))
+	copy(sorted, records)
+	sort.Slice(sorted, func(i, j int) bool {
+		return recordKey(sorted[i].Hostname, sorted[i].ProviderName, sorted[i].RecordType, sorted[i].Value) <
+			recordKey(sorted[j].Hostname, sorted[j].ProviderName, sorted[j].RecordType, sorted[j].Value)
+	})
+
+	data, err := json.MarshalIndent(stateFile{Version: stateFileVersion, Records: sorted}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("save state file: %w", err)
+	}
+
+	return nil
+}
+
+// Interface guard
+var _ StateStore = (*FileStateStore)(nil)
@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func TestFileStateStoreRoundTrip(t *testing.T) {
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "nested", "state.json"))
+
+	records, err := store.Load()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("load before save = %v, %v; want no records and no error", records, err)
+	}
+
+	want := DNSRecord{
+		ID:           "rec-1",
+		Hostname:     "app.example.com",
+		RecordType:   RecordTypeA,
+		Value:        "192.0.2.10",
+		TTL:          120,
+		ProviderName: "test",
+		LastSyncAt:   time.Date(2026, 2, 2, 12, 0, 0, 0, time.UTC),
+		State:        RecordStatePresent,
+		SourceID:     "web",
+	}
+	if err := store.Save([]DNSRecord{want}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	records, err = store.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(records) != 1 || records[0] != want {
+		t.Fatalf("records = %+v, want [%+v]", records, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(store.Path()))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("state directory has %d entries, want only the state file", len(entries))
+	}
+}
+
+func TestFileStateStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	_, err := NewFileStateStore(path).Load()
+	if err == nil || !strings.Contains(err.Error(), "decode state file") {
+		t.Fatalf("expected decode error, got %v", err)
+	}
+}
+
+func TestManagerPersistsRecordsAcrossRestart(t *testing.T) {
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	var deleted []libdns.Record
+	adapter := &mockAdapter{
+		deleteRecords: func(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+			deleted = append(deleted, records...)
+			return records, nil
+		},
+	}
+	provider := &mockProvider{name: "test", zoneFilters: []string{"example.com"}, adapter: adapter}
+
+	first := NewManager([]providers.Provider{provider}, WithStateStore(store))
+	if err := first.CreateRecord(context.Background(), SyncRequest{
+		Hostname:     "app.example.com",
+		ProviderName: "test",
+		RecordType:   RecordTypeA,
+		Target:       "192.0.2.10",
+		SourceID:     "web",
+	}); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	// The container goes away while the process is down.
+	restarted := NewManager([]providers.Provider{provider}, WithStateStore(store))
+	if records := restarted.GetRecords(); len(records) != 1 || records[0].SourceID != "web" {
+		t.Fatalf("restored records = %+v, want the record owned by web", records)
+	}
+
+	if err := restarted.DeleteRecordsForContainer(context.Background(), "web"); err != nil {
+		t.Fatalf("delete records: %v", err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("deleted = %d, want 1", len(deleted))
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(stored) != 0 {
+		t.Fatalf("stored records = %+v, want none after delete", stored)
+	}
+}
+
+func TestManagerDropsStoredRecordsForUnknownProviders(t *testing.T) {
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err := store.Save([]DNSRecord{{Hostname: "app.example.com", ProviderName: "removed", Value: "192.0.2.10"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	manager := NewManager(nil, WithStateStore(store))
+	if records := manager.GetRecords(); len(records) != 0 {
+		t.Fatalf("records = %+v, want none", records)
+	}
+}
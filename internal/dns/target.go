@@ -0,0 +1,149 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// targetTimeout bounds how long ComputeDesiredState waits for a resolver.
+const targetTimeout = 10 * time.Second
+
+// TargetResolver supplies the addresses a provider's records point at in
+// place of the container's own addresses, such as the reverse proxy's
+// public IP.
+type TargetResolver interface {
+	Addresses(ctx context.Context) ([]netip.Addr, error)
+}
+
+// WithTargetResolver points the A and AAAA records of the named provider at
+// the addresses resolver returns. Containers with an explicit target label
+// are unaffected.
+func WithTargetResolver(providerName string, resolver TargetResolver) ManagerOption {
+	return func(m *Manager) {
+		if resolver == nil {
+			return
+		}
+		if m.targets == nil {
+			m.targets = make(map[string]TargetResolver)
+			m.lastTargets = make(map[string][]netip.Addr)
+		}
+		m.targets[providerName] = resolver
+	}
+}
+
+// resolverTargets asks the provider's resolver for its addresses, split by
+// family. It reports false when the provider has no resolver. When the
+// resolver fails it falls back to the addresses it last returned, and only
+// errors when there are none, so that a failed lookup never looks like the
+// container asking for no records.
+func (m *Manager) resolverTargets(providerName string) (ipv4, ipv6 []string, ok bool, err error) {
+	resolver, ok := m.targets[providerName]
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), targetTimeout)
+	defer cancel()
+	addrs, err := resolver.Addresses(ctx)
+
+	m.targetMu.Lock()
+	if err == nil {
+		m.lastTargets[providerName] = addrs
+	} else if last, known := m.lastTargets[providerName]; known {
+		m.logger.Warn("could not resolve target address, using the last known addresses",
+			zap.String("provider", providerName),
+			zap.Error(err))
+		addrs, err = last, nil
+	}
+	m.targetMu.Unlock()
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("resolve target address for provider %q: %w", providerName, err)
+	}
+
+	for _, addr := range addrs {
+		if addr.Unmap().Is4() {
+			ipv4 = append(ipv4, addr.Unmap().String())
+		} else {
+			ipv6 = append(ipv6, addr.String())
+		}
+	}
+	return ipv4, ipv6, true, nil
+}
+
+// RetargetRecords points the provider's tracked records whose value is from
+// at to instead, replacing each affected RRset with one SetRecords call. It
+// returns how many records were moved; records that fail are left for
+// reconciliation.
+func (m *Manager) RetargetRecords(ctx context.Context, providerName string, from, to netip.Addr) (int, error) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.saveState()
+
+	from, to = from.Unmap(), to.Unmap()
+	if from == to || from.Is4() != to.Is4() || !m.policy.AllowsUpdate() {
+		return 0, nil
+	}
+
+	sets := m.trackedSets(func(record *DNSRecord) bool {
+		return record.ProviderName == providerName && record.RecordType != RecordTypeCNAME
+	})
+
+	moved := 0
+	var errs []error
+	for _, set := range sets {
+		var requests []SyncRequest
+		seen := make(map[string]bool)
+		count := 0
+		for _, record := range set {
+			target := record.Value
+			if value, err := netip.ParseAddr(record.Value); err == nil && value.Unmap() == from {
+				target = to.String()
+				count++
+			}
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+
+			ttl := record.TTL
+			var proxied *bool
+			if record.Proxied {
+				proxied = &record.Proxied
+			}
+			requests = append(requests, SyncRequest{
+				Hostname:     record.Hostname,
+				ProviderName: record.ProviderName,
+				RecordType:   record.RecordType,
+				Target:       target,
+				SourceID:     record.SourceID,
+				RequestedAt:  time.Now(),
+				TTL:          &ttl,
+				Proxied:      proxied,
+				Priority:     record.Priority,
+			})
+		}
+		if count == 0 {
+			continue
+		}
+
+		hostname := set[0].Hostname
+		if err := m.writeRecordSet(ctx, requests, true); err != nil {
+			errs = append(errs, fmt.Errorf("retarget %s: %w", hostname, err))
+			continue
+		}
+		moved += count
+		m.logger.Info("moved record to new address",
+			zap.String("hostname", hostname),
+			zap.String("provider", providerName),
+			zap.Stringer("old", from),
+			zap.Stringer("new", to))
+	}
+	return moved, errors.Join(errs...)
+}
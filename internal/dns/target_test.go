@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+)
+
+func TestRetargetRecordsMovesRecordsOnOldAddress(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	ctx := context.Background()
+
+	moving := ownedRequest("web")
+	moving.Target = "203.0.113.1"
+	moving.Priority = 5
+	staying := ownedRequest("api")
+	staying.Hostname = "api.example.com"
+	staying.Target = "198.51.100.9"
+	for _, req := range []SyncRequest{moving, staying} {
+		if err := manager.CreateRecord(ctx, req); err != nil {
+			t.Fatalf("create %s: %v", req.Hostname, err)
+		}
+	}
+
+	moved, err := manager.RetargetRecords(ctx, "test", netip.MustParseAddr("203.0.113.1"), netip.MustParseAddr("203.0.113.2"))
+	if err != nil {
+		t.Fatalf("retarget: %v", err)
+	}
+	if moved != 1 {
+		t.Fatalf("moved = %d, want 1", moved)
+	}
+
+	if records := zone.get("app", "A"); len(records) != 1 || records[0].RR().Data != "203.0.113.2" {
+		t.Fatalf("app records = %v, want 203.0.113.2", records)
+	}
+	if records := zone.get("api", "A"); len(records) != 1 || records[0].RR().Data != "198.51.100.9" {
+		t.Fatalf("api records = %v, want them untouched", records)
+	}
+	for _, record := range manager.GetRecords() {
+		if record.Hostname == "app.example.com" && (record.Value != "203.0.113.2" || record.SourceID != "web" || record.Priority != 5) {
+			t.Fatalf("tracked record = %+v, want value 203.0.113.2 from web with priority 5", record)
+		}
+	}
+}
+
+func TestRetargetRecordsIgnoresOtherProvidersAndFamilies(t *testing.T) {
+	zone := newMemoryZone()
+	manager := newOwnedManager(zone, "edge-1")
+	ctx := context.Background()
+
+	req := ownedRequest("web")
+	req.Target = "203.0.113.1"
+	if err := manager.CreateRecord(ctx, req); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	from := netip.MustParseAddr("203.0.113.1")
+	for _, tt := range []struct {
+		provider string
+		to       netip.Addr
+	}{
+		{provider: "other", to: netip.MustParseAddr("203.0.113.2")},
+		{provider: "test", to: netip.MustParseAddr("2001:db8::2")},
+	} {
+		moved, err := manager.RetargetRecords(ctx, tt.provider, from, tt.to)
+		if err != nil || moved != 0 {
+			t.Fatalf("retarget %s to %s = %d, %v; want nothing moved", tt.provider, tt.to, moved, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultMaxReconnectDelay = 30 * time.Second
+
+	// The host part is ignored when dialing the unix socket but must be a
+	// valid URL authority.
+	socketBaseURL = "http://docker"
+)
+
+// Client talks to the Docker Engine API over its unix socket. It implements
+// EventSource and is shared with the container inspector.
+type Client struct {
+	http              *http.Client
+	baseURL           string
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	logger            *zap.Logger
+}
+
+// NewClient returns a client for the Docker daemon listening on socket.
+// logger, if not nil, reports event stream reconnects.
+func NewClient(socket string, logger *zap.Logger) *Client {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &Client{
+		http:              &http.Client{Transport: transport},
+		baseURL:           socketBaseURL,
+		reconnectDelay:    defaultReconnectDelay,
+		maxReconnectDelay: defaultMaxReconnectDelay,
+		logger:            logger,
+	}
+}
+
+// APIError is returned when the daemon answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker api: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Events streams container (and optionally service) events from the daemon.
+// When the stream drops it reconnects with exponential backoff, resuming from
+// the last event seen so nothing is missed, and logs each attempt with the
+// error that caused it. Only errors the daemon will keep returning, such as
+// rejected filters, are sent on the error channel.
+func (c *Client) Events(ctx context.Context, filters Filters) (<-chan Event, <-chan error) {
+	out := make(chan Event)
+	errs := make(chan error, 1)
+
+	go c.streamEvents(ctx, filters, out, errs)
+
+	return out, errs
+}
+
+func (c *Client) streamEvents(ctx context.Context, filters Filters, out chan<- Event, errs chan<- error) {
+	defer close(out)
+	defer close(errs)
+
+	var since int64
+	delay := c.reconnectDelay
+	attempt := 0
+
+	for {
+		connectedAt := time.Now().UnixNano()
+		last, err := c.readEvents(ctx, filters, since, out)
+		switch {
+		case last > since:
+			since = last
+			delay = c.reconnectDelay
+			attempt = 0
+		case since == 0:
+			// Nothing arrived before the drop; resume from when we connected
+			// so events emitted while reconnecting are not lost.
+			since = connectedAt
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+			errs <- err
+			return
+		}
+
+		attempt++
+		if err == nil {
+			err = errors.New("stream closed by the daemon")
+		}
+		c.logger.Warn("docker event stream dropped; reconnecting",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Duration("max_delay", c.maxReconnectDelay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > c.maxReconnectDelay {
+			delay = c.maxReconnectDelay
+		}
+	}
+}
+
+// readEvents consumes a single /events stream until it ends and returns the
+// timestamp (in nanoseconds) of the last event delivered.
+func (c *Client) readEvents(ctx context.Context, filters Filters, since int64, out chan<- Event) (int64, error) {
+	query := url.Values{}
+	query.Set("filters", encodeFilters(filters))
+	if since > 0 {
+		query.Set("since", formatSince(since))
+	}
+
+	resp, err := c.do(ctx, "/events", query)
+	if err != nil {
+		return since, err
+	}
+	defer resp.Body.Close()
+
+	last := since
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var message eventMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return last, nil
+			}
+			return last, fmt.Errorf("decode docker event: %w", err)
+		}
+
+		// Resuming with "since" replays events from the same instant; skip
+		// anything already delivered.
+		if message.TimeNano != 0 && message.TimeNano <= last {
+			continue
+		}
+
+		select {
+		case out <- message.event():
+		case <-ctx.Done():
+			return last, ctx.Err()
+		}
+
+		if message.TimeNano > last {
+			last = message.TimeNano
+		}
+	}
+}
+
+// do issues a GET request against the daemon and returns the response when
+// the status is 2xx.
+func (c *Client) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api %s: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// getJSON issues a GET request and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v any) error {
+	resp, err := c.do(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func decodeAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	message := string(body)
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Message != "" {
+		message = payload.Message
+	}
+
+	return &APIError{StatusCode: resp.StatusCode, Message: message}
+}
+
+type eventMessage struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	Time     int64 `json:"time"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (m eventMessage) event() Event {
+	when := time.Unix(m.Time, 0)
+	if m.TimeNano != 0 {
+		when = time.Unix(0, m.TimeNano)
+	}
+
+	return Event{
+		ID:         m.Actor.ID,
+		Name:       m.Actor.Attributes["name"],
+		Type:       m.Type,
+		Action:     m.Action,
+		Attributes: m.Actor.Attributes,
+		Time:       when,
+	}
+}
+
+func encodeFilters(filters Filters) string {
+	values := make(map[string][]string)
+	if len(filters.Types) > 0 {
+		values["type"] = filters.Types
+	}
+	if len(filters.Actions) > 0 {
+		values["event"] = filters.Actions
+	}
+
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+func formatSince(nanos int64) string {
+	return fmt.Sprintf("%d.%09d", nanos/int64(time.Second), nanos%int64(time.Second))
+}
+
+// Interface guard
+var _ EventSource = (*Client)(nil)
@@ -0,0 +1,215 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestClientEventsDecodesRecordedStream(t *testing.T) {
+	recorded := loadRecordedEvents(t)
+
+	var query atomic.Value
+	client := newSocketClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			http.NotFound(w, r)
+			return
+		}
+		query.Store(r.URL.Query().Get("filters"))
+		replay(w, recorded)
+		<-r.Context().Done()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, errs := client.Events(ctx, buildEventFilters(Options{}))
+	got := collectEvents(t, events, errs, len(recorded))
+
+	if got[0].ID != "4f7c1e2d9a3b" || got[0].Action != "create" || got[0].Type != EventTypeContainer {
+		t.Fatalf("unexpected first event: %+v", got[0])
+	}
+	if got[0].Name != "web" {
+		t.Fatalf("name = %q, want %q", got[0].Name, "web")
+	}
+	if got[0].Attributes["caddy_dns.provider"] != "cloudflare" {
+		t.Fatalf("attributes = %v, want caddy_dns.provider label", got[0].Attributes)
+	}
+	if !got[2].Time.Equal(time.Unix(0, 1770033660300000000)) {
+		t.Fatalf("time = %s, want nanosecond timestamp", got[2].Time)
+	}
+
+	var filters map[string][]string
+	if err := json.Unmarshal([]byte(query.Load().(string)), &filters); err != nil {
+		t.Fatalf("decode filters query: %v", err)
+	}
+	if !contains(filters["type"], EventTypeContainer) {
+		t.Fatalf("type filter = %v, want container", filters["type"])
+	}
+	if !contains(filters["event"], "die") {
+		t.Fatalf("event filter = %v, want die", filters["event"])
+	}
+}
+
+func TestClientEventsReconnectsAfterDrop(t *testing.T) {
+	recorded := loadRecordedEvents(t)
+
+	var connections atomic.Int32
+	var resumedSince atomic.Value
+	client := newSocketClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch connections.Add(1) {
+		case 1:
+			// Deliver the first event, then drop the stream.
+			replay(w, recorded[:1])
+		default:
+			resumedSince.Store(r.URL.Query().Get("since"))
+			// The daemon replays from "since" inclusively.
+			replay(w, recorded)
+			<-r.Context().Done()
+		}
+	}))
+
+	core, logs := observer.New(zap.WarnLevel)
+	client.logger = zap.New(core)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, errs := client.Events(ctx, buildEventFilters(Options{}))
+	got := collectEvents(t, events, errs, len(recorded))
+
+	for i, event := range got {
+		if event.Action != recorded[i].Action {
+			t.Fatalf("event %d action = %q, want %q", i, event.Action, recorded[i].Action)
+		}
+	}
+	if connections.Load() < 2 {
+		t.Fatalf("connections = %d, want reconnect", connections.Load())
+	}
+	if since := resumedSince.Load(); since != "1770033600.100000000" {
+		t.Fatalf("since = %v, want %q", since, "1770033600.100000000")
+	}
+
+	reconnects := logs.FilterMessage("docker event stream dropped; reconnecting").All()
+	if len(reconnects) == 0 {
+		t.Fatal("reconnect was not logged")
+	}
+	fields := reconnects[0].ContextMap()
+	if fields["attempt"] != int64(1) || fields["delay"] != 10*time.Millisecond || fields["error"] == nil {
+		t.Fatalf("reconnect log fields = %v, want attempt 1, the delay and the error", fields)
+	}
+}
+
+func TestClientEventsReportsRejectedFilters(t *testing.T) {
+	client := newSocketClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message":"invalid filter 'event=bogus'"}`))
+	}))
+
+	events, errs := client.Events(context.Background(), Filters{Actions: []string{"bogus"}})
+
+	select {
+	case err := <-errs:
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 APIError, got %v", err)
+		}
+		if apiErr.Message != "invalid filter 'event=bogus'" {
+			t.Fatalf("message = %q", apiErr.Message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected event channel to be closed")
+	}
+}
+
+func newSocketClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen on unix socket: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	client := NewClient(socket, nil)
+	client.reconnectDelay = 10 * time.Millisecond
+	client.maxReconnectDelay = 50 * time.Millisecond
+	return client
+}
+
+func loadRecordedEvents(t *testing.T) []eventMessage {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join("testdata", "events.jsonl"))
+	if err != nil {
+		t.Fatalf("open recorded events: %v", err)
+	}
+	defer file.Close()
+
+	var messages []eventMessage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message eventMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("decode recorded event: %v", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func replay(w http.ResponseWriter, messages []eventMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for _, message := range messages {
+		_ = encoder.Encode(message)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+func collectEvents(t *testing.T, events <-chan Event, errs <-chan error, n int) []Event {
+	t.Helper()
+
+	var got []Event
+	timeout := time.After(2 * time.Second)
+	for len(got) < n {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("event stream closed after %d events", len(got))
+			}
+			got = append(got, event)
+		case err := <-errs:
+			t.Fatalf("unexpected error: %v", err)
+		case <-timeout:
+			t.Fatalf("timed out after %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+)
+
+// Inspector turns Docker containers into dns.ContainerInfo values for the DNS
+// manager.
+type Inspector struct {
+	client *Client
+}
+
+// NewInspector returns an inspector backed by client.
+func NewInspector(client *Client) *Inspector {
+	return &Inspector{client: client}
+}
+
+// ListRunning inspects every running container. Containers that disappear
+// between listing and inspection are skipped.
+func (i *Inspector) ListRunning(ctx context.Context) ([]dns.ContainerInfo, error) {
+	var summaries []struct {
+		ID string `json:"Id"`
+	}
+	if err := i.client.getJSON(ctx, "/containers/json", nil, &summaries); err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	containers := make([]dns.ContainerInfo, 0, len(summaries))
+	for _, summary := range summaries {
+		info, err := i.Inspect(ctx, summary.ID)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !info.IsRunning {
+			continue
+		}
+		containers = append(containers, info)
+	}
+
+	return containers, nil
+}
+
+// Inspect returns the DNS-relevant details of a single container.
+func (i *Inspector) Inspect(ctx context.Context, id string) (dns.ContainerInfo, error) {
+	var payload inspectResponse
+	if err := i.client.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &payload); err != nil {
+		return dns.ContainerInfo{}, fmt.Errorf("inspect container %s: %w", id, err)
+	}
+
+	return payload.containerInfo(), nil
+}
+
+// IsNotFound reports whether err is the daemon saying the object does not
+// exist, e.g. a container that was removed before it could be inspected.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type inspectResponse struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (r inspectResponse) containerInfo() dns.ContainerInfo {
+	info := dns.ContainerInfo{
+		ID:        r.ID,
+		Name:      strings.TrimPrefix(r.Name, "/"),
+		Labels:    r.Config.Labels,
+		State:     r.State.Status,
+		IsRunning: r.State.Running,
+	}
+	if info.Labels == nil {
+		info.Labels = map[string]string{}
+	}
+
+	// Walk networks in name order so the first address is stable.
+	names := make([]string, 0, len(r.NetworkSettings.Networks))
+	for name := range r.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		network := r.NetworkSettings.Networks[name]
+		info.IPV4 = appendUnique(info.IPV4, network.IPAddress)
+		info.IPV6 = appendUnique(info.IPV6, network.GlobalIPv6Address)
+	}
+
+	return info
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const fakeContainerList = `[
+	{"Id": "aaa111", "Names": ["/web"], "State": "running"},
+	{"Id": "bbb222", "Names": ["/gone"], "State": "running"},
+	{"Id": "ccc333", "Names": ["/dual"], "State": "running"}
+]`
+
+var fakeInspections = map[string]string{
+	"aaa111": `{
+		"Id": "aaa111",
+		"Name": "/web",
+		"State": {"Status": "running", "Running": true},
+		"Config": {"Labels": {"caddy_dns.hostname": "app.example.com", "caddy_dns.provider": "cloudflare"}},
+		"NetworkSettings": {"Networks": {
+			"proxy": {"IPAddress": "172.20.0.5", "GlobalIPv6Address": ""},
+			"bridge": {"IPAddress": "172.17.0.2", "GlobalIPv6Address": ""}
+		}}
+	}`,
+	"ccc333": `{
+		"Id": "ccc333",
+		"Name": "/dual",
+		"State": {"Status": "running", "Running": true},
+		"Config": {"Labels": null},
+		"NetworkSettings": {"Networks": {
+			"v6net": {"IPAddress": "172.30.0.9", "GlobalIPv6Address": "2001:db8::9"}
+		}}
+	}`,
+	"ddd444": `{
+		"Id": "ddd444",
+		"Name": "/stopped",
+		"State": {"Status": "exited", "Running": false},
+		"Config": {"Labels": {}},
+		"NetworkSettings": {"Networks": {}}
+	}`,
+}
+
+func newFakeDockerAPI(t *testing.T) *Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(fakeContainerList))
+	})
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		body, ok := fakeInspections[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No such container: ` + r.PathValue("id") + `"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+
+	return newSocketClient(t, mux)
+}
+
+func TestInspectorInspect(t *testing.T) {
+	inspector := NewInspector(newFakeDockerAPI(t))
+
+	info, err := inspector.Inspect(context.Background(), "aaa111")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+
+	if info.ID != "aaa111" || info.Name != "web" {
+		t.Fatalf("id/name = %q/%q, want aaa111/web", info.ID, info.Name)
+	}
+	if !info.IsRunning || info.State != "running" {
+		t.Fatalf("state = %q running=%v, want running", info.State, info.IsRunning)
+	}
+	if info.Labels["caddy_dns.hostname"] != "app.example.com" {
+		t.Fatalf("labels = %v", info.Labels)
+	}
+	// Networks are walked in name order: bridge before proxy.
+	if want := []string{"172.17.0.2", "172.20.0.5"}; !reflect.DeepEqual(info.IPV4, want) {
+		t.Fatalf("ipv4 = %v, want %v", info.IPV4, want)
+	}
+	if len(info.IPV6) != 0 {
+		t.Fatalf("ipv6 = %v, want none", info.IPV6)
+	}
+}
+
+func TestInspectorInspectNotFound(t *testing.T) {
+	inspector := NewInspector(newFakeDockerAPI(t))
+
+	_, err := inspector.Inspect(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestInspectorInspectStopped(t *testing.T) {
+	inspector := NewInspector(newFakeDockerAPI(t))
+
+	info, err := inspector.Inspect(context.Background(), "ddd444")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if info.IsRunning || info.State != "exited" {
+		t.Fatalf("state = %q running=%v, want exited", info.State, info.IsRunning)
+	}
+}
+
+func TestInspectorListRunningSkipsRemovedContainers(t *testing.T) {
+	inspector := NewInspector(newFakeDockerAPI(t))
+
+	containers, err := inspector.ListRunning(context.Background())
+	if err != nil {
+		t.Fatalf("list running: %v", err)
+	}
+
+	if len(containers) != 2 {
+		t.Fatalf("containers = %d, want 2", len(containers))
+	}
+	dual := containers[1]
+	if dual.ID != "ccc333" {
+		t.Fatalf("second container = %q, want ccc333", dual.ID)
+	}
+	if dual.Labels == nil {
+		t.Fatal("expected labels map to be non-nil")
+	}
+	if !reflect.DeepEqual(dual.IPV4, []string{"172.30.0.9"}) || !reflect.DeepEqual(dual.IPV6, []string{"2001:db8::9"}) {
+		t.Fatalf("addresses = %v / %v", dual.IPV4, dual.IPV6)
+	}
+}
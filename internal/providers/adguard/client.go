@@ -0,0 +1,96 @@
+package adguard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+// rewrite is a DNS rewrite rule as returned by the AdGuard Home control API.
+// Answer is an IP address for A/AAAA rewrites or a hostname for CNAMEs.
+type rewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// client talks to the AdGuard Home control API with HTTP basic auth.
+type client struct {
+	http     *http.Client
+	baseURL  string
+	username string
+	password string
+}
+
+func newClient(baseURL, username, password string, httpClient *http.Client) *client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &client{
+		http:     httpClient,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+	}
+}
+
+func (c *client) listRewrites(ctx context.Context) ([]rewrite, error) {
+	var rewrites []rewrite
+	if err := c.do(ctx, http.MethodGet, "/control/rewrite/list", nil, &rewrites); err != nil {
+		return nil, err
+	}
+	return rewrites, nil
+}
+
+func (c *client) addRewrite(ctx context.Context, entry rewrite) error {
+	return c.do(ctx, http.MethodPost, "/control/rewrite/add", entry, nil)
+}
+
+func (c *client) deleteRewrite(ctx context.Context, entry rewrite) error {
+	return c.do(ctx, http.MethodPost, "/control/rewrite/delete", entry, nil)
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return providers.NewAPIError("adguard", resp, nil)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
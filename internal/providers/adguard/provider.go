@@ -0,0 +1,267 @@
+// Package adguard manages AdGuard Home DNS rewrites through its control API.
+package adguard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func init() {
+	providers.Register("adguard", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewAdGuardProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// AdGuardProvider implements the Provider interface for AdGuard Home rewrites
+type AdGuardProvider struct {
+	name        string
+	zoneFilters []string
+	adapter     *AdGuardAdapter
+}
+
+// AdGuardAdapter manages AdGuard Home DNS rewrites through the libdns
+// interfaces. A rewrite answers with either an IP address or a CNAME target,
+// so only A, AAAA and CNAME records are supported, and none carry a TTL
+type AdGuardAdapter struct {
+	client *client
+}
+
+// NewAdGuardProvider creates a new AdGuard Home provider from configuration
+func NewAdGuardProvider(cfg config.ProviderConfig) (*AdGuardProvider, error) {
+	return newAdGuardProvider(cfg, nil)
+}
+
+// Check validates the server settings of cfg without contacting it
+func Check(cfg config.ProviderConfig) error {
+	if cfg.ControllerURL == "" {
+		return fmt.Errorf("adguard provider %q requires a controller_url", cfg.Name)
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return fmt.Errorf("adguard provider %q requires a username and password", cfg.Name)
+	}
+	return nil
+}
+
+func newAdGuardProvider(cfg config.ProviderConfig, httpClient *http.Client) (*AdGuardProvider, error) {
+	if err := Check(cfg); err != nil {
+		return nil, err
+	}
+
+	return &AdGuardProvider{
+		name:        cfg.Name,
+		zoneFilters: cfg.ZoneFilters,
+		adapter: &AdGuardAdapter{
+			client: newClient(cfg.ControllerURL, cfg.Username, cfg.Password, httpClient),
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (p *AdGuardProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *AdGuardProvider) Type() string {
+	return "adguard"
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *AdGuardProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *AdGuardProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// SupportsRecordType reports whether AdGuard Home can store the record type; it
+// only has A, AAAA and CNAME records, so the TXT ownership registry is
+// skipped for it
+func (p *AdGuardProvider) SupportsRecordType(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA", "CNAME":
+		return true
+	}
+	return false
+}
+
+// GetRecords lists the rewrites that belong to a zone. Rewrites answering
+// with the literal "A" or "AAAA", which pass the upstream answer through, are
+// not records and are skipped
+func (a *AdGuardAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	rewrites, err := a.client.listRewrites(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("adguard get records: %w", err)
+	}
+
+	var records []libdns.Record
+	for _, entry := range rewrites {
+		if !providers.InZone(entry.Domain, zone) || isPassthrough(entry) {
+			continue
+		}
+		records = append(records, toRecord(entry, zone))
+	}
+
+	return records, nil
+}
+
+// AppendRecords adds a rewrite for each record
+func (a *AdGuardAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	created := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		entry, err := toRewrite(record, zone)
+		if err != nil {
+			return created, fmt.Errorf("adguard append records: %w", err)
+		}
+		if err := a.client.addRewrite(ctx, entry); err != nil {
+			return created, fmt.Errorf("adguard append records: %w", err)
+		}
+		created = append(created, toRecord(entry, zone))
+	}
+
+	return created, nil
+}
+
+// SetRecords makes the rewrites for each name and type match the given
+// records exactly, leaving rewrites for other names and types alone
+func (a *AdGuardAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	desired := make(map[string]map[string]bool)
+	entries := make([]rewrite, 0, len(records))
+	for _, record := range records {
+		entry, err := toRewrite(record, zone)
+		if err != nil {
+			return nil, fmt.Errorf("adguard set records: %w", err)
+		}
+		key := rewriteKey(entry)
+		if desired[key] == nil {
+			desired[key] = make(map[string]bool)
+		}
+		desired[key][entry.Answer] = true
+		entries = append(entries, entry)
+	}
+
+	rewrites, err := a.client.listRewrites(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("adguard set records: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, entry := range rewrites {
+		values, ok := desired[rewriteKey(entry)]
+		if !ok || isPassthrough(entry) {
+			continue
+		}
+		if values[entry.Answer] {
+			existing[rewriteKey(entry)+"="+entry.Answer] = true
+			continue
+		}
+		if err := a.client.deleteRewrite(ctx, entry); err != nil {
+			return nil, fmt.Errorf("adguard set records: %w", err)
+		}
+	}
+
+	set := make([]libdns.Record, 0, len(records))
+	for _, entry := range entries {
+		if !existing[rewriteKey(entry)+"="+entry.Answer] {
+			if err := a.client.addRewrite(ctx, entry); err != nil {
+				return set, fmt.Errorf("adguard set records: %w", err)
+			}
+		}
+		set = append(set, toRecord(entry, zone))
+	}
+
+	return set, nil
+}
+
+// DeleteRecords removes the rewrites matching each record. An empty type or
+// value in a record matches any type or value
+func (a *AdGuardAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	rewrites, err := a.client.listRewrites(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("adguard delete records: %w", err)
+	}
+
+	var deleted []libdns.Record
+	for _, entry := range rewrites {
+		if isPassthrough(entry) || !providers.MatchesAny(records, zone, entry.Domain, rewriteType(entry), entry.Answer) {
+			continue
+		}
+		if err := a.client.deleteRewrite(ctx, entry); err != nil {
+			return deleted, fmt.Errorf("adguard delete records: %w", err)
+		}
+		deleted = append(deleted, toRecord(entry, zone))
+	}
+
+	return deleted, nil
+}
+
+// toRewrite converts a libdns record to a rewrite
+func toRewrite(record libdns.Record, zone string) (rewrite, error) {
+	rr := record.RR()
+	entry := rewrite{Domain: providers.AbsoluteName(rr.Name, zone)}
+
+	switch strings.ToUpper(rr.Type) {
+	case "A", "AAAA":
+		ip, err := netip.ParseAddr(rr.Data)
+		if err != nil {
+			return rewrite{}, fmt.Errorf("invalid %s record value %q: %w", rr.Type, rr.Data, err)
+		}
+		entry.Answer = ip.String()
+	case "CNAME":
+		entry.Answer = strings.TrimSuffix(rr.Data, ".")
+	default:
+		return rewrite{}, fmt.Errorf("adguard does not support %s records", rr.Type)
+	}
+
+	return entry, nil
+}
+
+func toRecord(entry rewrite, zone string) libdns.Record {
+	rr := libdns.RR{
+		Name: libdns.RelativeName(entry.Domain, zone),
+		Type: rewriteType(entry),
+		Data: entry.Answer,
+	}
+	if record, err := rr.Parse(); err == nil {
+		return record
+	}
+	return rr
+}
+
+// rewriteType infers the record type from the rewrite's answer
+func rewriteType(entry rewrite) string {
+	ip, err := netip.ParseAddr(entry.Answer)
+	if err != nil {
+		return "CNAME"
+	}
+	return providers.AddressType(ip)
+}
+
+func isPassthrough(entry rewrite) bool {
+	return entry.Answer == "A" || entry.Answer == "AAAA"
+}
+
+func rewriteKey(entry rewrite) string {
+	return strings.ToLower(entry.Domain) + "/" + rewriteType(entry)
+}
+
+// Interface guards
+var (
+	_ providers.Provider            = (*AdGuardProvider)(nil)
+	_ providers.RecordTypeSupporter = (*AdGuardProvider)(nil)
+	_ providers.Adapter             = (*AdGuardAdapter)(nil)
+)
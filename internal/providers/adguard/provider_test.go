@@ -0,0 +1,275 @@
+package adguard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/libdns/libdns"
+)
+
+func TestNewAdGuardProviderRequiresFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProviderConfig
+		errMsg string
+	}{
+		{
+			name:   "missing controller url",
+			cfg:    config.ProviderConfig{Name: "lan", Username: "admin", Password: "secret"},
+			errMsg: "requires a controller_url",
+		},
+		{
+			name:   "missing password",
+			cfg:    config.ProviderConfig{Name: "lan", ControllerURL: "http://adguard.lan", Username: "admin"},
+			errMsg: "requires a username and password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAdGuardProvider(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("NewAdGuardProvider() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestAdGuardAdapter(t *testing.T) {
+	app := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.10")}
+	tests := []struct {
+		name     string
+		password string
+		seed     []rewrite
+		op       string // get, append, set or delete
+		records  []libdns.Record
+		want     []rewrite
+		wantGot  []string // the records the operation returned
+		wantErr  string
+	}{
+		{
+			name: "append writes rewrites",
+			op:   "append",
+			records: []libdns.Record{
+				app,
+				libdns.Address{Name: "app", IP: netip.MustParseAddr("fd00::10")},
+				libdns.CNAME{Name: "www", Target: "edge.home.lab."},
+			},
+			want: []rewrite{
+				{Domain: "app.home.lab", Answer: "192.168.1.10"},
+				{Domain: "app.home.lab", Answer: "fd00::10"},
+				{Domain: "www.home.lab", Answer: "edge.home.lab"},
+			},
+		},
+		{
+			name: "get infers types and skips passthrough rewrites",
+			seed: []rewrite{
+				{Domain: "app.home.lab", Answer: "fd00::10"},
+				{Domain: "www.home.lab", Answer: "edge.home.lab"},
+				{Domain: "nas.home.lab", Answer: "A"},
+			},
+			op: "get",
+			want: []rewrite{
+				{Domain: "app.home.lab", Answer: "fd00::10"},
+				{Domain: "www.home.lab", Answer: "edge.home.lab"},
+				{Domain: "nas.home.lab", Answer: "A"},
+			},
+			wantGot: []string{"app AAAA fd00::10", "www CNAME edge.home.lab"},
+		},
+		{
+			name: "set replaces only the values of the type",
+			seed: []rewrite{
+				{Domain: "app.home.lab", Answer: "192.168.1.9"},
+				{Domain: "app.home.lab", Answer: "fd00::9"},
+				{Domain: "nas.home.lab", Answer: "192.168.1.2"},
+			},
+			op:      "set",
+			records: []libdns.Record{app},
+			want: []rewrite{
+				{Domain: "app.home.lab", Answer: "fd00::9"},
+				{Domain: "nas.home.lab", Answer: "192.168.1.2"},
+				{Domain: "app.home.lab", Answer: "192.168.1.10"},
+			},
+		},
+		{
+			name: "delete without type removes every value",
+			seed: []rewrite{
+				{Domain: "app.home.lab", Answer: "192.168.1.10"},
+				{Domain: "app.home.lab", Answer: "fd00::10"},
+				{Domain: "www.home.lab", Answer: "edge.home.lab"},
+			},
+			op:      "delete",
+			records: []libdns.Record{libdns.RR{Name: "app"}},
+			want:    []rewrite{{Domain: "www.home.lab", Answer: "edge.home.lab"}},
+		},
+		{
+			name:    "txt records are rejected",
+			op:      "append",
+			records: []libdns.Record{libdns.TXT{Name: "_caddy-dns.app", Text: "heritage=caddy-dns"}},
+			wantErr: "does not support TXT records",
+		},
+		{
+			name:     "auth failure",
+			password: "wrong",
+			op:       "get",
+			wantErr:  "status 401",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adguard := newFakeAdGuard(t)
+			for _, entry := range tt.seed {
+				adguard.seed(entry)
+			}
+			adapter := newTestAdapter(t, adguard, tt.password)
+			ctx := context.Background()
+
+			var got []libdns.Record
+			var err error
+			switch tt.op {
+			case "get":
+				got, err = adapter.GetRecords(ctx, "home.lab")
+			case "append":
+				got, err = adapter.AppendRecords(ctx, "home.lab", tt.records)
+			case "set":
+				got, err = adapter.SetRecords(ctx, "home.lab", tt.records)
+			case "delete":
+				got, err = adapter.DeleteRecords(ctx, "home.lab", tt.records)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("%s error = %v, want one containing %q", tt.op, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.op, err)
+			}
+
+			if rewrites := adguard.list(); !slices.Equal(rewrites, tt.want) {
+				t.Fatalf("rewrites = %v, want %v", rewrites, tt.want)
+			}
+			if tt.wantGot != nil {
+				var rrs []string
+				for _, record := range got {
+					rr := record.RR()
+					rrs = append(rrs, rr.Name+" "+rr.Type+" "+rr.Data)
+				}
+				if !slices.Equal(rrs, tt.wantGot) {
+					t.Fatalf("records = %q, want %q", rrs, tt.wantGot)
+				}
+			}
+		})
+	}
+}
+
+func newTestAdapter(t *testing.T, adguard *fakeAdGuard, password string) *AdGuardAdapter {
+	t.Helper()
+
+	if password == "" {
+		password = "secret"
+	}
+	provider, err := newAdGuardProvider(config.ProviderConfig{
+		Name:          "lan",
+		Type:          "adguard",
+		ControllerURL: adguard.server.URL + "/",
+		Username:      "admin",
+		Password:      password,
+		ZoneFilters:   []string{"home.lab"},
+	}, adguard.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider.adapter
+}
+
+// fakeAdGuard is a stand-in AdGuard Home control API for DNS rewrites behind
+// basic auth.
+type fakeAdGuard struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	rewrites []rewrite
+}
+
+func newFakeAdGuard(t *testing.T) *fakeAdGuard {
+	t.Helper()
+
+	a := &fakeAdGuard{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /control/rewrite/list", a.authorized(a.handleList))
+	mux.HandleFunc("POST /control/rewrite/add", a.authorized(a.handleAdd))
+	mux.HandleFunc("POST /control/rewrite/delete", a.authorized(a.handleDelete))
+
+	a.server = httptest.NewServer(mux)
+	t.Cleanup(a.server.Close)
+	return a
+}
+
+func (a *fakeAdGuard) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (a *fakeAdGuard) handleList(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(a.list())
+}
+
+func (a *fakeAdGuard) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var entry rewrite
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if slices.Contains(a.rewrites, entry) {
+		http.Error(w, "rewrite already exists", http.StatusBadRequest)
+		return
+	}
+	a.rewrites = append(a.rewrites, entry)
+}
+
+func (a *fakeAdGuard) handleDelete(w http.ResponseWriter, r *http.Request) {
+	var entry rewrite
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := slices.Index(a.rewrites, entry)
+	if i < 0 {
+		http.Error(w, "rewrite not found", http.StatusBadRequest)
+		return
+	}
+	a.rewrites = slices.Delete(a.rewrites, i, i+1)
+}
+
+func (a *fakeAdGuard) seed(entry rewrite) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewrites = append(a.rewrites, entry)
+}
+
+func (a *fakeAdGuard) list() []rewrite {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]rewrite{}, a.rewrites...)
+}
@@ -0,0 +1,250 @@
+// Package caddydns adapts any Caddy dns.providers module, such as the ones
+// used for ACME DNS challenges, into a dns_sync provider.
+package caddydns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+const providerType = "caddy"
+
+func init() {
+	providers.Register(providerType, func(ctx caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewCaddyProvider(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// libdnsProvider is what a dns.providers module must implement to manage
+// records. Getting records and listing zones are optional.
+type libdnsProvider interface {
+	libdns.RecordAppender
+	libdns.RecordSetter
+	libdns.RecordDeleter
+}
+
+// CaddyProvider implements the Provider interface on top of a Caddy
+// dns.providers module
+type CaddyProvider struct {
+	name        string
+	zoneFilters []string
+	adapter     providers.Adapter
+	getter      bool
+}
+
+// CaddyAdapter forwards record operations to the loaded module
+type CaddyAdapter struct {
+	module string
+	dns    libdnsProvider
+}
+
+// caddyZoneLister is a CaddyAdapter for a module that can list zones.
+type caddyZoneLister struct {
+	*CaddyAdapter
+}
+
+// NewCaddyProvider loads and provisions the configured dns.providers module
+// through ctx
+func NewCaddyProvider(ctx caddy.Context, cfg config.ProviderConfig) (*CaddyProvider, error) {
+	name, raw, err := splitModule(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// ctx.LoadModule cannot load cfg.DNSProvider: Caddy finds json.RawMessage
+	// fields by the type's name, and with the jsonv2 experiment, on by
+	// default since Go 1.27, json.RawMessage is an alias of jsontext.Value.
+	mod, err := ctx.LoadModuleByID("dns.providers."+name, raw)
+	if err != nil {
+		return nil, fmt.Errorf("caddy provider %q: load dns.providers.%s: %w", cfg.Name, name, err)
+	}
+	dns, ok := mod.(libdnsProvider)
+	if !ok {
+		return nil, fmt.Errorf("caddy provider %q: dns.providers.%s cannot append, set and delete records", cfg.Name, name)
+	}
+
+	// Modules built on libdns providers with an HTTPClient field, such as
+	// Cloudflare's, get one that lets the adapter report the status of
+	// failed calls
+	providers.UseStatusClient(mod)
+
+	return wrapModule(cfg, name, dns), nil
+}
+
+// wrapModule wraps a loaded module, exposing zone listing only when the
+// module implements it.
+func wrapModule(cfg config.ProviderConfig, module string, dns libdnsProvider) *CaddyProvider {
+	adapter := &CaddyAdapter{module: module, dns: dns}
+	provider := &CaddyProvider{name: cfg.Name, zoneFilters: cfg.ZoneFilters, adapter: adapter}
+	if _, ok := dns.(libdns.ZoneLister); ok {
+		provider.adapter = &caddyZoneLister{adapter}
+	}
+	_, provider.getter = dns.(libdns.RecordGetter)
+	return provider
+}
+
+// Check validates the module reference without loading it: the module must
+// be compiled into Caddy and implement the libdns record interfaces.
+func Check(cfg config.ProviderConfig) error {
+	name, _, err := splitModule(cfg)
+	if err != nil {
+		return err
+	}
+
+	info, err := caddy.GetModule("dns.providers." + name)
+	if err != nil {
+		return fmt.Errorf("caddy provider %q: %w", cfg.Name, err)
+	}
+	if _, ok := info.New().(libdnsProvider); !ok {
+		return fmt.Errorf("caddy provider %q: dns.providers.%s cannot append, set and delete records", cfg.Name, name)
+	}
+	return nil
+}
+
+// splitModule returns the module name from dns_provider's inline "name" key
+// and the module's own configuration without it.
+func splitModule(cfg config.ProviderConfig) (string, json.RawMessage, error) {
+	if len(cfg.DNSProvider) == 0 {
+		return "", nil, fmt.Errorf("caddy provider %q requires a dns_provider module", cfg.Name)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(cfg.DNSProvider, &fields); err != nil {
+		return "", nil, fmt.Errorf("caddy provider %q: decode dns_provider: %w", cfg.Name, err)
+	}
+	var name string
+	if err := json.Unmarshal(fields["name"], &name); err != nil || name == "" {
+		return "", nil, fmt.Errorf("caddy provider %q: dns_provider is missing its module name", cfg.Name)
+	}
+	delete(fields, "name")
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, fmt.Errorf("caddy provider %q: encode dns_provider: %w", cfg.Name, err)
+	}
+	return name, raw, nil
+}
+
+// Name returns the provider name
+func (p *CaddyProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *CaddyProvider) Type() string {
+	return providerType
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *CaddyProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *CaddyProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// SupportsListing reports whether the module can list records
+func (p *CaddyProvider) SupportsListing() bool {
+	return p.getter
+}
+
+// SupportsRecordType reports whether the module can hold records of the
+// type. Ownership TXT records must be read back, so they need a module that
+// can list records.
+func (p *CaddyProvider) SupportsRecordType(recordType string) bool {
+	return recordType != "TXT" || p.getter
+}
+
+// GetRecords lists records. Modules that cannot list records report so
+// through SupportsListing, and their callers skip it.
+func (a *CaddyAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	getter, ok := a.dns.(libdns.RecordGetter)
+	if !ok {
+		return nil, fmt.Errorf("dns.providers.%s: %w", a.module, providers.ErrListingNotSupported)
+	}
+
+	var records []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		records, err = getter.GetRecords(ctx, zone)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s get records: %w", a.module, err)
+	}
+	return records, nil
+}
+
+// AppendRecords adds records through the module
+func (a *CaddyAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var created []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		created, err = a.dns.AppendRecords(ctx, zone, records)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s append records: %w", a.module, err)
+	}
+	return created, nil
+}
+
+// SetRecords sets records through the module
+func (a *CaddyAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var updated []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		updated, err = a.dns.SetRecords(ctx, zone, records)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s set records: %w", a.module, err)
+	}
+	return updated, nil
+}
+
+// DeleteRecords removes records through the module
+func (a *CaddyAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var deleted []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		deleted, err = a.dns.DeleteRecords(ctx, zone, records)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s delete records: %w", a.module, err)
+	}
+	return deleted, nil
+}
+
+// ListZones lists zones through the module
+func (a *caddyZoneLister) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	lister := a.dns.(libdns.ZoneLister)
+
+	var zones []libdns.Zone
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		zones, err = lister.ListZones(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s list zones: %w", a.module, err)
+	}
+	return zones, nil
+}
+
+// Interface guards
+var (
+	_ providers.Provider            = (*CaddyProvider)(nil)
+	_ providers.RecordTypeSupporter = (*CaddyProvider)(nil)
+	_ providers.ListingSupporter    = (*CaddyProvider)(nil)
+	_ providers.Adapter             = (*CaddyAdapter)(nil)
+	_ libdns.ZoneLister             = (*caddyZoneLister)(nil)
+)
@@ -0,0 +1,298 @@
+package caddydns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func init() {
+	caddy.RegisterModule(bridgeTestProvider{})
+	caddy.RegisterModule(readOnlyTestProvider{})
+	caddy.RegisterModule(httpTestProvider{})
+}
+
+func TestCaddyfileDNSSubdirectiveLoadsModule(t *testing.T) {
+	input := `dns_sync {
+	provider public caddy example.com {
+		dns bridgetest secret-token
+	}
+}`
+
+	cfg, err := config.Load(caddyfile.NewTestDispenser(input))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	var module map[string]string
+	if err := json.Unmarshal(cfg.Providers[0].DNSProvider, &module); err != nil {
+		t.Fatalf("decode dns_provider: %v", err)
+	}
+	if module["name"] != "bridgetest" || module["api_token"] != "secret-token" {
+		t.Fatalf("dns_provider = %v, want bridgetest with api_token", module)
+	}
+
+	provider := newProvider(t, cfg.Providers[0])
+	adapter := provider.Adapter()
+	ctx := context.Background()
+
+	record := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")}
+	if _, err := adapter.AppendRecords(ctx, "example.com", []libdns.Record{record}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	records, err := adapter.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(records) != 1 || records[0].RR().Data != "192.0.2.10" {
+		t.Fatalf("records = %v, want the appended address", records)
+	}
+	if provider.Type() != "caddy" {
+		t.Fatalf("type = %q, want caddy", provider.Type())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+		errMsg string
+	}{
+		{name: "registered module", module: `{"name":"bridgetest"}`},
+		{name: "missing module", errMsg: "requires a dns_provider module"},
+		{name: "unknown module", module: `{"name":"nope"}`, errMsg: "not registered"},
+		{name: "module without write support", module: `{"name":"readonlytest"}`, errMsg: "cannot append, set and delete records"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ProviderConfig{Name: "public", Type: "caddy", ZoneFilters: []string{"example.com"}}
+			if tt.module != "" {
+				cfg.DNSProvider = json.RawMessage(tt.module)
+			}
+
+			err := providers.Validate(cfg)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("Validate() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestModuleCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  libdnsProvider
+		listing bool
+		zones   bool
+	}{
+		{name: "getter and zone lister", module: &bridgeTestProvider{records: new([]libdns.Record)}, listing: true, zones: true},
+		{name: "write only", module: writeOnlyTestProvider{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := wrapModule(config.ProviderConfig{Name: "public"}, "test", tt.module)
+
+			if got := providers.SupportsListing(provider); got != tt.listing {
+				t.Fatalf("SupportsListing() = %v, want %v", got, tt.listing)
+			}
+			if got := providers.SupportsRecordType(provider, "TXT"); got != tt.listing {
+				t.Fatalf("SupportsRecordType(TXT) = %v, want %v", got, tt.listing)
+			}
+			if !providers.SupportsRecordType(provider, "A") {
+				t.Fatal("SupportsRecordType(A) = false, want true")
+			}
+			lister, ok := provider.Adapter().(libdns.ZoneLister)
+			if ok != tt.zones {
+				t.Fatalf("adapter is a zone lister: %v, want %v", ok, tt.zones)
+			}
+			if ok {
+				zones, err := lister.ListZones(context.Background())
+				if err != nil || len(zones) != 1 || zones[0].Name != "example.com." {
+					t.Fatalf("ListZones() = %v, %v, want example.com.", zones, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAdapterErrorsCarryStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	provider := newProvider(t, config.ProviderConfig{
+		Name:        "public",
+		Type:        "caddy",
+		ZoneFilters: []string{"example.com"},
+		DNSProvider: json.RawMessage(`{"name":"httptest","endpoint":"` + server.URL + `"}`),
+	})
+
+	record := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")}
+	_, err := provider.Adapter().SetRecords(context.Background(), "example.com", []libdns.Record{record})
+	if retryable, _ := providers.IsRetryable(err); !retryable {
+		t.Fatalf("SetRecords error = %v, want a retryable error carrying status 503", err)
+	}
+}
+
+func newProvider(t *testing.T, cfg config.ProviderConfig) providers.Provider {
+	t.Helper()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+
+	provider, err := providers.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider
+}
+
+// bridgeTestProvider is a dns.providers module holding records in memory.
+type bridgeTestProvider struct {
+	APIToken string `json:"api_token,omitempty"`
+
+	records *[]libdns.Record
+}
+
+func (bridgeTestProvider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.bridgetest",
+		New: func() caddy.Module { return &bridgeTestProvider{} },
+	}
+}
+
+func (p *bridgeTestProvider) Provision(caddy.Context) error {
+	p.records = new([]libdns.Record)
+	return nil
+}
+
+func (p *bridgeTestProvider) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // module name
+	if d.NextArg() {
+		p.APIToken = d.Val()
+	}
+	return nil
+}
+
+func (p *bridgeTestProvider) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return *p.records, nil
+}
+
+func (p *bridgeTestProvider) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	*p.records = append(*p.records, records...)
+	return records, nil
+}
+
+func (p *bridgeTestProvider) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	*p.records = append([]libdns.Record{}, records...)
+	return records, nil
+}
+
+func (p *bridgeTestProvider) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	*p.records = nil
+	return records, nil
+}
+
+func (p *bridgeTestProvider) ListZones(context.Context) ([]libdns.Zone, error) {
+	return []libdns.Zone{{Name: "example.com."}}, nil
+}
+
+// httpTestProvider calls an HTTP API through its HTTPClient field and, like
+// libdns/cloudflare, only reports the status of a failed call as text.
+type httpTestProvider struct {
+	Endpoint   string       `json:"endpoint,omitempty"`
+	HTTPClient *http.Client `json:"-"`
+}
+
+func (httpTestProvider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.httptest",
+		New: func() caddy.Module { return &httpTestProvider{} },
+	}
+}
+
+func (p *httpTestProvider) call(ctx context.Context, records []libdns.Record) ([]libdns.Record, error) {
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("got error status: HTTP %d", resp.StatusCode)
+	}
+	return records, nil
+}
+
+func (p *httpTestProvider) AppendRecords(ctx context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, records)
+}
+
+func (p *httpTestProvider) SetRecords(ctx context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, records)
+}
+
+func (p *httpTestProvider) DeleteRecords(ctx context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, records)
+}
+
+// readOnlyTestProvider can only list records, as some ACME-only modules do.
+type readOnlyTestProvider struct{}
+
+func (readOnlyTestProvider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.readonlytest",
+		New: func() caddy.Module { return readOnlyTestProvider{} },
+	}
+}
+
+func (readOnlyTestProvider) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+type writeOnlyTestProvider struct{}
+
+func (writeOnlyTestProvider) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+func (writeOnlyTestProvider) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+func (writeOnlyTestProvider) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+// Interface guards
+var (
+	_ caddyfile.Unmarshaler = (*bridgeTestProvider)(nil)
+	_ caddy.Provisioner     = (*bridgeTestProvider)(nil)
+)
@@ -5,12 +5,23 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/cpritchett/caddy-dns-plugin/internal/config"
 	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
 	"github.com/libdns/cloudflare"
 	"github.com/libdns/libdns"
 )
 
+func init() {
+	providers.Register("cloudflare", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewCloudflareProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
 // CloudflareProvider implements the Provider interface for Cloudflare DNS
 type CloudflareProvider struct {
 	name        string
@@ -26,14 +37,25 @@ type CloudflareAdapter struct {
 	proxied  *bool
 }
 
+// Check validates the credentials of cfg without contacting Cloudflare
+func Check(cfg config.ProviderConfig) error {
+	if cfg.Token == "" {
+		return fmt.Errorf("cloudflare provider %q requires an API token", cfg.Name)
+	}
+	return nil
+}
+
 // NewCloudflareProvider creates a new Cloudflare provider from configuration
 func NewCloudflareProvider(cfg config.ProviderConfig) (*CloudflareProvider, error) {
-	if cfg.Token == "" {
-		return nil, fmt.Errorf("cloudflare provider %q requires an API token", cfg.Name)
+	if err := Check(cfg); err != nil {
+		return nil, err
 	}
 
+	// The library only reports the status of a failed call in its error
+	// text; the status client lets the adapter attach it for retries
 	libdnsProvider := &cloudflare.Provider{
-		APIToken: cfg.Token,
+		APIToken:   cfg.Token,
+		HTTPClient: providers.NewStatusClient(nil),
 	}
 
 	adapter := &CloudflareAdapter{
@@ -70,13 +92,45 @@ func (p *CloudflareProvider) Adapter() providers.Adapter {
 	return p.adapter
 }
 
+// GetRecords lists the DNS records Cloudflare holds for a zone
+func (a *CloudflareAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	var records []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		records, err = a.provider.GetRecords(ctx, zone)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cloudflare get records: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListZones lists the zones the API token can access
+func (a *CloudflareAdapter) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	var zones []libdns.Zone
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		zones, err = a.provider.ListZones(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cloudflare list zones: %w", err)
+	}
+
+	return zones, nil
+}
+
 // AppendRecords adds DNS records to Cloudflare
 func (a *CloudflareAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	// Apply Cloudflare-specific settings (TTL and proxied mode) to records
 	enriched := a.enrichRecords(records)
 	
 	// Call the underlying libdns provider
-	created, err := a.provider.AppendRecords(ctx, zone, enriched)
+	var created []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		created, err = a.provider.AppendRecords(ctx, zone, enriched)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("cloudflare append records: %w", err)
 	}
@@ -90,7 +144,11 @@ func (a *CloudflareAdapter) SetRecords(ctx context.Context, zone string, records
 	enriched := a.enrichRecords(records)
 	
 	// Call the underlying libdns provider
-	updated, err := a.provider.SetRecords(ctx, zone, enriched)
+	var updated []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		updated, err = a.provider.SetRecords(ctx, zone, enriched)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("cloudflare set records: %w", err)
 	}
@@ -101,7 +159,11 @@ func (a *CloudflareAdapter) SetRecords(ctx context.Context, zone string, records
 // DeleteRecords removes DNS records from Cloudflare
 func (a *CloudflareAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	// Call the underlying libdns provider
-	deleted, err := a.provider.DeleteRecords(ctx, zone, records)
+	var deleted []libdns.Record
+	err := providers.WithStatus(ctx, func(ctx context.Context) (err error) {
+		deleted, err = a.provider.DeleteRecords(ctx, zone, records)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("cloudflare delete records: %w", err)
 	}
@@ -159,3 +221,9 @@ func (a *CloudflareAdapter) applySettings(record libdns.Record) libdns.Record {
 		return record
 	}
 }
+
+// Interface guards
+var (
+	_ providers.Adapter = (*CloudflareAdapter)(nil)
+	_ libdns.ZoneLister = (*CloudflareAdapter)(nil)
+)
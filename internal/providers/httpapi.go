@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIError is a non-2xx response from a provider's HTTP API.
+type APIError struct {
+	API        string // who answered, e.g. "unifi"
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s api: status %d", e.API, e.StatusCode)
+	}
+	return fmt.Sprintf("%s api: status %d: %s", e.API, e.StatusCode, e.Message)
+}
+
+// HTTPStatusCode returns the response status, for retry classification.
+func (e *APIError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// RetryAfterDelay returns how long the server asked to wait before retrying.
+func (e *APIError) RetryAfterDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// NewAPIError reads the error response resp from api. message picks the
+// error message out of the body; when it is nil or finds none, the body
+// text is the message.
+func NewAPIError(api string, resp *http.Response, message func(body []byte) string) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var text string
+	if message != nil {
+		text = message(body)
+	}
+	if text == "" {
+		text = strings.TrimSpace(string(body))
+	}
+
+	return &APIError{
+		API:        api,
+		StatusCode: resp.StatusCode,
+		Message:    text,
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Session logs in to a session based API before the first call and again
+// when a call finds the session expired.
+type Session struct {
+	login func(ctx context.Context) error
+
+	mu       sync.Mutex // serialises logins and guards loggedIn
+	loggedIn bool
+}
+
+// NewSession creates a session that logs in with login.
+func NewSession(login func(ctx context.Context) error) *Session {
+	return &Session{login: login}
+}
+
+// Call runs call, logging in first if needed and once more if call fails
+// with 401 Unauthorized.
+func (s *Session) Call(ctx context.Context, call func() error) error {
+	if err := s.ensureLogin(ctx); err != nil {
+		return err
+	}
+
+	err := call()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+
+	s.mu.Lock()
+	s.loggedIn = false
+	s.mu.Unlock()
+	if err := s.ensureLogin(ctx); err != nil {
+		return err
+	}
+	return call()
+}
+
+func (s *Session) ensureLogin(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loggedIn {
+		return nil
+	}
+	if err := s.login(ctx); err != nil {
+		return err
+	}
+	s.loggedIn = true
+	return nil
+}
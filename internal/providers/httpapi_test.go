@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewAPIError(t *testing.T) {
+	jsonMessage := func(body []byte) string {
+		var payload struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &payload)
+		return payload.Message
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		retryAfter string
+		message    func([]byte) string
+		want       string
+		wantAfter  time.Duration
+	}{
+		{name: "body text", body: "Too Many Requests\n", retryAfter: "7", want: "test api: status 429: Too Many Requests", wantAfter: 7 * time.Second},
+		{name: "json message", body: `{"message":"slow down"}`, message: jsonMessage, want: "test api: status 429: slow down"},
+		{name: "json without message", body: `{"code":1}`, message: jsonMessage, want: `test api: status 429: {"code":1}`},
+		{name: "empty body", want: "test api: status 429"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			if tt.retryAfter != "" {
+				recorder.Header().Set("Retry-After", tt.retryAfter)
+			}
+			recorder.WriteHeader(http.StatusTooManyRequests)
+			recorder.WriteString(tt.body)
+
+			err := NewAPIError("test", recorder.Result(), tt.message)
+			if err.Error() != tt.want {
+				t.Fatalf("Error() = %q, want %q", err.Error(), tt.want)
+			}
+			if retryable, after := IsRetryable(err); !retryable || after != tt.wantAfter {
+				t.Fatalf("IsRetryable = %v, %s, want retryable after %s", retryable, after, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestSessionLogsInAgainWhenUnauthorized(t *testing.T) {
+	logins := 0
+	session := NewSession(func(context.Context) error {
+		logins++
+		return nil
+	})
+	ctx := context.Background()
+
+	calls := 0
+	expired := true
+	call := func() error {
+		calls++
+		if expired {
+			expired = false
+			return &APIError{API: "test", StatusCode: http.StatusUnauthorized}
+		}
+		return nil
+	}
+
+	if err := session.Call(ctx, call); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if err := session.Call(ctx, call); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if logins != 2 || calls != 3 {
+		t.Fatalf("logins = %d, calls = %d, want 2 logins and 3 calls", logins, calls)
+	}
+}
+
+func TestSessionReportsLoginFailure(t *testing.T) {
+	loginErr := errors.New("bad password")
+	logins := 0
+	session := NewSession(func(context.Context) error {
+		logins++
+		return loginErr
+	})
+
+	for i := 0; i < 2; i++ {
+		err := session.Call(context.Background(), func() error {
+			t.Fatal("call ran without a session")
+			return nil
+		})
+		if !errors.Is(err, loginErr) {
+			t.Fatalf("Call error = %v, want the login failure", err)
+		}
+	}
+	if logins != 2 {
+		t.Fatalf("logins = %d, want a new attempt on every call", logins)
+	}
+}
@@ -0,0 +1,269 @@
+package localfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/atomicfile"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/miekg/dns"
+)
+
+const (
+	beginMarker = "BEGIN caddy-dns-sync managed records"
+	endMarker   = "END caddy-dns-sync managed records"
+)
+
+// document is a hosts or zone file split around its managed block. Text
+// outside the block belongs to the operator and is written back unchanged,
+// except for the zone's SOA serial.
+type document struct {
+	before  string
+	block   string
+	after   string
+	entries []entry
+}
+
+func (d *document) contains(e entry) bool {
+	for _, existing := range d.entries {
+		if existing.key() == e.key() && existing.data == e.data {
+			return true
+		}
+	}
+	return false
+}
+
+// comment returns the comment prefix of the file format.
+func (a *FileAdapter) comment() string {
+	if a.format == formatZone {
+		return ";"
+	}
+	return "#"
+}
+
+// load reads the file and parses the managed block. A missing file is an
+// empty document.
+func (a *FileAdapter) load() (*document, error) {
+	data, err := os.ReadFile(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &document{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", a.path, err)
+	}
+
+	text := string(data)
+	begin := a.comment() + " " + beginMarker
+	end := a.comment() + " " + endMarker
+
+	start := findLine(text, begin, 0)
+	if start < 0 {
+		return &document{before: text}, nil
+	}
+	stop := findLine(text, end, start)
+	if stop < 0 {
+		return nil, fmt.Errorf("%s: %q without %q", a.path, begin, end)
+	}
+	stopEnd := lineEnd(text, stop)
+
+	doc := &document{
+		before: text[:start],
+		block:  text[start:stopEnd],
+		after:  text[stopEnd:],
+	}
+	body := text[lineEnd(text, start):stop]
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, a.comment()) {
+			continue
+		}
+		entries, err := a.parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: managed line %d: %w", a.path, i+1, err)
+		}
+		doc.entries = append(doc.entries, entries...)
+	}
+	return doc, nil
+}
+
+// save renders the managed block and, if it changed, atomically replaces
+// the file, bumping a zone file's SOA serial first.
+func (a *FileAdapter) save(doc *document) error {
+	sortEntries(doc.entries)
+
+	var b strings.Builder
+	b.WriteString(a.comment() + " " + beginMarker + "\n")
+	for _, e := range doc.entries {
+		line, err := a.formatLine(e)
+		if err != nil {
+			return err
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString(a.comment() + " " + endMarker + "\n")
+	block := b.String()
+	if block == doc.block || (doc.block == "" && len(doc.entries) == 0) {
+		return nil
+	}
+
+	before, after := doc.before, doc.after
+	if doc.block == "" && before != "" && !strings.HasSuffix(before, "\n") {
+		before += "\n"
+	}
+	if a.format == formatZone {
+		var bumped bool
+		if before, bumped = bumpSerial(before); !bumped {
+			after, _ = bumpSerial(after)
+		}
+	}
+
+	if err := atomicfile.WriteFile(a.path, []byte(before+block+after), 0o644); err != nil {
+		return err
+	}
+	doc.before, doc.block, doc.after = before, block, after
+	return nil
+}
+
+func (a *FileAdapter) parseLine(line string) ([]entry, error) {
+	if a.format == formatZone {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, nil
+		}
+		return []entry{fromRR(rr)}, nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("want an address and a hostname, got %q", line)
+	}
+	ip, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0, len(fields)-1)
+	for _, name := range fields[1:] {
+		entries = append(entries, entry{name: dns.Fqdn(name), typ: providers.AddressType(ip), data: ip.String()})
+	}
+	return entries, nil
+}
+
+func (a *FileAdapter) formatLine(e entry) (string, error) {
+	if a.format == formatZone {
+		rr, err := toRR(e)
+		if err != nil {
+			return "", err
+		}
+		return rr.String(), nil
+	}
+	return e.data + "\t" + strings.TrimSuffix(e.name, "."), nil
+}
+
+// bumpSerial increments the serial of the first SOA record in text, wrapping
+// as RFC 1982 serial arithmetic allows. It reports whether it found one.
+func bumpSerial(text string) (string, bool) {
+	tokens := zoneTokens(text)
+	for i, tok := range tokens {
+		if !strings.EqualFold(tok.text, "SOA") {
+			continue
+		}
+		// SOA MNAME RNAME SERIAL ..., possibly with "(" in between
+		fields := 0
+		for _, next := range tokens[i+1:] {
+			if next.text == "(" {
+				continue
+			}
+			if fields++; fields < 3 {
+				continue
+			}
+			serial, err := strconv.ParseUint(next.text, 10, 32)
+			if err != nil {
+				return text, false
+			}
+			bumped := strconv.FormatUint(uint64(uint32(serial+1)), 10)
+			return text[:next.start] + bumped + text[next.end:], true
+		}
+		return text, false
+	}
+	return text, false
+}
+
+type token struct {
+	text       string
+	start, end int
+}
+
+// zoneTokens splits zone file text into whitespace-separated tokens,
+// treating parentheses as tokens of their own and skipping comments and
+// quoted strings.
+func zoneTokens(text string) []token {
+	var tokens []token
+	start := -1
+	flush := func(i int) {
+		if start >= 0 {
+			tokens = append(tokens, token{text: text[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == ';':
+			flush(i)
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			flush(i)
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case c == '(' || c == ')':
+			flush(i)
+			tokens = append(tokens, token{text: text[i : i+1], start: i, end: i + 1})
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush(i)
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+// findLine returns the offset of the first line at or after from whose
+// trimmed text is line, or -1.
+func findLine(text, line string, from int) int {
+	for i := from; i < len(text); {
+		end := strings.IndexByte(text[i:], '\n')
+		if end < 0 {
+			end = len(text) - i
+		}
+		if strings.TrimSpace(text[i:i+end]) == line {
+			return i
+		}
+		i += end + 1
+	}
+	return -1
+}
+
+// lineEnd returns the offset just past the line starting at i.
+func lineEnd(text string, i int) int {
+	end := strings.IndexByte(text[i:], '\n')
+	if end < 0 {
+		return len(text)
+	}
+	return i + end + 1
+}
@@ -0,0 +1,391 @@
+// Package localfile writes managed records into a local hosts file or RFC 1035
+// zone file, for dnsmasq or the CoreDNS hosts and file plugins to serve. It
+// needs no network access, which also makes it a convenient provider for
+// end-to-end tests.
+package localfile
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	formatHosts = "hosts"
+	formatZone  = "zone"
+	defaultTTL  = 300
+)
+
+func init() {
+	providers.Register("file", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewFileProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// FileProvider implements the Provider interface for a local hosts or zone file
+type FileProvider struct {
+	name        string
+	zoneFilters []string
+	adapter     *FileAdapter
+}
+
+// FileAdapter keeps records in the managed block of one file. A hosts file
+// can only hold A and AAAA records; a zone file holds any type
+type FileAdapter struct {
+	path   string
+	format string
+	ttl    *int
+
+	// mu serialises the read-modify-write of the file.
+	mu sync.Mutex
+}
+
+// entry is one record in the managed block. Names are fully qualified.
+type entry struct {
+	name string
+	typ  string
+	data string
+	ttl  int
+}
+
+// Check validates the file and format of cfg
+func Check(cfg config.ProviderConfig) error {
+	if cfg.File == "" {
+		return fmt.Errorf("file provider %q requires a file", cfg.Name)
+	}
+	if format := fileFormat(cfg); format != formatHosts && format != formatZone {
+		return fmt.Errorf("file provider %q has unsupported format %q (want hosts or zone)", cfg.Name, cfg.Format)
+	}
+	return nil
+}
+
+// fileFormat returns the format of cfg's file, hosts by default
+func fileFormat(cfg config.ProviderConfig) string {
+	if cfg.Format == "" {
+		return formatHosts
+	}
+	return strings.ToLower(cfg.Format)
+}
+
+// NewFileProvider creates a new file provider from configuration
+func NewFileProvider(cfg config.ProviderConfig) (*FileProvider, error) {
+	if err := Check(cfg); err != nil {
+		return nil, err
+	}
+
+	return &FileProvider{
+		name:        cfg.Name,
+		zoneFilters: cfg.ZoneFilters,
+		adapter: &FileAdapter{
+			path:   cfg.File,
+			format: fileFormat(cfg),
+			ttl:    cfg.TTL,
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (p *FileProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *FileProvider) Type() string {
+	return "file"
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *FileProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *FileProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// SupportsRecordType reports whether the file can hold the record type. A
+// hosts file only has A and AAAA records, so the TXT ownership registry is
+// skipped for it; a zone file holds any type
+func (p *FileProvider) SupportsRecordType(recordType string) bool {
+	if p.adapter.format == formatZone {
+		return true
+	}
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA":
+		return true
+	}
+	return false
+}
+
+// GetRecords returns the managed records that belong to a zone. Records the
+// operator wrote outside the managed block are not reported
+func (a *FileAdapter) GetRecords(_ context.Context, zone string) ([]libdns.Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	doc, err := a.load()
+	if err != nil {
+		return nil, fmt.Errorf("file get records: %w", err)
+	}
+
+	var records []libdns.Record
+	for _, e := range doc.entries {
+		if providers.InZone(e.name, zone) {
+			records = append(records, toRecord(e, zone))
+		}
+	}
+	return records, nil
+}
+
+// AppendRecords adds the records to the managed block. Records already in
+// the block are left as they are
+func (a *FileAdapter) AppendRecords(_ context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added, err := a.toEntries(records, zone)
+	if err != nil {
+		return nil, fmt.Errorf("file append records: %w", err)
+	}
+	doc, err := a.load()
+	if err != nil {
+		return nil, fmt.Errorf("file append records: %w", err)
+	}
+
+	for _, e := range added {
+		if !doc.contains(e) {
+			doc.entries = append(doc.entries, e)
+		}
+	}
+	if err := a.save(doc); err != nil {
+		return nil, fmt.Errorf("file append records: %w", err)
+	}
+
+	return toRecords(added, zone), nil
+}
+
+// SetRecords replaces each name and type's records in the managed block with
+// the given records, leaving other names and types alone
+func (a *FileAdapter) SetRecords(_ context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	set, err := a.toEntries(records, zone)
+	if err != nil {
+		return nil, fmt.Errorf("file set records: %w", err)
+	}
+	doc, err := a.load()
+	if err != nil {
+		return nil, fmt.Errorf("file set records: %w", err)
+	}
+
+	replaced := make(map[string]bool)
+	for _, e := range set {
+		replaced[e.key()] = true
+	}
+	kept := doc.entries[:0]
+	for _, e := range doc.entries {
+		if !replaced[e.key()] {
+			kept = append(kept, e)
+		}
+	}
+	doc.entries = kept
+	for _, e := range set {
+		if !doc.contains(e) {
+			doc.entries = append(doc.entries, e)
+		}
+	}
+	if err := a.save(doc); err != nil {
+		return nil, fmt.Errorf("file set records: %w", err)
+	}
+
+	return toRecords(set, zone), nil
+}
+
+// DeleteRecords removes the matching records from the managed block. An
+// empty type or value in a record matches any type or value
+func (a *FileAdapter) DeleteRecords(_ context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	doc, err := a.load()
+	if err != nil {
+		return nil, fmt.Errorf("file delete records: %w", err)
+	}
+
+	var deleted []libdns.Record
+	kept := doc.entries[:0]
+	for _, e := range doc.entries {
+		if a.matchesAny(e, records, zone) {
+			deleted = append(deleted, toRecord(e, zone))
+			continue
+		}
+		kept = append(kept, e)
+	}
+	doc.entries = kept
+	if err := a.save(doc); err != nil {
+		return nil, fmt.Errorf("file delete records: %w", err)
+	}
+
+	return deleted, nil
+}
+
+func (a *FileAdapter) toEntries(records []libdns.Record, zone string) ([]entry, error) {
+	entries := make([]entry, 0, len(records))
+	for _, record := range records {
+		e, err := a.toEntry(record, zone)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// toEntry converts a libdns record to a block entry in canonical form,
+// applying the configured TTL when the record has none
+func (a *FileAdapter) toEntry(record libdns.Record, zone string) (entry, error) {
+	rr := record.RR()
+	e := entry{
+		name: dns.Fqdn(providers.AbsoluteName(rr.Name, zone)),
+		typ:  strings.ToUpper(rr.Type),
+		data: rr.Data,
+		ttl:  int(rr.TTL / time.Second),
+	}
+	if e.ttl == 0 {
+		e.ttl = defaultTTL
+		if a.ttl != nil {
+			e.ttl = *a.ttl
+		}
+	}
+
+	if a.format == formatHosts {
+		if e.typ != "A" && e.typ != "AAAA" {
+			return entry{}, fmt.Errorf("hosts file cannot hold %s records", rr.Type)
+		}
+		ip, err := netip.ParseAddr(rr.Data)
+		if err != nil {
+			return entry{}, fmt.Errorf("invalid %s record value %q: %w", rr.Type, rr.Data, err)
+		}
+		e.typ = providers.AddressType(ip)
+		e.data = ip.String()
+		e.ttl = 0 // hosts files carry no TTL
+		return e, nil
+	}
+
+	parsed, err := toRR(e)
+	if err != nil {
+		return entry{}, err
+	}
+	return fromRR(parsed), nil
+}
+
+func (a *FileAdapter) matchesAny(e entry, records []libdns.Record, zone string) bool {
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(e.name, dns.Fqdn(providers.AbsoluteName(rr.Name, zone))) {
+			continue
+		}
+		if rr.Type != "" && !strings.EqualFold(e.typ, rr.Type) {
+			continue
+		}
+		if rr.Data != "" {
+			want, err := a.toEntry(record, zone)
+			if err != nil || e.data != want.data {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (e entry) key() string {
+	return strings.ToLower(e.name) + "/" + e.typ
+}
+
+// toRR builds the zone file form of an entry
+func toRR(e entry) (dns.RR, error) {
+	if e.typ == "TXT" {
+		hdr := dns.RR_Header{Name: e.name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(e.ttl)}
+		return &dns.TXT{Hdr: hdr, Txt: providers.SplitTXT(e.data)}, nil
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", e.name, e.ttl, e.typ, e.data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s record %q: %w", e.typ, e.name, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("invalid %s record %q: empty record", e.typ, e.name)
+	}
+	return rr, nil
+}
+
+func fromRR(rr dns.RR) entry {
+	hdr := rr.Header()
+	e := entry{
+		name: hdr.Name,
+		typ:  dns.TypeToString[hdr.Rrtype],
+		data: strings.TrimPrefix(rr.String(), hdr.String()),
+		ttl:  int(hdr.Ttl),
+	}
+	if txt, ok := rr.(*dns.TXT); ok {
+		e.data = providers.UnescapeTXT(strings.Join(txt.Txt, ""))
+	}
+	return e
+}
+
+func toRecords(entries []entry, zone string) []libdns.Record {
+	records := make([]libdns.Record, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, toRecord(e, zone))
+	}
+	return records
+}
+
+func toRecord(e entry, zone string) libdns.Record {
+	rr := libdns.RR{
+		Name: libdns.RelativeName(e.name, dns.Fqdn(zone)),
+		Type: e.typ,
+		Data: e.data,
+		TTL:  time.Duration(e.ttl) * time.Second,
+	}
+	if record, err := rr.Parse(); err == nil {
+		return record
+	}
+	return rr
+}
+
+func sortEntries(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		if entries[i].typ != entries[j].typ {
+			return entries[i].typ < entries[j].typ
+		}
+		return entries[i].data < entries[j].data
+	})
+}
+
+// Interface guards
+var (
+	_ providers.Provider            = (*FileProvider)(nil)
+	_ providers.RecordTypeSupporter = (*FileProvider)(nil)
+	_ providers.Adapter             = (*FileAdapter)(nil)
+)
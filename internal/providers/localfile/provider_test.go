@@ -0,0 +1,260 @@
+package localfile
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+const testZone = `$ORIGIN home.lab.
+$TTL 3600
+@	IN	SOA	ns1.home.lab. admin.home.lab. (
+		2024010101 ; serial
+		3600 600 86400 60 )
+@	IN	NS	ns1.home.lab.
+ns1	IN	A	192.168.1.1
+`
+
+func TestNewFileProviderValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProviderConfig
+		errMsg string
+	}{
+		{
+			name:   "missing file",
+			cfg:    config.ProviderConfig{Name: "lan"},
+			errMsg: "requires a file",
+		},
+		{
+			name:   "unknown format",
+			cfg:    config.ProviderConfig{Name: "lan", File: "/etc/hosts", Format: "yaml"},
+			errMsg: "unsupported format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileProvider(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("NewFileProvider() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestHostsFileRecordLifecycle(t *testing.T) {
+	path := writeTestFile(t, "hosts", "127.0.0.1\tlocalhost\n192.168.1.1\trouter.home.lab")
+	adapter := newTestAdapter(t, path, "")
+	ctx := context.Background()
+
+	records := []libdns.Record{
+		libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.10")},
+		libdns.Address{Name: "app", IP: netip.MustParseAddr("fd00::10")},
+	}
+	if _, err := adapter.AppendRecords(ctx, "home.lab", records); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	want := "127.0.0.1\tlocalhost\n192.168.1.1\trouter.home.lab\n" +
+		"# BEGIN caddy-dns-sync managed records\n" +
+		"192.168.1.10\tapp.home.lab\n" +
+		"fd00::10\tapp.home.lab\n" +
+		"# END caddy-dns-sync managed records\n"
+	if got := readFile(t, path); got != want {
+		t.Fatalf("hosts file =\n%s\nwant\n%s", got, want)
+	}
+
+	replacement := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.20")}
+	if _, err := adapter.SetRecords(ctx, "home.lab", []libdns.Record{replacement}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	got, err := adapter.GetRecords(ctx, "home.lab")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got) != 2 || got[0].RR().Data != "192.168.1.20" || got[1].RR().Data != "fd00::10" {
+		t.Fatalf("records = %v, want the replaced A and the untouched AAAA", got)
+	}
+
+	if _, err := adapter.DeleteRecords(ctx, "home.lab", []libdns.Record{libdns.RR{Name: "app"}}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := readFile(t, path); !strings.HasPrefix(got, "127.0.0.1\tlocalhost\n192.168.1.1\trouter.home.lab\n# BEGIN") || strings.Contains(got, "app.home.lab") {
+		t.Fatalf("hosts file after delete =\n%s", got)
+	}
+}
+
+func TestHostsFileRejectsOtherTypes(t *testing.T) {
+	adapter := newTestAdapter(t, filepath.Join(t.TempDir(), "hosts"), "")
+
+	record := libdns.CNAME{Name: "www", Target: "app.home.lab."}
+	_, err := adapter.AppendRecords(context.Background(), "home.lab", []libdns.Record{record})
+	if err == nil || !strings.Contains(err.Error(), "hosts file cannot hold CNAME records") {
+		t.Fatalf("append error = %v, want CNAME rejected", err)
+	}
+}
+
+func TestZoneFileBumpsSerialOnChange(t *testing.T) {
+	path := writeTestFile(t, "db.home.lab", testZone)
+	adapter := newTestAdapter(t, path, "zone")
+	ctx := context.Background()
+
+	records := []libdns.Record{
+		libdns.CNAME{Name: "www", Target: "app.home.lab."},
+		libdns.TXT{Name: "_caddy-dns.www", Text: `heritage=caddy-dns,owner="a b"`},
+	}
+	if _, err := adapter.AppendRecords(ctx, "home.lab", records); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	zone := readFile(t, path)
+	if !strings.Contains(zone, "2024010102 ; serial") {
+		t.Fatalf("zone file serial not bumped:\n%s", zone)
+	}
+	if !strings.Contains(zone, "www.home.lab.\t300\tIN\tCNAME\tapp.home.lab.") {
+		t.Fatalf("zone file missing CNAME:\n%s", zone)
+	}
+
+	// Appending the same records again changes nothing, so the serial stays
+	if _, err := adapter.AppendRecords(ctx, "home.lab", records); err != nil {
+		t.Fatalf("second append: %v", err)
+	}
+	if got := readFile(t, path); got != zone {
+		t.Fatalf("zone file rewritten without changes:\n%s", got)
+	}
+
+	got, err := adapter.GetRecords(ctx, "home.lab")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("records = %v, want two", got)
+	}
+	if txt, ok := got[0].(libdns.TXT); !ok || txt.Text != `heritage=caddy-dns,owner="a b"` {
+		t.Fatalf("TXT record = %#v, want the owner text back", got[0])
+	}
+}
+
+func TestBumpSerialWraps(t *testing.T) {
+	got, ok := bumpSerial("@ IN SOA ns1 admin 4294967295 3600 600 86400 60\n")
+	if !ok || got != "@ IN SOA ns1 admin 0 3600 600 86400 60\n" {
+		t.Fatalf("bumpSerial() = %q, %v; want the serial wrapped to 0", got, ok)
+	}
+}
+
+func TestWriteKeepsFileMode(t *testing.T) {
+	path := writeTestFile(t, "hosts", "")
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	adapter := newTestAdapter(t, path, "")
+
+	record := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.10")}
+	if _, err := adapter.AppendRecords(context.Background(), "home.lab", []libdns.Record{record}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Fatalf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestManagerEndToEnd(t *testing.T) {
+	tests := []struct {
+		format    string
+		content   string
+		wantLine  string
+		ownership bool // the file holds the ownership TXT record
+	}{
+		{format: "zone", content: testZone, wantLine: "app.home.lab.\t300\tIN\tA\t192.168.1.10", ownership: true},
+		{format: "hosts", content: "127.0.0.1\tlocalhost\n", wantLine: "192.168.1.10\tapp.home.lab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := writeTestFile(t, "records", tt.content)
+			provider, err := NewFileProvider(config.ProviderConfig{
+				Name:        "lan",
+				Type:        "file",
+				ZoneFilters: []string{"home.lab"},
+				File:        path,
+				Format:      tt.format,
+			})
+			if err != nil {
+				t.Fatalf("new provider: %v", err)
+			}
+			manager := dns.NewManager([]providers.Provider{provider}, dns.WithOwnerID("edge-1"))
+			ctx := context.Background()
+
+			req := dns.SyncRequest{
+				Hostname:     "app.home.lab",
+				ProviderName: "lan",
+				RecordType:   dns.RecordTypeA,
+				Target:       "192.168.1.10",
+				SourceID:     "container-1",
+				RequestedAt:  time.Now(),
+			}
+			if err := manager.CreateRecord(ctx, req); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			file := readFile(t, path)
+			if !strings.Contains(file, tt.wantLine) {
+				t.Fatalf("file is missing the record:\n%s", file)
+			}
+			if got := strings.Contains(file, "_caddy-dns.app.home.lab"); got != tt.ownership {
+				t.Fatalf("file has the ownership TXT: %v, want %v:\n%s", got, tt.ownership, file)
+			}
+			if records := manager.GetRecords(); len(records) != 1 || records[0].State != dns.RecordStatePresent {
+				t.Fatalf("records = %+v, want the record present", records)
+			}
+
+			if err := manager.DeleteRecord(ctx, "app.home.lab", "lan", "container-1"); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if file := readFile(t, path); strings.Contains(file, "app.home.lab") {
+				t.Fatalf("file still has app records:\n%s", file)
+			}
+		})
+	}
+}
+
+func newTestAdapter(t *testing.T, path, format string) *FileAdapter {
+	t.Helper()
+
+	provider, err := NewFileProvider(config.ProviderConfig{Name: "lan", File: path, Format: format})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider.adapter
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,394 @@
+// Package memory provides a provider that keeps zones in memory. It follows
+// libdns semantics closely enough to stand in for a real provider in tests
+// and dry runs, and can be told to fail, slow down or rate-limit operations.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+// Operation names an adapter method for fault injection and call counts.
+type Operation string
+
+const (
+	OpGet    Operation = "get"
+	OpAppend Operation = "append"
+	OpSet    Operation = "set"
+	OpDelete Operation = "delete"
+)
+
+// ErrRecordExists is returned when AppendRecords is asked to create a record
+// that is already in the zone, as most DNS APIs refuse duplicates.
+var ErrRecordExists = errors.New("record already exists")
+
+// RateLimitError is returned while the configured rate limit is exceeded.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// HTTPStatusCode reports the error as a 429, like a real API would.
+func (e *RateLimitError) HTTPStatusCode() int {
+	return 429
+}
+
+// RetryAfterDelay returns how long until the rate limit window resets.
+func (e *RateLimitError) RetryAfterDelay() time.Duration {
+	return e.RetryAfter
+}
+
+func init() {
+	providers.Register("memory", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		return NewMemoryProvider(cfg.Name, cfg.ZoneFilters), nil
+	}, func(config.ProviderConfig) error {
+		// Memory zones need no configuration
+		return nil
+	})
+}
+
+// MemoryProvider implements the Provider interface with in-memory zones
+type MemoryProvider struct {
+	name        string
+	zoneFilters []string
+	adapter     *MemoryAdapter
+}
+
+// MemoryAdapter stores records per zone. Zones are created on first write
+type MemoryAdapter struct {
+	mu    sync.Mutex
+	zones map[string][]libdns.RR
+	calls map[Operation]int
+
+	failNext   map[Operation][]error
+	failAlways map[Operation]error
+	latency    time.Duration
+
+	rateLimit   int
+	rateWindow  time.Duration
+	windowStart time.Time
+	windowCalls int
+}
+
+// NewMemoryProvider creates an empty in-memory provider
+func NewMemoryProvider(name string, zoneFilters []string) *MemoryProvider {
+	return &MemoryProvider{
+		name:        name,
+		zoneFilters: zoneFilters,
+		adapter: &MemoryAdapter{
+			zones:      make(map[string][]libdns.RR),
+			calls:      make(map[Operation]int),
+			failNext:   make(map[Operation][]error),
+			failAlways: make(map[Operation]error),
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *MemoryProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *MemoryProvider) Type() string {
+	return "memory"
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *MemoryProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *MemoryProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// Memory returns the adapter with its fault injection controls
+func (p *MemoryProvider) Memory() *MemoryAdapter {
+	return p.adapter
+}
+
+// FailNext makes the next call of op return err. Calls queue up, so calling
+// FailNext twice fails the next two calls
+func (a *MemoryAdapter) FailNext(op Operation, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failNext[op] = append(a.failNext[op], err)
+}
+
+// FailAlways makes every call of op return err until it is called again with
+// a nil error
+func (a *MemoryAdapter) FailAlways(op Operation, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err == nil {
+		delete(a.failAlways, op)
+		return
+	}
+	a.failAlways[op] = err
+}
+
+// SetLatency delays every call by d, or until the call's context is done
+func (a *MemoryAdapter) SetLatency(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.latency = d
+}
+
+// SetRateLimit allows limit calls per window across all operations; further
+// calls in the window fail with a *RateLimitError. A limit of 0 disables it
+func (a *MemoryAdapter) SetRateLimit(limit int, window time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rateLimit = limit
+	a.rateWindow = window
+	a.windowStart = time.Time{}
+	a.windowCalls = 0
+}
+
+// Calls returns how many times op has been called, including failed calls
+func (a *MemoryAdapter) Calls(op Operation) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[op]
+}
+
+// GetRecords returns every record in the zone
+func (a *MemoryAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if err := a.begin(ctx, OpGet); err != nil {
+		return nil, fmt.Errorf("memory get records: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return toRecords(a.zones[zoneKey(zone)]), nil
+}
+
+// AppendRecords adds the records to the zone without touching existing ones.
+// Nothing is added if any record is already present
+func (a *MemoryAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if err := a.begin(ctx, OpAppend); err != nil {
+		return nil, fmt.Errorf("memory append records: %w", err)
+	}
+	added, err := normalize(records)
+	if err != nil {
+		return nil, fmt.Errorf("memory append records: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := zoneKey(zone)
+	for _, rr := range added {
+		if contains(a.zones[key], rr) {
+			return nil, fmt.Errorf("memory append records: %s %s %q: %w", rr.Name, rr.Type, rr.Data, ErrRecordExists)
+		}
+	}
+	a.zones[key] = append(a.zones[key], added...)
+
+	return toRecords(added), nil
+}
+
+// SetRecords replaces each name and type's RRset with the given records,
+// leaving other names and types alone
+func (a *MemoryAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if err := a.begin(ctx, OpSet); err != nil {
+		return nil, fmt.Errorf("memory set records: %w", err)
+	}
+	set, err := normalize(records)
+	if err != nil {
+		return nil, fmt.Errorf("memory set records: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	replaced := make(map[string]bool)
+	for _, rr := range set {
+		replaced[rrsetKey(rr)] = true
+	}
+	key := zoneKey(zone)
+	var kept []libdns.RR
+	for _, rr := range a.zones[key] {
+		if !replaced[rrsetKey(rr)] {
+			kept = append(kept, rr)
+		}
+	}
+	for _, rr := range set {
+		if !contains(kept, rr) {
+			kept = append(kept, rr)
+		}
+	}
+	a.zones[key] = kept
+
+	return toRecords(set), nil
+}
+
+// DeleteRecords removes the matching records. An empty type, TTL or value in
+// a record matches any; records that do not exist are ignored
+func (a *MemoryAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if err := a.begin(ctx, OpDelete); err != nil {
+		return nil, fmt.Errorf("memory delete records: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := zoneKey(zone)
+	var kept, deleted []libdns.RR
+	for _, rr := range a.zones[key] {
+		if matchesAny(rr, records) {
+			deleted = append(deleted, rr)
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	a.zones[key] = kept
+
+	return toRecords(deleted), nil
+}
+
+// ListZones returns every zone that has been written to
+func (a *MemoryAdapter) ListZones(context.Context) ([]libdns.Zone, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	zones := make([]libdns.Zone, 0, len(a.zones))
+	for name := range a.zones {
+		zones = append(zones, libdns.Zone{Name: name + "."})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	return zones, nil
+}
+
+// begin counts the call and applies the injected latency, rate limit and
+// failures
+func (a *MemoryAdapter) begin(ctx context.Context, op Operation) error {
+	a.mu.Lock()
+	a.calls[op]++
+	latency := a.latency
+	a.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rateLimit > 0 {
+		now := time.Now()
+		if now.Sub(a.windowStart) >= a.rateWindow {
+			a.windowStart = now
+			a.windowCalls = 0
+		}
+		if a.windowCalls >= a.rateLimit {
+			return &RateLimitError{RetryAfter: a.windowStart.Add(a.rateWindow).Sub(now)}
+		}
+		a.windowCalls++
+	}
+
+	if queued := a.failNext[op]; len(queued) > 0 {
+		a.failNext[op] = queued[1:]
+		return queued[0]
+	}
+	return a.failAlways[op]
+}
+
+// normalize parses the records so their data is in canonical form
+func normalize(records []libdns.Record) ([]libdns.RR, error) {
+	rrs := make([]libdns.RR, 0, len(records))
+	for _, record := range records {
+		rr := record.RR()
+		if rr.Type == "" {
+			return nil, fmt.Errorf("record %q has no type", rr.Name)
+		}
+		parsed, err := rr.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("record %q: %w", rr.Name, err)
+		}
+		rrs = append(rrs, parsed.RR())
+	}
+	return rrs, nil
+}
+
+func toRecords(rrs []libdns.RR) []libdns.Record {
+	records := make([]libdns.Record, 0, len(rrs))
+	for _, rr := range rrs {
+		if record, err := rr.Parse(); err == nil {
+			records = append(records, record)
+			continue
+		}
+		records = append(records, rr)
+	}
+	return records
+}
+
+func contains(rrs []libdns.RR, want libdns.RR) bool {
+	for _, rr := range rrs {
+		if rrsetKey(rr) == rrsetKey(want) && rr.Data == want.Data {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(rr libdns.RR, records []libdns.Record) bool {
+	for _, record := range records {
+		want := record.RR()
+		if want.Type != "" && want.Data != "" {
+			if parsed, err := want.Parse(); err == nil {
+				want = parsed.RR()
+			}
+		}
+		if !strings.EqualFold(rr.Name, want.Name) {
+			continue
+		}
+		if want.Type != "" && !strings.EqualFold(rr.Type, want.Type) {
+			continue
+		}
+		if want.TTL != 0 && rr.TTL != want.TTL {
+			continue
+		}
+		if want.Data != "" && rr.Data != want.Data {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func rrsetKey(rr libdns.RR) string {
+	return strings.ToLower(rr.Name) + "/" + strings.ToUpper(rr.Type)
+}
+
+func zoneKey(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+// Interface guards
+var (
+	_ providers.Provider = (*MemoryProvider)(nil)
+	_ providers.Adapter  = (*MemoryAdapter)(nil)
+	_ libdns.ZoneLister  = (*MemoryAdapter)(nil)
+)
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestMemoryAdapterRecordSemantics(t *testing.T) {
+	adapter := NewMemoryProvider("mem", []string{"example.com"}).Memory()
+	ctx := context.Background()
+
+	first := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10"), TTL: time.Minute}
+	second := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.11"), TTL: time.Minute}
+	txt := libdns.TXT{Name: "app", Text: "hello"}
+	if _, err := adapter.AppendRecords(ctx, "example.com.", []libdns.Record{first, second, txt}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := adapter.AppendRecords(ctx, "example.com", []libdns.Record{first}); !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("duplicate append error = %v, want ErrRecordExists", err)
+	}
+
+	replacement := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.20"), TTL: time.Minute}
+	if _, err := adapter.SetRecords(ctx, "example.com", []libdns.Record{replacement}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	records, err := adapter.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %v, want the TXT and the replaced A", records)
+	}
+	if addr, ok := records[1].(libdns.Address); !ok || addr.IP != replacement.IP {
+		t.Fatalf("A record = %#v, want %s", records[1], replacement.IP)
+	}
+
+	deleted, err := adapter.DeleteRecords(ctx, "example.com", []libdns.Record{libdns.RR{Name: "app", Type: "TXT"}})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].RR().Data != "hello" {
+		t.Fatalf("deleted = %v, want the TXT record", deleted)
+	}
+
+	zones, err := adapter.ListZones(ctx)
+	if err != nil || len(zones) != 1 || zones[0].Name != "example.com." {
+		t.Fatalf("zones = %v, %v; want example.com.", zones, err)
+	}
+}
+
+func TestMemoryAdapterFailureInjection(t *testing.T) {
+	adapter := NewMemoryProvider("mem", []string{"example.com"}).Memory()
+	ctx := context.Background()
+	boom := errors.New("boom")
+	record := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")}
+
+	adapter.FailNext(OpAppend, boom)
+	if _, err := adapter.AppendRecords(ctx, "example.com", []libdns.Record{record}); !errors.Is(err, boom) {
+		t.Fatalf("first append error = %v, want boom", err)
+	}
+	if _, err := adapter.AppendRecords(ctx, "example.com", []libdns.Record{record}); err != nil {
+		t.Fatalf("second append: %v", err)
+	}
+
+	adapter.FailAlways(OpGet, boom)
+	for i := 0; i < 2; i++ {
+		if _, err := adapter.GetRecords(ctx, "example.com"); !errors.Is(err, boom) {
+			t.Fatalf("get %d error = %v, want boom", i, err)
+		}
+	}
+	adapter.FailAlways(OpGet, nil)
+	if _, err := adapter.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("get after clearing: %v", err)
+	}
+
+	if adapter.Calls(OpAppend) != 2 || adapter.Calls(OpGet) != 3 {
+		t.Fatalf("calls = append %d, get %d; want 2 and 3", adapter.Calls(OpAppend), adapter.Calls(OpGet))
+	}
+}
+
+func TestMemoryAdapterRateLimit(t *testing.T) {
+	adapter := NewMemoryProvider("mem", []string{"example.com"}).Memory()
+	adapter.SetRateLimit(2, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := adapter.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+	_, err := adapter.GetRecords(ctx, "example.com")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.RetryAfter <= 0 || rateErr.RetryAfter > time.Hour {
+		t.Fatalf("third get error = %v, want a RateLimitError with a retry delay", err)
+	}
+}
+
+func TestMemoryAdapterLatencyHonoursContext(t *testing.T) {
+	adapter := NewMemoryProvider("mem", []string{"example.com"}).Memory()
+	adapter.SetLatency(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := adapter.GetRecords(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("get error = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// AbsoluteName returns the fully qualified form of a name relative to zone,
+// without a trailing dot. "" and "@" stand for the zone apex.
+func AbsoluteName(name, zone string) string {
+	zone = strings.TrimSuffix(zone, ".")
+	if name == "" || name == "@" {
+		return zone
+	}
+	return strings.TrimSuffix(name, ".") + "." + zone
+}
+
+// InZone reports whether the fully qualified name is zone or lies below it.
+func InZone(name, zone string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// AddressType returns the record type, A or AAAA, that holds ip.
+func AddressType(ip netip.Addr) string {
+	if ip.Is4() || ip.Is4In6() {
+		return "A"
+	}
+	return "AAAA"
+}
+
+// MatchesAny reports whether any of records, relative to zone, selects the
+// provider entry with the fully qualified name, type and value, the way
+// DeleteRecords selects entries: an empty type or value in a record matches
+// any type or value. Names and values compare without trailing dots.
+func MatchesAny(records []libdns.Record, zone, name, recordType, value string) bool {
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(strings.TrimSuffix(name, "."), AbsoluteName(rr.Name, zone)) {
+			continue
+		}
+		if rr.Type != "" && !strings.EqualFold(recordType, rr.Type) {
+			continue
+		}
+		if rr.Data != "" && strings.TrimSuffix(value, ".") != strings.TrimSuffix(rr.Data, ".") {
+			continue
+		}
+		return true
+	}
+	return false
+}
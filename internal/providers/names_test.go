@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name, zone string
+		absolute   string
+	}{
+		{name: "app", zone: "home.lab", absolute: "app.home.lab"},
+		{name: "@", zone: "home.lab.", absolute: "home.lab"},
+		{name: "", zone: "home.lab", absolute: "home.lab"},
+		{name: "app.", zone: "home.lab.", absolute: "app.home.lab"},
+	}
+	for _, tt := range tests {
+		if got := AbsoluteName(tt.name, tt.zone); got != tt.absolute {
+			t.Fatalf("AbsoluteName(%q, %q) = %q, want %q", tt.name, tt.zone, got, tt.absolute)
+		}
+		if !InZone(tt.absolute, tt.zone) {
+			t.Fatalf("InZone(%q, %q) = false, want true", tt.absolute, tt.zone)
+		}
+	}
+
+	if InZone("app.example.lab", "home.lab") || InZone("apphome.lab", "home.lab") {
+		t.Fatal("InZone matched a name outside the zone")
+	}
+	if AddressType(netip.MustParseAddr("::ffff:192.168.1.10")) != "A" || AddressType(netip.MustParseAddr("fd00::10")) != "AAAA" {
+		t.Fatal("AddressType picked the wrong type")
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []libdns.Record
+		want    bool
+	}{
+		{name: "exact", records: []libdns.Record{libdns.RR{Name: "www", Type: "CNAME", Data: "edge.home.lab."}}, want: true},
+		{name: "any type and value", records: []libdns.Record{libdns.RR{Name: "WWW"}}, want: true},
+		{name: "other value", records: []libdns.Record{libdns.RR{Name: "www", Type: "CNAME", Data: "nas.home.lab"}}, want: false},
+		{name: "other type", records: []libdns.Record{libdns.RR{Name: "www", Type: "A"}}, want: false},
+		{name: "other name", records: []libdns.Record{libdns.RR{Name: "app"}}, want: false},
+		{name: "none", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesAny(tt.records, "home.lab", "www.home.lab", "CNAME", "edge.home.lab"); got != tt.want {
+				t.Fatalf("MatchesAny = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package pihole
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+const (
+	hostsPath = "/api/config/dns/hosts"
+	cnamePath = "/api/config/dns/cnameRecords"
+)
+
+// client is an authenticated session with the Pi-hole v6 REST API. Local DNS
+// records live in the dns.hosts and dns.cnameRecords configuration arrays,
+// whose items are added and removed one at a time by value.
+type client struct {
+	http     *http.Client
+	baseURL  string
+	password string
+	session  *providers.Session
+
+	mu  sync.Mutex // guards sid
+	sid string
+}
+
+func newClient(baseURL, password string, httpClient *http.Client) *client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	c := &client{
+		http:     httpClient,
+		baseURL:  strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/admin"),
+		password: password,
+	}
+	c.session = providers.NewSession(c.login)
+	return c
+}
+
+// listHosts returns the "IP hostname [hostname...]" lines of dns.hosts.
+func (c *client) listHosts(ctx context.Context) ([]string, error) {
+	var payload struct {
+		Config struct {
+			DNS struct {
+				Hosts []string `json:"hosts"`
+			} `json:"dns"`
+		} `json:"config"`
+	}
+	if err := c.call(ctx, http.MethodGet, hostsPath, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Config.DNS.Hosts, nil
+}
+
+// listCNAMEs returns the "alias,target[,ttl]" items of dns.cnameRecords.
+func (c *client) listCNAMEs(ctx context.Context) ([]string, error) {
+	var payload struct {
+		Config struct {
+			DNS struct {
+				CNAMERecords []string `json:"cnameRecords"`
+			} `json:"dns"`
+		} `json:"config"`
+	}
+	if err := c.call(ctx, http.MethodGet, cnamePath, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Config.DNS.CNAMERecords, nil
+}
+
+func (c *client) addItem(ctx context.Context, path, item string) error {
+	return c.call(ctx, http.MethodPut, path+"/"+url.PathEscape(item), nil)
+}
+
+func (c *client) deleteItem(ctx context.Context, path, item string) error {
+	return c.call(ctx, http.MethodDelete, path+"/"+url.PathEscape(item), nil)
+}
+
+// call sends an API request, logging in first if needed and once more if the
+// session has expired.
+func (c *client) call(ctx context.Context, method, path string, out any) error {
+	return c.session.Call(ctx, func() error {
+		return c.do(ctx, method, path, out)
+	})
+}
+
+func (c *client) login(ctx context.Context) error {
+	data, err := json.Marshal(map[string]string{"password": c.password})
+	if err != nil {
+		return fmt.Errorf("login: encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/auth", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("login: %w", decodeAPIError(resp))
+	}
+
+	var payload struct {
+		Session struct {
+			Valid   bool   `json:"valid"`
+			SID     string `json:"sid"`
+			Message string `json:"message"`
+		} `json:"session"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("login: decode response: %w", err)
+	}
+	if !payload.Session.Valid || payload.Session.SID == "" {
+		return fmt.Errorf("login: %w", &providers.APIError{API: "pihole", StatusCode: resp.StatusCode, Message: payload.Session.Message})
+	}
+
+	c.mu.Lock()
+	c.sid = payload.Session.SID
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	c.mu.Lock()
+	req.Header.Set("X-FTL-SID", c.sid)
+	c.mu.Unlock()
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return decodeAPIError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func decodeAPIError(resp *http.Response) error {
+	return providers.NewAPIError("pihole", resp, func(body []byte) string {
+		var payload struct {
+			Error struct {
+				Message string `json:"message"`
+				Hint    string `json:"hint"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.Error.Message == "" {
+			return ""
+		}
+		if payload.Error.Hint != "" {
+			return payload.Error.Message + ": " + payload.Error.Hint
+		}
+		return payload.Error.Message
+	})
+}
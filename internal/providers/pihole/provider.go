@@ -0,0 +1,404 @@
+// Package pihole manages Pi-hole "Local DNS records" (A/AAAA host entries and
+// CNAME records) through the Pi-hole v6 REST API.
+package pihole
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func init() {
+	providers.Register("pihole", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewPiholeProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// PiholeProvider implements the Provider interface for Pi-hole local DNS
+type PiholeProvider struct {
+	name        string
+	zoneFilters []string
+	adapter     *PiholeAdapter
+}
+
+// PiholeAdapter manages Pi-hole local DNS records through the libdns
+// interfaces. Pi-hole only serves A, AAAA and CNAME records, and only CNAME
+// records carry a TTL
+type PiholeAdapter struct {
+	client *client
+	ttl    *int
+}
+
+// localRecord is one name in a dns.hosts line or one dns.cnameRecords item
+type localRecord struct {
+	name  string
+	typ   string
+	value string
+	ttl   int
+}
+
+// snapshot is the local DNS configuration as read from Pi-hole
+type snapshot struct {
+	hosts  []string
+	cnames []string
+}
+
+// NewPiholeProvider creates a new Pi-hole provider from configuration
+func NewPiholeProvider(cfg config.ProviderConfig) (*PiholeProvider, error) {
+	return newPiholeProvider(cfg, nil)
+}
+
+// Check validates the server settings of cfg without contacting it
+func Check(cfg config.ProviderConfig) error {
+	if cfg.ControllerURL == "" {
+		return fmt.Errorf("pihole provider %q requires a controller_url", cfg.Name)
+	}
+	if cfg.Password == "" {
+		return fmt.Errorf("pihole provider %q requires a password", cfg.Name)
+	}
+	return nil
+}
+
+func newPiholeProvider(cfg config.ProviderConfig, httpClient *http.Client) (*PiholeProvider, error) {
+	if err := Check(cfg); err != nil {
+		return nil, err
+	}
+
+	return &PiholeProvider{
+		name:        cfg.Name,
+		zoneFilters: cfg.ZoneFilters,
+		adapter: &PiholeAdapter{
+			client: newClient(cfg.ControllerURL, cfg.Password, httpClient),
+			ttl:    cfg.TTL,
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (p *PiholeProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *PiholeProvider) Type() string {
+	return "pihole"
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *PiholeProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *PiholeProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// SupportsRecordType reports whether Pi-hole can store the record type; it
+// only has A, AAAA and CNAME records, so the TXT ownership registry is
+// skipped for it
+func (p *PiholeProvider) SupportsRecordType(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA", "CNAME":
+		return true
+	}
+	return false
+}
+
+// GetRecords lists the local DNS records that belong to a zone
+func (a *PiholeAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	snap, err := a.snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pihole get records: %w", err)
+	}
+
+	var records []libdns.Record
+	for _, local := range snap.records() {
+		if !providers.InZone(local.name, zone) {
+			continue
+		}
+		records = append(records, toRecord(local, zone))
+	}
+
+	return records, nil
+}
+
+// AppendRecords adds a local DNS record for each record
+func (a *PiholeAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	created := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		local, err := a.toLocal(record, zone)
+		if err != nil {
+			return created, fmt.Errorf("pihole append records: %w", err)
+		}
+		if err := a.add(ctx, local); err != nil {
+			return created, fmt.Errorf("pihole append records: %w", err)
+		}
+		created = append(created, toRecord(local, zone))
+	}
+
+	return created, nil
+}
+
+// SetRecords makes the records for each name and type match the given
+// records exactly, leaving records for other names and types alone
+func (a *PiholeAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	desired := make(map[string]map[string]bool)
+	locals := make([]localRecord, 0, len(records))
+	for _, record := range records {
+		local, err := a.toLocal(record, zone)
+		if err != nil {
+			return nil, fmt.Errorf("pihole set records: %w", err)
+		}
+		if desired[local.key()] == nil {
+			desired[local.key()] = make(map[string]bool)
+		}
+		desired[local.key()][local.value] = true
+		locals = append(locals, local)
+	}
+
+	snap, err := a.snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pihole set records: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, local := range snap.records() {
+		if desired[local.key()][local.value] {
+			existing[local.key()+"="+local.value] = true
+		}
+	}
+
+	_, err = a.remove(ctx, snap, func(local localRecord) bool {
+		values, ok := desired[local.key()]
+		return ok && !values[local.value]
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pihole set records: %w", err)
+	}
+
+	set := make([]libdns.Record, 0, len(records))
+	for _, local := range locals {
+		if !existing[local.key()+"="+local.value] {
+			if err := a.add(ctx, local); err != nil {
+				return set, fmt.Errorf("pihole set records: %w", err)
+			}
+		}
+		set = append(set, toRecord(local, zone))
+	}
+
+	return set, nil
+}
+
+// DeleteRecords removes the local DNS records matching each record. An empty
+// type or value in a record matches any type or value
+func (a *PiholeAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	snap, err := a.snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pihole delete records: %w", err)
+	}
+
+	removed, err := a.remove(ctx, snap, func(local localRecord) bool {
+		return providers.MatchesAny(records, zone, local.name, local.typ, local.value)
+	})
+	deleted := make([]libdns.Record, 0, len(removed))
+	for _, local := range removed {
+		deleted = append(deleted, toRecord(local, zone))
+	}
+	if err != nil {
+		return deleted, fmt.Errorf("pihole delete records: %w", err)
+	}
+
+	return deleted, nil
+}
+
+func (a *PiholeAdapter) snapshot(ctx context.Context) (snapshot, error) {
+	hosts, err := a.client.listHosts(ctx)
+	if err != nil {
+		return snapshot{}, err
+	}
+	cnames, err := a.client.listCNAMEs(ctx)
+	if err != nil {
+		return snapshot{}, err
+	}
+	return snapshot{hosts: hosts, cnames: cnames}, nil
+}
+
+func (a *PiholeAdapter) add(ctx context.Context, local localRecord) error {
+	if local.typ == "CNAME" {
+		return a.client.addItem(ctx, cnamePath, formatCNAME(local))
+	}
+	return a.client.addItem(ctx, hostsPath, local.value+" "+local.name)
+}
+
+// remove deletes every record in snap that match accepts. Pi-hole removes
+// whole items, so a hosts line that also names other hosts is re-added
+// without the removed names.
+func (a *PiholeAdapter) remove(ctx context.Context, snap snapshot, match func(localRecord) bool) ([]localRecord, error) {
+	var removed []localRecord
+
+	for _, line := range snap.hosts {
+		ip, names := parseHosts(line)
+		var matched []localRecord
+		var kept []string
+		for _, name := range names {
+			local := hostRecord(ip, name)
+			if match(local) {
+				matched = append(matched, local)
+			} else {
+				kept = append(kept, name)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		if err := a.client.deleteItem(ctx, hostsPath, line); err != nil {
+			return removed, err
+		}
+		if len(kept) > 0 {
+			if err := a.client.addItem(ctx, hostsPath, ip+" "+strings.Join(kept, " ")); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, matched...)
+	}
+
+	for _, item := range snap.cnames {
+		local, ok := parseCNAME(item)
+		if !ok || !match(local) {
+			continue
+		}
+		if err := a.client.deleteItem(ctx, cnamePath, item); err != nil {
+			return removed, err
+		}
+		removed = append(removed, local)
+	}
+
+	return removed, nil
+}
+
+// toLocal converts a libdns record to a local DNS record, applying the
+// configured TTL to CNAME records that have none
+func (a *PiholeAdapter) toLocal(record libdns.Record, zone string) (localRecord, error) {
+	rr := record.RR()
+	local := localRecord{
+		name: providers.AbsoluteName(rr.Name, zone),
+		typ:  strings.ToUpper(rr.Type),
+	}
+
+	switch local.typ {
+	case "A", "AAAA":
+		ip, err := netip.ParseAddr(rr.Data)
+		if err != nil {
+			return localRecord{}, fmt.Errorf("invalid %s record value %q: %w", local.typ, rr.Data, err)
+		}
+		local.typ = providers.AddressType(ip)
+		local.value = ip.String()
+	case "CNAME":
+		local.value = strings.TrimSuffix(rr.Data, ".")
+		local.ttl = int(rr.TTL / time.Second)
+		if local.ttl == 0 && a.ttl != nil {
+			local.ttl = *a.ttl
+		}
+	default:
+		return localRecord{}, fmt.Errorf("pihole does not support %s records", rr.Type)
+	}
+
+	return local, nil
+}
+
+func (s snapshot) records() []localRecord {
+	var records []localRecord
+	for _, line := range s.hosts {
+		ip, names := parseHosts(line)
+		for _, name := range names {
+			records = append(records, hostRecord(ip, name))
+		}
+	}
+	for _, item := range s.cnames {
+		if local, ok := parseCNAME(item); ok {
+			records = append(records, local)
+		}
+	}
+	return records
+}
+
+func (l localRecord) key() string {
+	return strings.ToLower(l.name) + "/" + l.typ
+}
+
+// parseHosts splits an "IP hostname [hostname...]" line
+func parseHosts(line string) (string, []string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+func hostRecord(ip, name string) localRecord {
+	local := localRecord{name: name, typ: "A", value: ip}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		local.typ = providers.AddressType(addr)
+	}
+	return local
+}
+
+// parseCNAME splits an "alias,target[,ttl]" item
+func parseCNAME(item string) (localRecord, bool) {
+	parts := strings.Split(item, ",")
+	if len(parts) < 2 {
+		return localRecord{}, false
+	}
+	local := localRecord{
+		name:  strings.TrimSpace(parts[0]),
+		typ:   "CNAME",
+		value: strings.TrimSpace(parts[1]),
+	}
+	if len(parts) > 2 {
+		local.ttl, _ = strconv.Atoi(strings.TrimSpace(parts[2]))
+	}
+	return local, true
+}
+
+func formatCNAME(local localRecord) string {
+	item := local.name + "," + local.value
+	if local.ttl > 0 {
+		item += "," + strconv.Itoa(local.ttl)
+	}
+	return item
+}
+
+func toRecord(local localRecord, zone string) libdns.Record {
+	rr := libdns.RR{
+		Name: libdns.RelativeName(local.name, zone),
+		Type: local.typ,
+		Data: local.value,
+		TTL:  time.Duration(local.ttl) * time.Second,
+	}
+	if record, err := rr.Parse(); err == nil {
+		return record
+	}
+	return rr
+}
+
+// Interface guards
+var (
+	_ providers.Provider            = (*PiholeProvider)(nil)
+	_ providers.RecordTypeSupporter = (*PiholeProvider)(nil)
+	_ providers.Adapter             = (*PiholeAdapter)(nil)
+)
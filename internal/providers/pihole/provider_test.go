@@ -0,0 +1,301 @@
+package pihole
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/libdns/libdns"
+)
+
+func TestNewPiholeProviderRequiresFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProviderConfig
+		errMsg string
+	}{
+		{
+			name:   "missing controller url",
+			cfg:    config.ProviderConfig{Name: "lan", Password: "secret"},
+			errMsg: "requires a controller_url",
+		},
+		{
+			name:   "missing password",
+			cfg:    config.ProviderConfig{Name: "lan", ControllerURL: "http://pi.hole"},
+			errMsg: "requires a password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPiholeProvider(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("NewPiholeProvider() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestPiholeAdapter(t *testing.T) {
+	app := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.10")}
+	www := libdns.CNAME{Name: "www", Target: "edge.home.lab."}
+	tests := []struct {
+		name       string
+		password   string
+		hosts      []string // seeded dns.hosts lines
+		cnames     []string // seeded dns.cnameRecords items
+		op         string   // get, append, set or delete
+		records    []libdns.Record
+		wantHosts  []string
+		wantCNAMEs []string
+		wantGot    []string // the records the operation returned
+		wantErr    string
+	}{
+		{
+			name:       "append writes hosts lines and cnames with the ttl",
+			op:         "append",
+			records:    []libdns.Record{app, www},
+			wantHosts:  []string{"192.168.1.10 app.home.lab"},
+			wantCNAMEs: []string{"www.home.lab,edge.home.lab,60"},
+		},
+		{
+			name:       "get reads cname targets and ttls",
+			cnames:     []string{"www.home.lab,edge.home.lab,60", "www.example.com,edge.example.com"},
+			op:         "get",
+			wantCNAMEs: []string{"www.home.lab,edge.home.lab,60", "www.example.com,edge.example.com"},
+			wantGot:    []string{"www CNAME edge.home.lab 1m0s"},
+		},
+		{
+			name:      "set replaces the value",
+			hosts:     []string{"192.168.1.9 app.home.lab", "192.168.1.2 nas.home.lab"},
+			op:        "set",
+			records:   []libdns.Record{app},
+			wantHosts: []string{"192.168.1.2 nas.home.lab", "192.168.1.10 app.home.lab"},
+		},
+		{
+			name:      "delete keeps other names on the line",
+			hosts:     []string{"192.168.1.10 app.home.lab api.home.lab"},
+			op:        "delete",
+			records:   []libdns.Record{app},
+			wantHosts: []string{"192.168.1.10 api.home.lab"},
+		},
+		{
+			name:    "delete removes cnames",
+			cnames:  []string{"www.home.lab,edge.home.lab,60"},
+			op:      "delete",
+			records: []libdns.Record{www},
+		},
+		{
+			name:    "txt records are rejected",
+			op:      "append",
+			records: []libdns.Record{libdns.TXT{Name: "_caddy-dns.app", Text: "heritage=caddy-dns"}},
+			wantErr: "does not support TXT records",
+		},
+		{
+			name:     "login failure",
+			password: "wrong",
+			op:       "get",
+			wantErr:  "status 401: Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pihole := newFakePihole(t)
+			for _, line := range tt.hosts {
+				pihole.seed(hostsPath, line)
+			}
+			for _, item := range tt.cnames {
+				pihole.seed(cnamePath, item)
+			}
+			adapter := newTestAdapter(t, pihole, tt.password)
+			ctx := context.Background()
+
+			var got []libdns.Record
+			var err error
+			switch tt.op {
+			case "get":
+				got, err = adapter.GetRecords(ctx, "home.lab")
+			case "append":
+				got, err = adapter.AppendRecords(ctx, "home.lab", tt.records)
+			case "set":
+				got, err = adapter.SetRecords(ctx, "home.lab", tt.records)
+			case "delete":
+				got, err = adapter.DeleteRecords(ctx, "home.lab", tt.records)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("%s error = %v, want one containing %q", tt.op, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.op, err)
+			}
+
+			if hosts := pihole.items(hostsPath); !slices.Equal(hosts, tt.wantHosts) {
+				t.Fatalf("hosts = %q, want %q", hosts, tt.wantHosts)
+			}
+			if cnames := pihole.items(cnamePath); !slices.Equal(cnames, tt.wantCNAMEs) {
+				t.Fatalf("cnames = %q, want %q", cnames, tt.wantCNAMEs)
+			}
+			if tt.wantGot != nil {
+				var rrs []string
+				for _, record := range got {
+					rr := record.RR()
+					rrs = append(rrs, fmt.Sprintf("%s %s %s %s", rr.Name, rr.Type, rr.Data, rr.TTL))
+				}
+				if !slices.Equal(rrs, tt.wantGot) {
+					t.Fatalf("records = %q, want %q", rrs, tt.wantGot)
+				}
+			}
+		})
+	}
+}
+
+func newTestAdapter(t *testing.T, pihole *fakePihole, password string) *PiholeAdapter {
+	t.Helper()
+
+	if password == "" {
+		password = "secret"
+	}
+	ttl := 60
+	provider, err := newPiholeProvider(config.ProviderConfig{
+		Name:          "lan",
+		Type:          "pihole",
+		ControllerURL: pihole.server.URL + "/admin/",
+		Password:      password,
+		ZoneFilters:   []string{"home.lab"},
+		TTL:           &ttl,
+	}, pihole.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider.adapter
+}
+
+// fakePihole is a stand-in Pi-hole v6 API serving the dns.hosts and
+// dns.cnameRecords configuration arrays behind X-FTL-SID sessions.
+type fakePihole struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	config   map[string][]string
+	sessions map[string]bool
+	loginN   int
+}
+
+func newFakePihole(t *testing.T) *fakePihole {
+	t.Helper()
+
+	p := &fakePihole{
+		config:   make(map[string][]string),
+		sessions: make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/auth", p.login)
+	for _, path := range []string{hostsPath, cnamePath} {
+		mux.HandleFunc("GET "+path, p.authorized(p.list(path)))
+		mux.HandleFunc("PUT "+path+"/{item}", p.authorized(p.add(path)))
+		mux.HandleFunc("DELETE "+path+"/{item}", p.authorized(p.remove(path)))
+	}
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakePihole) login(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"key": "unauthorized", "message": "Unauthorized", "hint": nil}})
+		return
+	}
+
+	p.mu.Lock()
+	p.loginN++
+	sid := fmt.Sprintf("sid-%d", p.loginN)
+	p.sessions[sid] = true
+	p.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{"session": map[string]any{"valid": true, "sid": sid, "validity": 1800}})
+}
+
+func (p *fakePihole) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		ok := p.sessions[r.Header.Get("X-FTL-SID")]
+		p.mu.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"key": "unauthorized", "message": "Unauthorized"}})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (p *fakePihole) list(path string) http.HandlerFunc {
+	key := path[strings.LastIndex(path, "/")+1:]
+	return func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"config": map[string]any{"dns": map[string]any{key: p.items(path)}},
+		})
+	}
+}
+
+func (p *fakePihole) add(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item := r.PathValue("item")
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if slices.Contains(p.config[path], item) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": "Item already present"}})
+			return
+		}
+		p.config[path] = append(p.config[path], item)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (p *fakePihole) remove(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item := r.PathValue("item")
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		i := slices.Index(p.config[path], item)
+		if i < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": "Item not found"}})
+			return
+		}
+		p.config[path] = slices.Delete(p.config[path], i, i+1)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *fakePihole) seed(path, item string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config[path] = append(p.config[path], item)
+}
+
+func (p *fakePihole) items(path string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.config[path])
+}
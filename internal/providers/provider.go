@@ -1,8 +1,16 @@
 package providers
 
-import "github.com/libdns/libdns"
+import (
+	"errors"
 
+	"github.com/libdns/libdns"
+)
+
+// Adapter is the libdns surface the DNS manager needs from a provider.
+// GetRecords lets reconciliation see what the provider actually holds.
+// Adapters that can enumerate zones may also implement libdns.ZoneLister.
 type Adapter interface {
+	libdns.RecordGetter
 	libdns.RecordAppender
 	libdns.RecordSetter
 	libdns.RecordDeleter
@@ -14,3 +22,37 @@ type Provider interface {
 	ZoneFilters() []string
 	Adapter() Adapter
 }
+
+// RecordTypeSupporter is implemented by providers that can only store some
+// record types, such as local DNS servers without TXT records.
+type RecordTypeSupporter interface {
+	SupportsRecordType(recordType string) bool
+}
+
+// SupportsRecordType reports whether provider can store records of the type.
+// Providers that do not implement RecordTypeSupporter support every type.
+func SupportsRecordType(provider Provider, recordType string) bool {
+	if supporter, ok := provider.(RecordTypeSupporter); ok {
+		return supporter.SupportsRecordType(recordType)
+	}
+	return true
+}
+
+// ErrListingNotSupported is returned by GetRecords of adapters whose
+// provider reports through SupportsListing that it cannot list records.
+var ErrListingNotSupported = errors.New("provider cannot list records")
+
+// ListingSupporter is implemented by providers whose adapter may be unable
+// to list records, such as Caddy dns.providers modules that only write them.
+type ListingSupporter interface {
+	SupportsListing() bool
+}
+
+// SupportsListing reports whether the adapter of provider can list records.
+// Providers that do not implement ListingSupporter can.
+func SupportsListing(provider Provider) bool {
+	if supporter, ok := provider.(ListingSupporter); ok {
+		return supporter.SupportsListing()
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+)
+
+// Factory builds a provider from its configuration. ctx is the Caddy context
+// of the dns_sync app, for providers that load other Caddy modules.
+type Factory func(ctx caddy.Context, cfg config.ProviderConfig) (Provider, error)
+
+// Checker validates a provider's configuration without building it.
+type Checker func(cfg config.ProviderConfig) error
+
+type registration struct {
+	factory Factory
+	check   Checker
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register makes a provider type available to the configuration. Validate
+// runs check for the type, and New runs factory. It is meant to be called
+// from the init function of the provider's package and panics if the type is
+// empty or already registered, or if factory or check is nil.
+func Register(providerType string, factory Factory, check Checker) {
+	if providerType == "" {
+		panic("providers: provider type must not be empty")
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("providers: nil factory for type %q", providerType))
+	}
+	if check == nil {
+		panic(fmt.Sprintf("providers: nil checker for type %q", providerType))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[providerType]; ok {
+		panic(fmt.Sprintf("providers: type %q already registered", providerType))
+	}
+	registry[providerType] = registration{factory: factory, check: check}
+}
+
+// New builds the provider described by cfg using the factory registered for
+// its type.
+func New(ctx caddy.Context, cfg config.ProviderConfig) (Provider, error) {
+	reg, err := lookup(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return reg.factory(ctx, cfg)
+}
+
+// Validate checks that cfg names a registered type and carries the
+// configuration that type requires.
+func Validate(cfg config.ProviderConfig) error {
+	reg, err := lookup(cfg)
+	if err != nil {
+		return err
+	}
+	return reg.check(cfg)
+}
+
+// Types returns the registered provider types in sorted order.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for providerType := range registry {
+		types = append(types, providerType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func lookup(cfg config.ProviderConfig) (registration, error) {
+	registryMu.RLock()
+	reg, ok := registry[cfg.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return registration{}, fmt.Errorf("provider %q has unsupported type %q (available: %s)", cfg.Name, cfg.Type, strings.Join(Types(), ", "))
+	}
+	return reg, nil
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+)
+
+func init() {
+	Register("registry-test", func(caddy.Context, config.ProviderConfig) (Provider, error) {
+		return nil, errors.New("registry-test factory called")
+	}, func(cfg config.ProviderConfig) error {
+		if cfg.Token == "" {
+			return errors.New("registry-test provider requires a token")
+		}
+		return nil
+	})
+}
+
+func TestNewRejectsUnknownType(t *testing.T) {
+	_, err := New(caddy.Context{}, config.ProviderConfig{Name: "x", Type: "bogus"})
+	if err == nil || !strings.Contains(err.Error(), `unsupported type "bogus"`) || !strings.Contains(err.Error(), "registry-test") {
+		t.Fatalf("New() error = %v, want unsupported type listing registered types", err)
+	}
+}
+
+func TestValidateRunsChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider config.ProviderConfig
+		errMsg   string
+	}{
+		{
+			name:     "unknown type",
+			provider: config.ProviderConfig{Name: "x", Type: "bogus", ZoneFilters: []string{"example.com"}},
+			errMsg:   "unsupported type",
+		},
+		{
+			name:     "missing credentials",
+			provider: config.ProviderConfig{Name: "x", Type: "registry-test", ZoneFilters: []string{"example.com"}},
+			errMsg:   "requires a token",
+		},
+		{
+			name:     "valid",
+			provider: config.ProviderConfig{Name: "x", Type: "registry-test", Token: "t", ZoneFilters: []string{"example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.provider)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("Validate() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	factory := func(caddy.Context, config.ProviderConfig) (Provider, error) { return nil, nil }
+	check := func(config.ProviderConfig) error { return nil }
+
+	tests := []struct {
+		name         string
+		providerType string
+		check        Checker
+	}{
+		{name: "duplicate type", providerType: "registry-test", check: check},
+		{name: "nil checker", providerType: "registry-unchecked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected Register to panic")
+				}
+			}()
+			Register(tt.providerType, factory, tt.check)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// StatusCoder is implemented by provider errors that carry the HTTP status
+// of a failed API call.
+type StatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// RetryAfterer is implemented by errors that say how long to wait before
+// trying again, usually from a Retry-After header.
+type RetryAfterer interface {
+	RetryAfterDelay() time.Duration
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying:
+// rate limiting (429) or server errors (5xx) from an error implementing
+// StatusCoder, timeouts and dropped or refused connections. Anything else,
+// such as a rejected record, bad credentials, a TLS failure or an error that
+// does not say its status, is permanent. The returned delay is what the
+// provider asked to wait, or 0.
+func IsRetryable(err error) (bool, time.Duration) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+
+	var after time.Duration
+	var retryAfter RetryAfterer
+	if errors.As(err, &retryAfter) {
+		after = retryAfter.RetryAfterDelay()
+	}
+
+	var status StatusCoder
+	if errors.As(err, &status) {
+		return retryableStatus(status.HTTPStatusCode()), after
+	}
+
+	var netErr net.Error
+	if (errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true, after
+	}
+	return false, 0
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// ParseRetryAfter converts a Retry-After header, in seconds or as an HTTP
+// date, to a delay from now. It returns 0 for an empty or invalid header.
+func ParseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// Backoff returns the wait before retry n, counting from 1: base doubled for
+// each earlier retry and capped at max, with jitter that keeps it between
+// half and all of that.
+func Backoff(base, max time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Attempt describes one call a RetryAdapter made to the provider.
+type Attempt struct {
+	Provider  string
+	Operation string // get, append, set, delete or list_zones
+	Number    int    // 1 for the first call
+	Err       error
+	Retry     bool          // another attempt follows after Delay
+	Delay     time.Duration // only set when Retry is true
+}
+
+// RetryOptions tunes a RetryAdapter. Zero values use the defaults.
+type RetryOptions struct {
+	// MaxAttempts is the number of calls per operation, including the
+	// first; appends are only called once. Defaults to 4.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; it doubles for each
+	// retry after that. Defaults to 500ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts. A provider asking to wait
+	// longer ends the retries, leaving the record for a later sync.
+	// Defaults to 30s.
+	MaxDelay time.Duration
+	// OnAttempt is called after every call, e.g. to count it in metrics.
+	OnAttempt func(Attempt)
+}
+
+const (
+	defaultMaxAttempts = 4
+	defaultBaseDelay   = 500 * time.Millisecond
+	defaultMaxDelay    = 30 * time.Second
+)
+
+// RetryAdapter retries the calls of the adapter it wraps when they fail with
+// a retryable error, waiting with exponential backoff and jitter between
+// attempts and honoring Retry-After. Appends are never retried: a call that
+// timed out may still have created the records, and repeating it would
+// duplicate them.
+type RetryAdapter struct {
+	name    string
+	adapter Adapter
+	opts    RetryOptions
+}
+
+// retryZoneLister is a RetryAdapter around an adapter that can list zones.
+type retryZoneLister struct {
+	*RetryAdapter
+}
+
+type retryProvider struct {
+	Provider
+	adapter Adapter
+}
+
+// WithRetry returns the provider with its adapter wrapped in a RetryAdapter.
+func WithRetry(provider Provider, opts RetryOptions) Provider {
+	return &retryProvider{
+		Provider: provider,
+		adapter:  NewRetryAdapter(provider.Name(), provider.Adapter(), opts),
+	}
+}
+
+func (p *retryProvider) Adapter() Adapter {
+	return p.adapter
+}
+
+func (p *retryProvider) SupportsRecordType(recordType string) bool {
+	return SupportsRecordType(p.Provider, recordType)
+}
+
+func (p *retryProvider) SupportsListing() bool {
+	return SupportsListing(p.Provider)
+}
+
+// NewRetryAdapter wraps adapter, named name in attempts. The result also
+// implements libdns.ZoneLister when adapter does.
+func NewRetryAdapter(name string, adapter Adapter, opts RetryOptions) Adapter {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+
+	retry := &RetryAdapter{name: name, adapter: adapter, opts: opts}
+	if _, ok := adapter.(libdns.ZoneLister); ok {
+		return &retryZoneLister{retry}
+	}
+	return retry
+}
+
+// GetRecords lists the zone's records, retrying transient failures
+func (a *RetryAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	var records []libdns.Record
+	err := a.do(ctx, "get", func() (err error) {
+		records, err = a.adapter.GetRecords(ctx, zone)
+		return err
+	})
+	return records, err
+}
+
+// AppendRecords adds records in a single attempt
+func (a *RetryAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	created, err := a.adapter.AppendRecords(ctx, zone, records)
+	a.report(Attempt{Provider: a.name, Operation: "append", Number: 1, Err: err})
+	return created, err
+}
+
+// SetRecords replaces RRsets, retrying transient failures
+func (a *RetryAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var set []libdns.Record
+	err := a.do(ctx, "set", func() (err error) {
+		set, err = a.adapter.SetRecords(ctx, zone, records)
+		return err
+	})
+	return set, err
+}
+
+// DeleteRecords removes records, retrying transient failures
+func (a *RetryAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var deleted []libdns.Record
+	err := a.do(ctx, "delete", func() (err error) {
+		deleted, err = a.adapter.DeleteRecords(ctx, zone, records)
+		return err
+	})
+	return deleted, err
+}
+
+// ListZones lists zones, retrying transient failures
+func (a *retryZoneLister) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	lister := a.adapter.(libdns.ZoneLister)
+	var zones []libdns.Zone
+	err := a.do(ctx, "list_zones", func() (err error) {
+		zones, err = lister.ListZones(ctx)
+		return err
+	})
+	return zones, err
+}
+
+// do runs call until it succeeds, fails permanently, runs out of attempts or
+// ctx is done
+func (a *RetryAdapter) do(ctx context.Context, operation string, call func() error) error {
+	for n := 1; ; n++ {
+		err := call()
+		attempt := Attempt{Provider: a.name, Operation: operation, Number: n, Err: err}
+		if err == nil || ctx.Err() != nil {
+			a.report(attempt)
+			return err
+		}
+
+		retryable, after := IsRetryable(err)
+		if !retryable || n >= a.opts.MaxAttempts || after > a.opts.MaxDelay {
+			a.report(attempt)
+			if n > 1 {
+				return fmt.Errorf("after %d attempts: %w", n, err)
+			}
+			return err
+		}
+
+		attempt.Retry = true
+		attempt.Delay = max(Backoff(a.opts.BaseDelay, a.opts.MaxDelay, n), after)
+		a.report(attempt)
+
+		if !wait(ctx, attempt.Delay) {
+			return err
+		}
+	}
+}
+
+// wait sleeps for delay and reports whether it did so before ctx was done
+func wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (a *RetryAdapter) report(attempt Attempt) {
+	if a.opts.OnAttempt != nil {
+		a.opts.OnAttempt(attempt)
+	}
+}
+
+// Interface guards
+var (
+	_ Adapter           = (*RetryAdapter)(nil)
+	_ libdns.ZoneLister = (*retryZoneLister)(nil)
+)
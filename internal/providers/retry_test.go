@@ -0,0 +1,265 @@
+package providers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+type statusError struct {
+	status int
+	after  time.Duration
+}
+
+func (e *statusError) Error() string                  { return fmt.Sprintf("status %d", e.status) }
+func (e *statusError) HTTPStatusCode() int            { return e.status }
+func (e *statusError) RetryAfterDelay() time.Duration { return e.after }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// flakyAdapter fails its calls with the queued errors, then succeeds
+type flakyAdapter struct {
+	errs  []error
+	calls int
+}
+
+func (a *flakyAdapter) next() error {
+	a.calls++
+	if len(a.errs) == 0 {
+		return nil
+	}
+	err := a.errs[0]
+	a.errs = a.errs[1:]
+	return err
+}
+
+func (a *flakyAdapter) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, a.next()
+}
+
+func (a *flakyAdapter) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, a.next()
+}
+
+func (a *flakyAdapter) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, a.next()
+}
+
+func (a *flakyAdapter) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, a.next()
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		after     time.Duration
+	}{
+		{name: "rate limited", err: &statusError{status: 429, after: 2 * time.Second}, retryable: true, after: 2 * time.Second},
+		{name: "server error", err: fmt.Errorf("set records: %w", &statusError{status: 503}), retryable: true},
+		{name: "not implemented", err: &statusError{status: 501}, retryable: false},
+		{name: "bad request", err: &statusError{status: 400}, retryable: false},
+		{name: "status only in message", err: errors.New("got error status: HTTP 502: []"), retryable: false},
+		{name: "library status", err: fmt.Errorf("cloudflare set records: %w", &StatusError{Err: errors.New("got error status: HTTP 502: []"), StatusCode: 502}), retryable: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, retryable: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), retryable: true},
+		{name: "truncated response", err: io.ErrUnexpectedEOF, retryable: true},
+		{name: "timeout", err: &url.Error{Op: "Put", URL: "https://api.example.com", Err: timeoutError{}}, retryable: true},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", Name: "api.example.com", IsNotFound: true}, retryable: false},
+		{name: "untrusted certificate", err: &url.Error{Op: "Get", URL: "https://api.example.com", Err: x509.UnknownAuthorityError{}}, retryable: false},
+		{name: "invalid url", err: &url.Error{Op: "parse", URL: "://api", Err: errors.New("missing protocol scheme")}, retryable: false},
+		{name: "canceled", err: context.Canceled, retryable: false},
+		{name: "invalid record", err: errors.New("invalid IP address"), retryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryable, after := IsRetryable(tt.err)
+			if retryable != tt.retryable || after != tt.after {
+				t.Fatalf("IsRetryable(%v) = %v, %s, want %v, %s", tt.err, retryable, after, tt.retryable, tt.after)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for header, want := range tests {
+		if got := ParseRetryAfter(header, now); got != want {
+			t.Fatalf("ParseRetryAfter(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestBackoffIsCappedWithJitter(t *testing.T) {
+	for n := 1; n <= 10; n++ {
+		want := min(100*time.Millisecond<<(n-1), time.Second)
+		for i := 0; i < 20; i++ {
+			if got := Backoff(100*time.Millisecond, time.Second, n); got < want/2 || got > want {
+				t.Fatalf("Backoff(n=%d) = %s, want between %s and %s", n, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestRetryAdapterRetriesTransientFailures(t *testing.T) {
+	inner := &flakyAdapter{errs: []error{
+		&statusError{status: 503},
+		&statusError{status: 429, after: 20 * time.Millisecond},
+	}}
+	var attempts []Attempt
+	adapter := NewRetryAdapter("test", inner, RetryOptions{
+		BaseDelay: time.Millisecond,
+		MaxDelay:  time.Second,
+		OnAttempt: func(attempt Attempt) { attempts = append(attempts, attempt) },
+	})
+
+	start := time.Now()
+	if _, err := adapter.SetRecords(context.Background(), "example.com", nil); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	if inner.calls != 3 {
+		t.Fatalf("calls = %d, want 3", inner.calls)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("elapsed = %s, want at least the 20ms Retry-After", elapsed)
+	}
+	if len(attempts) != 3 || !attempts[0].Retry || !attempts[1].Retry || attempts[2].Retry || attempts[2].Err != nil {
+		t.Fatalf("attempts = %+v, want two retries and a success", attempts)
+	}
+	if attempts[1].Delay < 20*time.Millisecond || attempts[2].Operation != "set" || attempts[2].Provider != "test" {
+		t.Fatalf("attempts = %+v, want the Retry-After delay and set operation", attempts)
+	}
+}
+
+func TestRetryAdapterGivesUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+	}{
+		{name: "permanent error", errs: []error{&statusError{status: 400}}, wantCalls: 1},
+		{name: "out of attempts", errs: []error{&statusError{status: 500}, &statusError{status: 500}, &statusError{status: 500}}, wantCalls: 3},
+		{name: "retry after beyond max delay", errs: []error{&statusError{status: 429, after: time.Hour}}, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyAdapter{errs: tt.errs}
+			adapter := NewRetryAdapter("test", inner, RetryOptions{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    10 * time.Millisecond,
+			})
+
+			_, err := adapter.SetRecords(context.Background(), "example.com", nil)
+			var status *statusError
+			if !errors.As(err, &status) {
+				t.Fatalf("SetRecords error = %v, want the provider error", err)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", inner.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryAdapterDoesNotRetryAppends(t *testing.T) {
+	inner := &flakyAdapter{errs: []error{timeoutError{}}}
+	var attempts []Attempt
+	adapter := NewRetryAdapter("test", inner, RetryOptions{
+		BaseDelay: time.Millisecond,
+		OnAttempt: func(attempt Attempt) { attempts = append(attempts, attempt) },
+	})
+
+	if _, err := adapter.AppendRecords(context.Background(), "example.com", nil); err == nil {
+		t.Fatal("expected the append to fail")
+	}
+	if inner.calls != 1 {
+		t.Fatalf("calls = %d, want 1", inner.calls)
+	}
+	if len(attempts) != 1 || attempts[0].Operation != "append" || attempts[0].Retry {
+		t.Fatalf("attempts = %+v, want one append without retry", attempts)
+	}
+}
+
+func TestRetryAdapterStopsWhenContextIsDone(t *testing.T) {
+	inner := &flakyAdapter{errs: []error{&statusError{status: 503}, &statusError{status: 503}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter := NewRetryAdapter("test", inner, RetryOptions{
+		BaseDelay: time.Hour,
+		MaxDelay:  time.Hour,
+		OnAttempt: func(Attempt) { cancel() },
+	})
+
+	if _, err := adapter.DeleteRecords(ctx, "example.com", nil); err == nil {
+		t.Fatal("expected error when the context is canceled during backoff")
+	}
+	if inner.calls != 1 {
+		t.Fatalf("calls = %d, want 1", inner.calls)
+	}
+}
+
+func TestNewRetryAdapterKeepsZoneLister(t *testing.T) {
+	if _, ok := NewRetryAdapter("test", &flakyAdapter{}, RetryOptions{}).(libdns.ZoneLister); ok {
+		t.Fatal("adapter without ListZones should not gain it")
+	}
+
+	lister := &listingAdapter{}
+	adapter, ok := NewRetryAdapter("test", lister, RetryOptions{}).(libdns.ZoneLister)
+	if !ok {
+		t.Fatal("adapter with ListZones should keep it")
+	}
+	zones, err := adapter.ListZones(context.Background())
+	if err != nil || len(zones) != 1 {
+		t.Fatalf("ListZones = %v, %v, want one zone", zones, err)
+	}
+}
+
+type listingAdapter struct {
+	flakyAdapter
+}
+
+func (a *listingAdapter) ListZones(context.Context) ([]libdns.Zone, error) {
+	return []libdns.Zone{{Name: "example.com."}}, a.next()
+}
+
+type txtlessProvider struct {
+	adapter Adapter
+}
+
+func (p *txtlessProvider) Name() string                     { return "local" }
+func (p *txtlessProvider) Type() string                     { return "local" }
+func (p *txtlessProvider) ZoneFilters() []string            { return nil }
+func (p *txtlessProvider) Adapter() Adapter                 { return p.adapter }
+func (p *txtlessProvider) SupportsRecordType(t string) bool { return t != "TXT" }
+
+func TestWithRetryKeepsRecordTypeSupport(t *testing.T) {
+	provider := WithRetry(&txtlessProvider{adapter: &flakyAdapter{}}, RetryOptions{})
+	if SupportsRecordType(provider, "TXT") || !SupportsRecordType(provider, "A") {
+		t.Fatal("wrapped provider should keep its record type support")
+	}
+}
@@ -0,0 +1,391 @@
+// Package rfc2136 manages records on authoritative servers such as BIND,
+// Knot or PowerDNS through RFC 2136 dynamic updates, optionally signed with
+// TSIG. Records are read back with a zone transfer (AXFR).
+package rfc2136
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultPort      = "53"
+	defaultAlgorithm = "hmac-sha256"
+	defaultTTL       = 300
+	tsigFudge        = 300
+)
+
+// algorithms maps the accepted tsig_algorithm values to their DNS names.
+var algorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+func init() {
+	providers.Register("rfc2136", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewRFC2136Provider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// RFC2136Provider implements the Provider interface for dynamic updates
+type RFC2136Provider struct {
+	name        string
+	zoneFilters []string
+	adapter     *RFC2136Adapter
+}
+
+// RFC2136Adapter sends dynamic updates and zone transfers to one server
+type RFC2136Adapter struct {
+	server    string
+	keyName   string
+	algorithm string
+	secret    string
+	ttl       *int
+	timeout   time.Duration
+}
+
+// Check validates the server and TSIG settings of cfg
+func Check(cfg config.ProviderConfig) error {
+	if cfg.Server == "" {
+		return fmt.Errorf("rfc2136 provider %q requires a server", cfg.Name)
+	}
+	if cfg.TSIGKeyName == "" && cfg.TSIGSecret == "" {
+		return nil
+	}
+	if cfg.TSIGKeyName == "" || cfg.TSIGSecret == "" {
+		return fmt.Errorf("rfc2136 provider %q requires both tsig_key_name and tsig_secret", cfg.Name)
+	}
+	if _, err := base64.StdEncoding.DecodeString(cfg.TSIGSecret); err != nil {
+		return fmt.Errorf("rfc2136 provider %q tsig_secret must be base64: %w", cfg.Name, err)
+	}
+	if _, ok := algorithms[tsigAlgorithm(cfg)]; !ok {
+		return fmt.Errorf("rfc2136 provider %q has unsupported tsig_algorithm %q", cfg.Name, cfg.TSIGAlgorithm)
+	}
+	return nil
+}
+
+// tsigAlgorithm returns the name of cfg's TSIG algorithm, hmac-sha256 by default
+func tsigAlgorithm(cfg config.ProviderConfig) string {
+	if name := strings.ToLower(strings.TrimSuffix(cfg.TSIGAlgorithm, ".")); name != "" {
+		return name
+	}
+	return defaultAlgorithm
+}
+
+// NewRFC2136Provider creates a new RFC 2136 provider from configuration
+func NewRFC2136Provider(cfg config.ProviderConfig) (*RFC2136Provider, error) {
+	if err := Check(cfg); err != nil {
+		return nil, err
+	}
+	server := cfg.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, defaultPort)
+	}
+
+	adapter := &RFC2136Adapter{
+		server:  server,
+		ttl:     cfg.TTL,
+		timeout: 10 * time.Second,
+	}
+
+	if cfg.TSIGKeyName != "" {
+		adapter.keyName = dns.CanonicalName(cfg.TSIGKeyName)
+		adapter.algorithm = algorithms[tsigAlgorithm(cfg)]
+		adapter.secret = cfg.TSIGSecret
+	}
+
+	return &RFC2136Provider{
+		name:        cfg.Name,
+		zoneFilters: cfg.ZoneFilters,
+		adapter:     adapter,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *RFC2136Provider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *RFC2136Provider) Type() string {
+	return "rfc2136"
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *RFC2136Provider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *RFC2136Provider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// GetRecords transfers the zone and returns every record except the SOA
+func (a *RFC2136Adapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	zone = dns.Fqdn(zone)
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136 get records: %w", err)
+	}
+	defer conn.Close()
+
+	msg := new(dns.Msg)
+	msg.SetAxfr(zone)
+	a.sign(msg)
+
+	transfer := &dns.Transfer{Conn: conn}
+	if a.keyName != "" {
+		transfer.TsigSecret = map[string]string{a.keyName: a.secret}
+	}
+	envelopes, err := transfer.In(msg, a.server)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136 get records: %w", err)
+	}
+
+	var records []libdns.Record
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("rfc2136 get records: zone transfer: %w", envelope.Error)
+		}
+		for _, rr := range envelope.RR {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				continue
+			}
+			records = append(records, fromRR(rr, zone))
+		}
+	}
+
+	return records, nil
+}
+
+// AppendRecords adds the records to the zone
+func (a *RFC2136Adapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	rrs, err := a.toRRs(records, zone)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136 append records: %w", err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+	msg.Insert(rrs)
+	if err := a.update(ctx, msg); err != nil {
+		return nil, fmt.Errorf("rfc2136 append records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SetRecords replaces each name and type's RRset with the given records in
+// a single update
+func (a *RFC2136Adapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	rrs, err := a.toRRs(records, zone)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136 set records: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var rrsets []dns.RR
+	for _, rr := range rrs {
+		key := fmt.Sprintf("%s/%d", strings.ToLower(rr.Header().Name), rr.Header().Rrtype)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rrsets = append(rrsets, rr)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+	msg.RemoveRRset(rrsets)
+	msg.Insert(rrs)
+	if err := a.update(ctx, msg); err != nil {
+		return nil, fmt.Errorf("rfc2136 set records: %w", err)
+	}
+
+	return records, nil
+}
+
+// DeleteRecords removes the records from the zone. A record without a value
+// removes the whole RRset, and one without a type removes every record at
+// the name
+func (a *RFC2136Adapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+
+	for _, record := range records {
+		rr := record.RR()
+		name := absoluteName(rr.Name, zone)
+		switch {
+		case rr.Type == "":
+			msg.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name}}})
+		case rr.Data == "":
+			rrtype, ok := dns.StringToType[strings.ToUpper(rr.Type)]
+			if !ok {
+				return nil, fmt.Errorf("rfc2136 delete records: unsupported type %q", rr.Type)
+			}
+			msg.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype}}})
+		default:
+			converted, err := a.toRR(record, zone)
+			if err != nil {
+				return nil, fmt.Errorf("rfc2136 delete records: %w", err)
+			}
+			msg.Remove([]dns.RR{converted})
+		}
+	}
+
+	if err := a.update(ctx, msg); err != nil {
+		return nil, fmt.Errorf("rfc2136 delete records: %w", err)
+	}
+
+	return records, nil
+}
+
+// update sends a signed UPDATE message and checks the response code
+func (a *RFC2136Adapter) update(ctx context.Context, msg *dns.Msg) error {
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if a.keyName != "" {
+		conn.TsigSecret = map[string]string{a.keyName: a.secret}
+	}
+	a.sign(msg)
+
+	if err := conn.WriteMsg(msg); err != nil {
+		return fmt.Errorf("send update: %w", err)
+	}
+	resp, err := conn.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read update response: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update refused: %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// dial opens a TCP connection to the server that honours ctx's deadline
+func (a *RFC2136Adapter) dial(ctx context.Context) (*dns.Conn, error) {
+	dialer := net.Dialer{Timeout: a.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", a.server)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", a.server, err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(a.timeout)
+	}
+	conn.SetDeadline(deadline)
+
+	return &dns.Conn{Conn: conn}, nil
+}
+
+func (a *RFC2136Adapter) sign(msg *dns.Msg) {
+	if a.keyName == "" {
+		return
+	}
+	msg.SetTsig(a.keyName, a.algorithm, tsigFudge, time.Now().Unix())
+}
+
+func (a *RFC2136Adapter) toRRs(records []libdns.Record, zone string) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		rr, err := a.toRR(record, zone)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// toRR converts a libdns record to a DNS RR, applying the configured TTL
+// when the record has none
+func (a *RFC2136Adapter) toRR(record libdns.Record, zone string) (dns.RR, error) {
+	rr := record.RR()
+
+	ttl := int(rr.TTL / time.Second)
+	if ttl == 0 {
+		ttl = defaultTTL
+		if a.ttl != nil {
+			ttl = *a.ttl
+		}
+	}
+
+	hdr := dns.RR_Header{
+		Name:   absoluteName(rr.Name, zone),
+		Class:  dns.ClassINET,
+		Ttl:    uint32(ttl),
+		Rrtype: dns.StringToType[strings.ToUpper(rr.Type)],
+	}
+	if strings.EqualFold(rr.Type, "TXT") {
+		return &dns.TXT{Hdr: hdr, Txt: providers.SplitTXT(rr.Data)}, nil
+	}
+
+	parsed, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", hdr.Name, ttl, strings.ToUpper(rr.Type), rr.Data))
+	if err != nil {
+		return nil, fmt.Errorf("convert %s record %q: %w", rr.Type, rr.Name, err)
+	}
+	if parsed == nil {
+		return nil, fmt.Errorf("convert %s record %q: empty record", rr.Type, rr.Name)
+	}
+	return parsed, nil
+}
+
+// fromRR converts a transferred RR to a libdns record relative to zone
+func fromRR(rr dns.RR, zone string) libdns.Record {
+	hdr := rr.Header()
+	converted := libdns.RR{
+		Name: libdns.RelativeName(hdr.Name, zone),
+		Type: dns.TypeToString[hdr.Rrtype],
+		TTL:  time.Duration(hdr.Ttl) * time.Second,
+		Data: strings.TrimPrefix(rr.String(), hdr.String()),
+	}
+	if txt, ok := rr.(*dns.TXT); ok {
+		converted.Data = providers.UnescapeTXT(strings.Join(txt.Txt, ""))
+	}
+
+	if record, err := converted.Parse(); err == nil {
+		return record
+	}
+	return converted
+}
+
+func absoluteName(name, zone string) string {
+	zone = dns.Fqdn(zone)
+	if name == "" || name == "@" {
+		return zone
+	}
+	if dns.IsFqdn(name) {
+		return name
+	}
+	return name + "." + zone
+}
+
+// Interface guards
+var (
+	_ providers.Provider = (*RFC2136Provider)(nil)
+	_ providers.Adapter  = (*RFC2136Adapter)(nil)
+)
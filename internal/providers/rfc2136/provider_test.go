@@ -0,0 +1,325 @@
+package rfc2136
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	testKeyName = "dns-sync."
+	testSecret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+)
+
+func TestNewRFC2136ProviderValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProviderConfig
+		errMsg string
+	}{
+		{
+			name:   "missing server",
+			cfg:    config.ProviderConfig{Name: "bind"},
+			errMsg: "requires a server",
+		},
+		{
+			name:   "key without secret",
+			cfg:    config.ProviderConfig{Name: "bind", Server: "ns1.lan", TSIGKeyName: "key"},
+			errMsg: "requires both tsig_key_name and tsig_secret",
+		},
+		{
+			name:   "secret not base64",
+			cfg:    config.ProviderConfig{Name: "bind", Server: "ns1.lan", TSIGKeyName: "key", TSIGSecret: "not base64!"},
+			errMsg: "must be base64",
+		},
+		{
+			name:   "unknown algorithm",
+			cfg:    config.ProviderConfig{Name: "bind", Server: "ns1.lan", TSIGKeyName: "key", TSIGSecret: testSecret, TSIGAlgorithm: "hmac-md5"},
+			errMsg: "unsupported tsig_algorithm",
+		},
+		{
+			name: "unsigned",
+			cfg:  config.ProviderConfig{Name: "bind", Server: "ns1.lan"},
+		},
+		{
+			name: "algorithm with trailing dot",
+			cfg:  config.ProviderConfig{Name: "bind", Server: "ns1.lan:5353", TSIGKeyName: "key", TSIGSecret: testSecret, TSIGAlgorithm: "HMAC-SHA512."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRFC2136Provider(tt.cfg)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("NewRFC2136Provider() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("NewRFC2136Provider() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestNewRFC2136ProviderDefaultsPort(t *testing.T) {
+	provider, err := NewRFC2136Provider(config.ProviderConfig{Name: "bind", Server: "192.0.2.53"})
+	if err != nil {
+		t.Fatalf("NewRFC2136Provider() error = %v", err)
+	}
+	if provider.adapter.server != "192.0.2.53:53" {
+		t.Fatalf("server = %q, want port 53 appended", provider.adapter.server)
+	}
+}
+
+func TestRFC2136AdapterRecordLifecycle(t *testing.T) {
+	server := newFakeServer(t, true)
+	adapter := newTestAdapter(t, server.addr, testSecret)
+	ctx := context.Background()
+
+	first := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")}
+	second := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.11")}
+	if _, err := adapter.AppendRecords(ctx, "home.lab", []libdns.Record{first, second}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if got := server.count("app.home.lab.", dns.TypeA); got != 2 {
+		t.Fatalf("A records = %d, want 2", got)
+	}
+
+	replacement := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.20"), TTL: time.Minute}
+	if _, err := adapter.SetRecords(ctx, "home.lab", []libdns.Record{replacement}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	owner := libdns.TXT{Name: "_caddy-dns.app", Text: strings.Repeat("x", 300)}
+	if _, err := adapter.AppendRecords(ctx, "home.lab", []libdns.Record{owner}); err != nil {
+		t.Fatalf("append txt: %v", err)
+	}
+
+	records, err := adapter.GetRecords(ctx, "home.lab")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %v, want A and TXT", records)
+	}
+	for _, record := range records {
+		rr := record.RR()
+		switch rr.Type {
+		case "A":
+			if rr.Name != "app" || rr.Data != "192.0.2.20" || rr.TTL != time.Minute {
+				t.Fatalf("A record = %+v, want app 192.0.2.20 with 1m TTL", rr)
+			}
+			if _, ok := record.(libdns.Address); !ok {
+				t.Fatalf("A record parsed as %T, want libdns.Address", record)
+			}
+		case "TXT":
+			if rr.Name != "_caddy-dns.app" || rr.Data != owner.Text {
+				t.Fatalf("TXT record = %+v, want the 300 byte owner text", rr)
+			}
+		default:
+			t.Fatalf("unexpected record %+v", rr)
+		}
+	}
+
+	if _, err := adapter.DeleteRecords(ctx, "home.lab", []libdns.Record{replacement, owner}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := server.count("app.home.lab.", dns.TypeA); got != 0 {
+		t.Fatalf("A records after delete = %d, want 0", got)
+	}
+	if got := server.count("_caddy-dns.app.home.lab.", dns.TypeTXT); got != 0 {
+		t.Fatalf("TXT records after delete = %d, want 0", got)
+	}
+}
+
+func TestRFC2136AdapterRoundTripsTXTEscapes(t *testing.T) {
+	server := newFakeServer(t, false)
+	adapter := newTestAdapter(t, server.addr, "")
+	ctx := context.Background()
+
+	for _, text := range []string{`say "hi"`, `C:\dns\`, `trailing \`} {
+		t.Run(text, func(t *testing.T) {
+			record := libdns.TXT{Name: "note", Text: text}
+			if _, err := adapter.SetRecords(ctx, "home.lab", []libdns.Record{record}); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			records, err := adapter.GetRecords(ctx, "home.lab")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if len(records) != 1 || records[0].RR().Data != text {
+				t.Fatalf("records = %v, want one TXT holding %q", records, text)
+			}
+		})
+	}
+}
+
+func TestRFC2136AdapterDeleteRRsetWithoutValue(t *testing.T) {
+	server := newFakeServer(t, false)
+	adapter := newTestAdapter(t, server.addr, "")
+	ctx := context.Background()
+
+	records := []libdns.Record{
+		libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")},
+		libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.11")},
+	}
+	if _, err := adapter.AppendRecords(ctx, "home.lab", records); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := adapter.DeleteRecords(ctx, "home.lab", []libdns.Record{libdns.RR{Name: "app", Type: "A"}}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := server.count("app.home.lab.", dns.TypeA); got != 0 {
+		t.Fatalf("A records = %d, want the whole RRset removed", got)
+	}
+}
+
+func TestRFC2136AdapterRejectsBadKey(t *testing.T) {
+	server := newFakeServer(t, true)
+	adapter := newTestAdapter(t, server.addr, "d3Jvbmctc2VjcmV0")
+
+	record := libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")}
+	if _, err := adapter.AppendRecords(context.Background(), "home.lab", []libdns.Record{record}); err == nil {
+		t.Fatal("expected append with the wrong TSIG secret to fail")
+	}
+	if got := server.count("app.home.lab.", dns.TypeA); got != 0 {
+		t.Fatalf("A records = %d, want the update refused", got)
+	}
+}
+
+func newTestAdapter(t *testing.T, addr, secret string) *RFC2136Adapter {
+	t.Helper()
+
+	cfg := config.ProviderConfig{Name: "bind", Server: addr}
+	if secret != "" {
+		cfg.TSIGKeyName = testKeyName
+		cfg.TSIGSecret = secret
+	}
+	provider, err := NewRFC2136Provider(cfg)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider.adapter
+}
+
+// fakeServer is an authoritative server for home.lab. that applies dynamic
+// updates to an in-memory zone and serves it over AXFR.
+type fakeServer struct {
+	addr        string
+	requireTSIG bool
+
+	mu      sync.Mutex
+	records []dns.RR
+}
+
+func newFakeServer(t *testing.T, requireTSIG bool) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	fake := &fakeServer{addr: listener.Addr().String(), requireTSIG: requireTSIG}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          listener,
+		Handler:           fake,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept func answers UPDATE with NOTIMP.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return fake
+}
+
+func (s *fakeServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+
+	if tsig := req.IsTsig(); tsig != nil {
+		if w.TsigStatus() != nil {
+			resp.SetRcode(req, dns.RcodeNotAuth)
+			w.WriteMsg(resp)
+			return
+		}
+		resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+	} else if s.requireTSIG {
+		resp.SetRcode(req, dns.RcodeRefused)
+		w.WriteMsg(resp)
+		return
+	}
+
+	switch {
+	case req.Opcode == dns.OpcodeUpdate:
+		s.apply(req.Ns)
+	case len(req.Question) == 1 && req.Question[0].Qtype == dns.TypeAXFR:
+		soa, _ := dns.NewRR("home.lab. 3600 IN SOA ns1.home.lab. admin.home.lab. 1 3600 600 86400 60")
+		s.mu.Lock()
+		resp.Answer = append([]dns.RR{soa}, s.records...)
+		s.mu.Unlock()
+		resp.Answer = append(resp.Answer, soa)
+	default:
+		resp.SetRcode(req, dns.RcodeNotImplemented)
+	}
+	w.WriteMsg(resp)
+}
+
+func (s *fakeServer) apply(updates []dns.RR) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, update := range updates {
+		hdr := update.Header()
+		switch hdr.Class {
+		case dns.ClassANY:
+			s.remove(func(rr dns.RR) bool {
+				return strings.EqualFold(rr.Header().Name, hdr.Name) &&
+					(hdr.Rrtype == dns.TypeANY || rr.Header().Rrtype == hdr.Rrtype)
+			})
+		case dns.ClassNONE:
+			target := dns.Copy(update)
+			target.Header().Class = dns.ClassINET
+			s.remove(func(rr dns.RR) bool { return dns.IsDuplicate(rr, target) })
+		default:
+			s.records = append(s.records, update)
+		}
+	}
+}
+
+func (s *fakeServer) remove(match func(dns.RR) bool) {
+	kept := s.records[:0]
+	for _, rr := range s.records {
+		if !match(rr) {
+			kept = append(kept, rr)
+		}
+	}
+	s.records = kept
+}
+
+func (s *fakeServer) count(name string, rrtype uint16) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, rr := range s.records {
+		if rr.Header().Name == name && rr.Header().Rrtype == rrtype {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// StatusError is an error from a library provider call, carrying the status
+// of the failed HTTP response behind it. Libraries such as libdns/cloudflare
+// only put the status in their error text, so adapters attach it with
+// WithStatus for retry classification.
+type StatusError struct {
+	Err        error
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusCode returns the response status, for retry classification.
+func (e *StatusError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// RetryAfterDelay returns how long the server asked to wait before retrying.
+func (e *StatusError) RetryAfterDelay() time.Duration {
+	return e.RetryAfter
+}
+
+type statusKey struct{}
+
+// failedResponse is the last error response a StatusClient saw for a call.
+type failedResponse struct {
+	mu         sync.Mutex
+	statusCode int
+	retryAfter time.Duration
+}
+
+// statusTransport notes error responses in the failedResponse of the
+// request's context.
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if failed, ok := req.Context().Value(statusKey{}).(*failedResponse); ok {
+		failed.mu.Lock()
+		failed.statusCode = resp.StatusCode
+		failed.retryAfter = ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		failed.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// NewStatusClient returns an HTTP client for a library provider whose error
+// responses WithStatus attaches to the provider's errors. A nil base uses
+// http.DefaultTransport.
+func NewStatusClient(base http.RoundTripper) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: statusTransport{base: base}}
+}
+
+// WithStatus runs call and wraps the error it returns in a StatusError when
+// a StatusClient saw an error response during the call.
+func WithStatus(ctx context.Context, call func(ctx context.Context) error) error {
+	failed := &failedResponse{}
+	err := call(context.WithValue(ctx, statusKey{}, failed))
+	if err == nil {
+		return nil
+	}
+
+	failed.mu.Lock()
+	defer failed.mu.Unlock()
+	if failed.statusCode == 0 {
+		return err
+	}
+	return &StatusError{Err: err, StatusCode: failed.statusCode, RetryAfter: failed.retryAfter}
+}
+
+// UseStatusClient gives a library provider a StatusClient when it has an
+// unset, exported HTTPClient field that can hold an *http.Client, as the
+// libdns Cloudflare provider does. It reports whether it did; providers
+// without such a field keep their own client, and only their typed network
+// errors can be classified.
+func UseStatusClient(provider any) bool {
+	v := reflect.ValueOf(provider)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	field, ok := v.Elem().Type().FieldByName("HTTPClient")
+	if !ok || !field.IsExported() {
+		return false
+	}
+	value, err := v.Elem().FieldByIndexErr(field.Index)
+	if err != nil || !value.CanSet() || !value.IsZero() {
+		return false
+	}
+
+	client := reflect.ValueOf(NewStatusClient(nil))
+	if !client.Type().AssignableTo(value.Type()) {
+		return false
+	}
+	value.Set(client)
+	return true
+}
@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/denied":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client := NewStatusClient(nil)
+
+	// call is a library call that only reports the status in its error text
+	call := func(path string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				return fmt.Errorf("got error status: HTTP %d", resp.StatusCode)
+			}
+			return errors.New("bad response body")
+		}
+	}
+
+	tests := []struct {
+		path      string
+		status    int
+		retryable bool
+		after     time.Duration
+	}{
+		{path: "/busy", status: http.StatusServiceUnavailable, retryable: true, after: 3 * time.Second},
+		{path: "/denied", status: http.StatusForbidden},
+		{path: "/ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := WithStatus(context.Background(), call(tt.path))
+
+			var statusErr *StatusError
+			if got := errors.As(err, &statusErr); got != (tt.status != 0) {
+				t.Fatalf("error %v has a status: %v, want %v", err, got, tt.status != 0)
+			}
+			if statusErr != nil && statusErr.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", statusErr.StatusCode, tt.status)
+			}
+			if retryable, after := IsRetryable(err); retryable != tt.retryable || after != tt.after {
+				t.Fatalf("IsRetryable = %v, %s, want %v, %s", retryable, after, tt.retryable, tt.after)
+			}
+		})
+	}
+
+	if err := WithStatus(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("WithStatus = %v, want nil for a call that succeeds", err)
+	}
+}
+
+type doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+func TestUseStatusClient(t *testing.T) {
+	type interfaceField struct{ HTTPClient doer }
+	type clientField struct{ HTTPClient *http.Client }
+	type embedded struct{ *clientField }
+	type other struct{ Client *http.Client }
+
+	own := &http.Client{}
+	tests := []struct {
+		name     string
+		provider any
+		want     bool
+	}{
+		{name: "interface field", provider: &interfaceField{}, want: true},
+		{name: "client field", provider: &clientField{}, want: true},
+		{name: "embedded provider", provider: &embedded{&clientField{}}, want: true},
+		{name: "client already set", provider: &clientField{HTTPClient: own}},
+		{name: "nil embedded provider", provider: &embedded{}},
+		{name: "no client field", provider: &other{}},
+		{name: "not a pointer", provider: clientField{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UseStatusClient(tt.provider); got != tt.want {
+				t.Fatalf("UseStatusClient = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package providers
+
+import "strings"
+
+// SplitTXT splits text into the 255-byte character strings a TXT record
+// is made of, escaped the way the miekg/dns package keeps them.
+func SplitTXT(text string) []string {
+	var parts []string
+	for len(text) > 255 {
+		parts = append(parts, escapeTXT(text[:255]))
+		text = text[255:]
+	}
+	return append(parts, escapeTXT(text))
+}
+
+func escapeTXT(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// UnescapeTXT reverses the miekg/dns package's presentation escapes: \X for
+// a literal X and \DDD for a decimal byte value.
+func UnescapeTXT(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			b.WriteByte(text[i])
+			continue
+		}
+		if i+3 < len(text) && isDigit(text[i+1]) && isDigit(text[i+2]) && isDigit(text[i+3]) {
+			b.WriteByte((text[i+1]-'0')*100 + (text[i+2]-'0')*10 + (text[i+3] - '0'))
+			i += 3
+			continue
+		}
+		i++
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
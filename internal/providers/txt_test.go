@@ -0,0 +1,26 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTXTRoundTrips(t *testing.T) {
+	for _, text := range []string{"", "heritage=caddy-dns", `say "hi"`, `C:\dns\`, strings.Repeat("x", 300)} {
+		parts := SplitTXT(text)
+		for _, part := range parts {
+			if len(UnescapeTXT(part)) > 255 {
+				t.Fatalf("SplitTXT(%q) part %q is longer than 255 bytes", text, part)
+			}
+		}
+		if got := UnescapeTXT(strings.Join(parts, "")); got != text {
+			t.Fatalf("UnescapeTXT(SplitTXT(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestUnescapeTXTDecimalEscapes(t *testing.T) {
+	if got := UnescapeTXT(`tab\009here\;`); got != "tab\there;" {
+		t.Fatalf("UnescapeTXT = %q, want a tab and a literal semicolon", got)
+	}
+}
@@ -0,0 +1,240 @@
+package unifi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+const defaultSite = "default"
+
+// staticDNSEntry is a static DNS entry as returned by the UniFi Network v2 API.
+type staticDNSEntry struct {
+	ID         string `json:"_id,omitempty"`
+	Key        string `json:"key"`
+	RecordType string `json:"record_type"`
+	Value      string `json:"value"`
+	Enabled    bool   `json:"enabled"`
+	TTL        int    `json:"ttl"`
+	Port       int    `json:"port,omitempty"`
+	Priority   int    `json:"priority,omitempty"`
+	Weight     int    `json:"weight,omitempty"`
+}
+
+// client is a logged-in session with a UniFi Network controller. It supports
+// both UniFi OS consoles, which serve the Network API under /proxy/network,
+// and standalone controllers.
+type client struct {
+	http     *http.Client
+	baseURL  string
+	username string
+	password string
+	site     string
+	session  *providers.Session
+
+	// mu guards the session state below.
+	mu        sync.Mutex
+	unifiOS   bool
+	csrfToken string
+}
+
+func newClient(baseURL, username, password string, httpClient *http.Client) *client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if httpClient.Jar == nil {
+		jar, _ := cookiejar.New(nil)
+		httpClient.Jar = jar
+	}
+
+	c := &client{
+		http:     httpClient,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+		site:     defaultSite,
+	}
+	c.session = providers.NewSession(c.login)
+	return c
+}
+
+func (c *client) listStaticDNS(ctx context.Context) ([]staticDNSEntry, error) {
+	var entries []staticDNSEntry
+	if err := c.call(ctx, http.MethodGet, c.staticDNSPath(""), nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *client) createStaticDNS(ctx context.Context, entry staticDNSEntry) (staticDNSEntry, error) {
+	var created staticDNSEntry
+	if err := c.call(ctx, http.MethodPost, c.staticDNSPath(""), entry, &created); err != nil {
+		return staticDNSEntry{}, err
+	}
+	return created, nil
+}
+
+func (c *client) deleteStaticDNS(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, c.staticDNSPath(id), nil, nil)
+}
+
+func (c *client) staticDNSPath(id string) string {
+	path := "/v2/api/site/" + url.PathEscape(c.site) + "/static-dns"
+	if id != "" {
+		path += "/" + url.PathEscape(id)
+	}
+	return path
+}
+
+// call sends an API request, logging in first if needed and once more if the
+// session has expired.
+func (c *client) call(ctx context.Context, method, path string, body, out any) error {
+	return c.session.Call(ctx, func() error {
+		return c.do(ctx, method, path, body, out)
+	})
+}
+
+func (c *client) login(ctx context.Context) error {
+	credentials := map[string]any{
+		"username": c.username,
+		"password": c.password,
+		"remember": true,
+	}
+
+	// UniFi OS consoles log in at /api/auth/login; standalone controllers
+	// answer that path with 404 and use /api/login instead.
+	resp, err := c.send(ctx, http.MethodPost, c.baseURL+"/api/auth/login", credentials)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	unifiOS := true
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		unifiOS = false
+		resp, err = c.send(ctx, http.MethodPost, c.baseURL+"/api/login", credentials)
+		if err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("login: %w", decodeAPIError(resp))
+	}
+
+	c.mu.Lock()
+	c.unifiOS = unifiOS
+	c.mu.Unlock()
+	c.captureCSRF(resp)
+	return nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	c.mu.Lock()
+	endpoint := c.baseURL + path
+	if c.unifiOS {
+		endpoint = c.baseURL + "/proxy/network" + path
+	}
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.captureCSRF(resp)
+	if resp.StatusCode/100 != 2 {
+		return decodeAPIError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *client) send(ctx context.Context, method, endpoint string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if method != http.MethodGet {
+		c.mu.Lock()
+		token := c.csrfToken
+		c.mu.Unlock()
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+	}
+
+	return c.http.Do(req)
+}
+
+// captureCSRF remembers the CSRF token the controller hands out. UniFi OS
+// sends it on login and rotates it through X-Updated-CSRF-Token; standalone
+// controllers set it as a csrf_token cookie, which the jar already replays,
+// but still expect it echoed in the header.
+func (c *client) captureCSRF(resp *http.Response) {
+	token := resp.Header.Get("X-Updated-CSRF-Token")
+	if token == "" {
+		token = resp.Header.Get("X-CSRF-Token")
+	}
+	if token == "" {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == "csrf_token" {
+				token = cookie.Value
+			}
+		}
+	}
+	if token == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.csrfToken = token
+	c.mu.Unlock()
+}
+
+func decodeAPIError(resp *http.Response) error {
+	return providers.NewAPIError("unifi", resp, func(body []byte) string {
+		var payload struct {
+			Message string `json:"message"`
+			Meta    struct {
+				Msg string `json:"msg"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ""
+		}
+		if payload.Message != "" {
+			return payload.Message
+		}
+		return payload.Meta.Msg
+	})
+}
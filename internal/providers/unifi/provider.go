@@ -0,0 +1,236 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+	"github.com/libdns/libdns"
+)
+
+func init() {
+	providers.Register("unifi", func(_ caddy.Context, cfg config.ProviderConfig) (providers.Provider, error) {
+		provider, err := NewUnifiProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}, Check)
+}
+
+// UnifiProvider implements the Provider interface for UniFi static DNS
+type UnifiProvider struct {
+	name         string
+	providerType string
+	zoneFilters  []string
+	adapter      *UnifiAdapter
+}
+
+// UnifiAdapter manages UniFi static DNS entries through the libdns interfaces
+type UnifiAdapter struct {
+	client *client
+	ttl    *int
+}
+
+// NewUnifiProvider creates a new UniFi provider from configuration
+func NewUnifiProvider(cfg config.ProviderConfig) (*UnifiProvider, error) {
+	return newUnifiProvider(cfg, nil)
+}
+
+// Check validates the controller settings of cfg without contacting it
+func Check(cfg config.ProviderConfig) error {
+	if cfg.ControllerURL == "" {
+		return fmt.Errorf("unifi provider %q requires a controller_url", cfg.Name)
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return fmt.Errorf("unifi provider %q requires a username and password", cfg.Name)
+	}
+	return nil
+}
+
+func newUnifiProvider(cfg config.ProviderConfig, httpClient *http.Client) (*UnifiProvider, error) {
+	if err := Check(cfg); err != nil {
+		return nil, err
+	}
+
+	return &UnifiProvider{
+		name:         cfg.Name,
+		providerType: "unifi",
+		zoneFilters:  cfg.ZoneFilters,
+		adapter: &UnifiAdapter{
+			client: newClient(cfg.ControllerURL, cfg.Username, cfg.Password, httpClient),
+			ttl:    cfg.TTL,
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (p *UnifiProvider) Name() string {
+	return p.name
+}
+
+// Type returns the provider type
+func (p *UnifiProvider) Type() string {
+	return p.providerType
+}
+
+// ZoneFilters returns the zone filters for this provider
+func (p *UnifiProvider) ZoneFilters() []string {
+	return p.zoneFilters
+}
+
+// Adapter returns the libdns adapter
+func (p *UnifiProvider) Adapter() providers.Adapter {
+	return p.adapter
+}
+
+// GetRecords lists the static DNS entries that belong to a zone
+func (a *UnifiAdapter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	entries, err := a.client.listStaticDNS(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unifi get records: %w", err)
+	}
+
+	var records []libdns.Record
+	for _, entry := range entries {
+		if !providers.InZone(entry.Key, zone) {
+			continue
+		}
+		records = append(records, toRecord(entry, zone))
+	}
+
+	return records, nil
+}
+
+// AppendRecords creates a static DNS entry for each record
+func (a *UnifiAdapter) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	created := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		entry, err := a.client.createStaticDNS(ctx, a.toEntry(record, zone))
+		if err != nil {
+			return created, fmt.Errorf("unifi append records: %w", err)
+		}
+		created = append(created, toRecord(entry, zone))
+	}
+
+	return created, nil
+}
+
+// SetRecords makes the entries for each name and type match the given records
+// exactly, leaving entries for other names and types alone. An entry whose
+// TTL changed is deleted and created again
+func (a *UnifiAdapter) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	entries, err := a.client.listStaticDNS(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unifi set records: %w", err)
+	}
+
+	desired := make(map[string]map[string]int) // values and their TTLs
+	for _, record := range records {
+		entry := a.toEntry(record, zone)
+		key := entryKey(entry)
+		if desired[key] == nil {
+			desired[key] = make(map[string]int)
+		}
+		desired[key][entry.Value] = entry.TTL
+	}
+
+	existing := make(map[string]bool)
+	for _, entry := range entries {
+		values, ok := desired[entryKey(entry)]
+		if !ok {
+			continue
+		}
+		if ttl, ok := values[entry.Value]; ok && ttl == entry.TTL {
+			existing[entryKey(entry)+"="+entry.Value] = true
+			continue
+		}
+		if err := a.client.deleteStaticDNS(ctx, entry.ID); err != nil {
+			return nil, fmt.Errorf("unifi set records: %w", err)
+		}
+	}
+
+	set := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		entry := a.toEntry(record, zone)
+		if existing[entryKey(entry)+"="+entry.Value] {
+			set = append(set, record)
+			continue
+		}
+		created, err := a.client.createStaticDNS(ctx, entry)
+		if err != nil {
+			return set, fmt.Errorf("unifi set records: %w", err)
+		}
+		set = append(set, toRecord(created, zone))
+	}
+
+	return set, nil
+}
+
+// DeleteRecords removes the entries matching each record. An empty type or
+// value in a record matches any type or value
+func (a *UnifiAdapter) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	entries, err := a.client.listStaticDNS(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unifi delete records: %w", err)
+	}
+
+	var deleted []libdns.Record
+	for _, entry := range entries {
+		if !providers.MatchesAny(records, zone, entry.Key, entry.RecordType, entry.Value) {
+			continue
+		}
+		if err := a.client.deleteStaticDNS(ctx, entry.ID); err != nil {
+			return deleted, fmt.Errorf("unifi delete records: %w", err)
+		}
+		deleted = append(deleted, toRecord(entry, zone))
+	}
+
+	return deleted, nil
+}
+
+// toEntry converts a libdns record to a static DNS entry, applying the
+// configured TTL when the record has none
+func (a *UnifiAdapter) toEntry(record libdns.Record, zone string) staticDNSEntry {
+	rr := record.RR()
+	ttl := rr.TTL
+	if ttl == 0 && a.ttl != nil {
+		ttl = time.Duration(*a.ttl) * time.Second
+	}
+
+	return staticDNSEntry{
+		Key:        providers.AbsoluteName(rr.Name, zone),
+		RecordType: strings.ToUpper(rr.Type),
+		Value:      rr.Data,
+		Enabled:    true,
+		TTL:        int(ttl / time.Second),
+	}
+}
+
+func toRecord(entry staticDNSEntry, zone string) libdns.Record {
+	rr := libdns.RR{
+		Name: libdns.RelativeName(entry.Key, zone),
+		Type: entry.RecordType,
+		Data: entry.Value,
+		TTL:  time.Duration(entry.TTL) * time.Second,
+	}
+	if record, err := rr.Parse(); err == nil {
+		return record
+	}
+	return rr
+}
+
+func entryKey(entry staticDNSEntry) string {
+	return strings.ToLower(entry.Key) + "/" + strings.ToUpper(entry.RecordType)
+}
+
+// Interface guards
+var (
+	_ providers.Provider = (*UnifiProvider)(nil)
+	_ providers.Adapter  = (*UnifiAdapter)(nil)
+)
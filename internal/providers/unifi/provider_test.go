@@ -0,0 +1,363 @@
+package unifi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/libdns/libdns"
+)
+
+func TestNewUnifiProviderRequiresControllerFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProviderConfig
+		errMsg string
+	}{
+		{
+			name:   "missing controller url",
+			cfg:    config.ProviderConfig{Name: "lan", Username: "admin", Password: "secret"},
+			errMsg: "requires a controller_url",
+		},
+		{
+			name:   "missing password",
+			cfg:    config.ProviderConfig{Name: "lan", ControllerURL: "https://unifi.local", Username: "admin"},
+			errMsg: "requires a username and password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewUnifiProvider(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("NewUnifiProvider() error = %v, want error containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestUnifiAdapter(t *testing.T) {
+	app := []libdns.Record{libdns.Address{Name: "app", IP: netip.MustParseAddr("192.168.1.10")}}
+	tests := []struct {
+		name     string
+		unifiOS  bool
+		password string
+		expire   bool // let the session expire before the operation
+		seed     []staticDNSEntry
+		op       string // get, append, set or delete
+		records  []libdns.Record
+		want     []string // the controller's entries after the operation
+		wantGot  []string // the records the operation returned
+		wantErr  string
+	}{
+		{
+			name:    "append on unifi os",
+			unifiOS: true,
+			op:      "append",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60"},
+		},
+		{
+			name:    "append on a standalone controller",
+			op:      "append",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60"},
+		},
+		{
+			name:    "append after the session expired",
+			unifiOS: true,
+			expire:  true,
+			op:      "append",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60"},
+		},
+		{
+			name: "set replaces the value",
+			seed: []staticDNSEntry{
+				{Key: "app.home.lab", RecordType: "A", Value: "192.168.1.9"},
+				{Key: "nas.home.lab", RecordType: "A", Value: "192.168.1.2"},
+			},
+			op:      "set",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60", "nas.home.lab A 192.168.1.2 0"},
+		},
+		{
+			name: "set replaces an entry whose TTL changed",
+			seed: []staticDNSEntry{
+				{Key: "app.home.lab", RecordType: "A", Value: "192.168.1.10", TTL: 300},
+			},
+			op:      "set",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60"},
+		},
+		{
+			name: "set keeps an unchanged entry",
+			seed: []staticDNSEntry{
+				{Key: "app.home.lab", RecordType: "A", Value: "192.168.1.10", TTL: 60},
+			},
+			op:      "set",
+			records: app,
+			want:    []string{"app.home.lab A 192.168.1.10 60"},
+		},
+		{
+			name:    "delete",
+			seed:    []staticDNSEntry{{Key: "app.home.lab", RecordType: "A", Value: "192.168.1.10"}},
+			op:      "delete",
+			records: app,
+		},
+		{
+			name: "get filters the zone",
+			seed: []staticDNSEntry{
+				{Key: "app.home.lab", RecordType: "A", Value: "192.168.1.10"},
+				{Key: "app.example.com", RecordType: "A", Value: "192.0.2.10"},
+			},
+			op:      "get",
+			want:    []string{"app.example.com A 192.0.2.10 0", "app.home.lab A 192.168.1.10 0"},
+			wantGot: []string{"app A 192.168.1.10"},
+		},
+		{
+			name:     "login failure",
+			password: "wrong",
+			op:       "get",
+			wantErr:  "status 401: api.err.Invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := newFakeController(t, tt.unifiOS)
+			for _, entry := range tt.seed {
+				controller.seed(entry)
+			}
+			adapter := newTestAdapter(t, controller, tt.password)
+			ctx := context.Background()
+
+			if tt.expire {
+				if _, err := adapter.GetRecords(ctx, "home.lab"); err != nil {
+					t.Fatalf("get: %v", err)
+				}
+				controller.expireSessions()
+			}
+
+			var got []libdns.Record
+			var err error
+			switch tt.op {
+			case "get":
+				got, err = adapter.GetRecords(ctx, "home.lab")
+			case "append":
+				got, err = adapter.AppendRecords(ctx, "home.lab", tt.records)
+			case "set":
+				got, err = adapter.SetRecords(ctx, "home.lab", tt.records)
+			case "delete":
+				got, err = adapter.DeleteRecords(ctx, "home.lab", tt.records)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("%s error = %v, want one containing %q", tt.op, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.op, err)
+			}
+
+			if entries := controller.list(); !slices.Equal(entries, tt.want) {
+				t.Fatalf("entries = %q, want %q", entries, tt.want)
+			}
+			if tt.wantGot != nil {
+				var rrs []string
+				for _, record := range got {
+					rr := record.RR()
+					rrs = append(rrs, rr.Name+" "+rr.Type+" "+rr.Data)
+				}
+				if !slices.Equal(rrs, tt.wantGot) {
+					t.Fatalf("records = %q, want %q", rrs, tt.wantGot)
+				}
+			}
+		})
+	}
+}
+
+func newTestAdapter(t *testing.T, controller *fakeController, password string) *UnifiAdapter {
+	t.Helper()
+
+	if password == "" {
+		password = "secret"
+	}
+	ttl := 60
+	provider, err := newUnifiProvider(config.ProviderConfig{
+		Name:          "lan",
+		Type:          "unifi",
+		ControllerURL: controller.server.URL,
+		Username:      "admin",
+		Password:      password,
+		ZoneFilters:   []string{"home.lab"},
+		TTL:           &ttl,
+	}, controller.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider.adapter
+}
+
+// fakeController is a stand-in UniFi Network controller. In UniFi OS mode it
+// issues a TOKEN cookie and an X-CSRF-Token header and serves the API under
+// /proxy/network; otherwise it behaves like a standalone controller with
+// unifises and csrf_token cookies.
+type fakeController struct {
+	server  *httptest.Server
+	unifiOS bool
+
+	mu       sync.Mutex
+	entries  map[string]staticDNSEntry
+	sessions map[string]string // session cookie -> csrf token
+	seq      int
+	loginN   int
+}
+
+func newFakeController(t *testing.T, unifiOS bool) *fakeController {
+	t.Helper()
+
+	c := &fakeController{
+		unifiOS:  unifiOS,
+		entries:  make(map[string]staticDNSEntry),
+		sessions: make(map[string]string),
+	}
+
+	prefix := ""
+	mux := http.NewServeMux()
+	if unifiOS {
+		prefix = "/proxy/network"
+		mux.HandleFunc("POST /api/auth/login", c.login)
+	} else {
+		mux.HandleFunc("POST /api/login", c.login)
+	}
+	mux.HandleFunc("GET "+prefix+"/v2/api/site/default/static-dns", c.authorized(c.handleList))
+	mux.HandleFunc("POST "+prefix+"/v2/api/site/default/static-dns", c.authorized(c.create))
+	mux.HandleFunc("DELETE "+prefix+"/v2/api/site/default/static-dns/{id}", c.authorized(c.remove))
+
+	c.server = httptest.NewServer(mux)
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func (c *fakeController) sessionCookie() string {
+	if c.unifiOS {
+		return "TOKEN"
+	}
+	return "unifises"
+}
+
+func (c *fakeController) login(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Username != "admin" || body.Password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"meta": map[string]string{"rc": "error", "msg": "api.err.Invalid"}})
+		return
+	}
+
+	c.mu.Lock()
+	c.loginN++
+	session := fmt.Sprintf("session-%d", c.loginN)
+	csrf := fmt.Sprintf("csrf-%d", c.loginN)
+	c.sessions[session] = csrf
+	c.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: c.sessionCookie(), Value: session, Path: "/"})
+	if c.unifiOS {
+		w.Header().Set("X-CSRF-Token", csrf)
+	} else {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: csrf, Path: "/"})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"meta": map[string]string{"rc": "ok"}})
+}
+
+func (c *fakeController) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(c.sessionCookie())
+		c.mu.Lock()
+		csrf, ok := "", false
+		if err == nil {
+			csrf, ok = c.sessions[cookie.Value]
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Header.Get("X-CSRF-Token") != csrf {
+			http.Error(w, `{"message":"invalid csrf token"}`, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (c *fakeController) handleList(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	entries := make([]staticDNSEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	c.mu.Unlock()
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (c *fakeController) create(w http.ResponseWriter, r *http.Request) {
+	var entry staticDNSEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(c.seed(entry))
+}
+
+func (c *fakeController) remove(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := c.entries[id]; !ok {
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+		return
+	}
+	delete(c.entries, id)
+}
+
+func (c *fakeController) seed(entry staticDNSEntry) staticDNSEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	entry.ID = fmt.Sprintf("%024x", c.seq)
+	c.entries[entry.ID] = entry
+	return entry
+}
+
+// list returns the entries as sorted "key type value ttl" lines
+func (c *fakeController) list() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var lines []string
+	for _, entry := range c.entries {
+		lines = append(lines, fmt.Sprintf("%s %s %s %d", entry.Key, entry.RecordType, entry.Value, entry.TTL))
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+func (c *fakeController) expireSessions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessions = make(map[string]string)
+}
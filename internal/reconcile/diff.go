@@ -0,0 +1,237 @@
+package reconcile
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+)
+
+// DiffAction is the change needed to bring a record in line with the
+// desired state.
+type DiffAction string
+
+const (
+	// DiffCreate means the desired record is missing at the provider.
+	DiffCreate DiffAction = "create"
+	// DiffUpdate means the provider holds the name with the wrong value.
+	DiffUpdate DiffAction = "update"
+	// DiffDelete means a tracked record is no longer desired.
+	DiffDelete DiffAction = "delete"
+	// DiffAdopt means the provider already holds the desired record but it
+	// is not tracked yet, e.g. after a restart.
+	DiffAdopt DiffAction = "adopt"
+)
+
+// Diff is a single correction found by a reconciliation run.
+type Diff struct {
+	Action     DiffAction `json:"action"`
+	Hostname   string     `json:"hostname"`
+	Provider   string     `json:"provider"`
+	RecordType string     `json:"record_type"`
+	Desired    string     `json:"desired,omitempty"`
+	Actual     string     `json:"actual,omitempty"`
+	SourceID   string     `json:"source_id,omitempty"`
+
+	request dns.SyncRequest
+	// set holds every desired value of the RRset for an update.
+	set []dns.SyncRequest
+}
+
+// zoneRef identifies the records of one zone at one provider.
+type zoneRef struct {
+	provider string
+	zone     string
+}
+
+// zoneState is what a provider reported for a zone. When the zone cannot be
+// read, known is false and the tracked state is trusted instead.
+type zoneState struct {
+	records []libdns.Record
+	known   bool
+}
+
+// computeDiffs compares the desired requests with the provider's records and
+// the manager's tracked records, one RRset at a time. zoneFor returns the
+// zone of a hostname for a provider, or "" when none matches. owns reports
+// whether a zone's records mark a hostname as owned by this instance.
+func computeDiffs(desired []dns.SyncRequest, tracked []dns.DNSRecord, actual map[zoneRef]zoneState, zoneFor func(hostname, provider string) string, owns func(records []libdns.Record, hostname, provider, zone string) bool) []Diff {
+	trackedBySet := make(map[string][]dns.DNSRecord)
+	for _, record := range tracked {
+		key := setKey(record.Hostname, record.ProviderName, string(record.RecordType))
+		trackedBySet[key] = append(trackedBySet[key], record)
+	}
+
+	desiredBySet := make(map[string][]dns.SyncRequest)
+	for _, set := range dns.GroupRecordSets(desired) {
+		desiredBySet[setKey(set[0].Hostname, set[0].ProviderName, string(set[0].RecordType))] = set
+	}
+
+	var diffs []Diff
+	for _, key := range sortedKeys(desiredBySet) {
+		set := desiredBySet[key]
+		first := set[0]
+		trackedSet := trackedBySet[key]
+
+		desiredValues := make([]string, 0, len(set))
+		for _, req := range set {
+			desiredValues = append(desiredValues, req.Target)
+		}
+
+		zone := zoneFor(first.Hostname, first.ProviderName)
+		state, ok := actual[zoneRef{provider: first.ProviderName, zone: zone}]
+
+		// Without provider data, fall back to what we have written.
+		var values []string
+		if ok && state.known {
+			values = matchingValues(state.records, first.Hostname, zone, string(first.RecordType))
+			if len(values) > 0 && !owns(state.records, first.Hostname, first.ProviderName, zone) {
+				// Someone else's record; neither adopt nor overwrite it.
+				continue
+			}
+		} else {
+			for _, record := range trackedSet {
+				if record.State == dns.RecordStatePresent {
+					values = append(values, record.Value)
+				}
+			}
+		}
+
+		// A value that is no longer desired means the whole RRset is
+		// replaced, which also writes any missing values.
+		stale := staleValues(values, desiredValues)
+		for _, record := range trackedSet {
+			if !containsValue(desiredValues, record.Value) && !containsValue(stale, record.Value) {
+				stale = append(stale, record.Value)
+			}
+		}
+		if len(stale) > 0 {
+			diffs = append(diffs, Diff{
+				Action:     DiffUpdate,
+				Hostname:   first.Hostname,
+				Provider:   first.ProviderName,
+				RecordType: string(first.RecordType),
+				Desired:    strings.Join(desiredValues, ","),
+				Actual:     strings.Join(values, ","),
+				SourceID:   first.SourceID,
+				set:        set,
+			})
+			continue
+		}
+
+		for _, req := range set {
+			diff := Diff{
+				Hostname:   req.Hostname,
+				Provider:   req.ProviderName,
+				RecordType: string(req.RecordType),
+				Desired:    req.Target,
+				SourceID:   req.SourceID,
+				request:    req,
+			}
+			record, isTracked := findTracked(trackedSet, req.Target)
+			switch {
+			case !containsValue(values, req.Target):
+				diff.Action = DiffCreate
+			case !isTracked || record.State != dns.RecordStatePresent:
+				diff.Action = DiffAdopt
+				diff.Actual = req.Target
+			default:
+				continue
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+
+	for _, key := range sortedKeys(trackedBySet) {
+		if _, ok := desiredBySet[key]; ok {
+			continue
+		}
+		set := trackedBySet[key]
+		values := make([]string, 0, len(set))
+		for _, record := range set {
+			values = append(values, record.Value)
+		}
+		sort.Strings(values)
+		diffs = append(diffs, Diff{
+			Action:     DiffDelete,
+			Hostname:   set[0].Hostname,
+			Provider:   set[0].ProviderName,
+			RecordType: string(set[0].RecordType),
+			Actual:     strings.Join(values, ","),
+			SourceID:   set[0].SourceID,
+		})
+	}
+
+	return diffs
+}
+
+// staleValues returns the values that are not among the desired ones.
+func staleValues(values, desired []string) []string {
+	var stale []string
+	for _, value := range values {
+		if !containsValue(desired, value) {
+			stale = append(stale, value)
+		}
+	}
+	return stale
+}
+
+// findTracked returns the tracked record of an RRset holding value.
+func findTracked(records []dns.DNSRecord, value string) (dns.DNSRecord, bool) {
+	for _, record := range records {
+		if containsValue([]string{record.Value}, value) {
+			return record, true
+		}
+	}
+	return dns.DNSRecord{}, false
+}
+
+// matchingValues returns the values of records with the given name and type.
+func matchingValues(records []libdns.Record, hostname, zone, recordType string) []string {
+	name := libdns.RelativeName(strings.ToLower(hostname), zone)
+
+	var values []string
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(rr.Type, recordType) {
+			continue
+		}
+		if !strings.EqualFold(libdns.RelativeName(rr.Name, zone), name) {
+			continue
+		}
+		values = append(values, rr.Data)
+	}
+	return values
+}
+
+func containsValue(values []string, target string) bool {
+	targetAddr, targetErr := netip.ParseAddr(target)
+	for _, value := range values {
+		if targetErr == nil {
+			if addr, err := netip.ParseAddr(value); err == nil && addr == targetAddr {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(value, "."), strings.TrimSuffix(target, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func setKey(hostname, provider, recordType string) string {
+	return strings.ToLower(hostname) + ":" + provider + ":" + recordType
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
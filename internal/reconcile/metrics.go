@@ -0,0 +1,43 @@
+package reconcile
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	reconcileRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_reconcile_runs_total",
+			Help: "Total number of reconciliation runs by outcome",
+		},
+		[]string{"status"},
+	)
+
+	reconcileDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "caddy_dns_reconcile_duration_seconds",
+			Help:    "Duration of reconciliation runs",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	reconcileDiffs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_reconcile_diffs_applied_total",
+			Help: "Total number of drift corrections applied by reconciliation",
+		},
+		[]string{"provider", "action"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(reconcileRuns)
+	prometheus.MustRegister(reconcileDuration)
+	prometheus.MustRegister(reconcileDiffs)
+}
+
+func observeRun(run ReconciliationRun) {
+	reconcileRuns.WithLabelValues(string(run.Status)).Inc()
+	reconcileDuration.Observe(run.Duration.Seconds())
+	for _, diff := range run.DiffsApplied {
+		reconcileDiffs.WithLabelValues(diff.Provider, string(diff.Action)).Inc()
+	}
+}
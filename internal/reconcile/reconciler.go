@@ -0,0 +1,292 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+const (
+	defaultInterval = 5 * time.Minute
+	defaultHistory  = 20
+)
+
+// Status summarises the outcome of a reconciliation run.
+type Status string
+
+const (
+	StatusSuccess Status = "success"
+	StatusPartial Status = "partial"
+	StatusFailed  Status = "failed"
+)
+
+// ReconciliationRun records a single pass of the reconciler.
+type ReconciliationRun struct {
+	RunID        string        `json:"run_id"`
+	StartedAt    time.Time     `json:"started_at"`
+	CompletedAt  time.Time     `json:"completed_at"`
+	DiffsApplied []Diff        `json:"diffs_applied"`
+	Errors       []string      `json:"errors"`
+	Duration     time.Duration `json:"duration"`
+	Status       Status        `json:"status"`
+}
+
+// ContainerLister lists the containers that are currently running.
+type ContainerLister interface {
+	ListRunning(ctx context.Context) ([]dns.ContainerInfo, error)
+}
+
+// Options configures a Reconciler.
+type Options struct {
+	LabelPrefix string
+	Interval    time.Duration
+	// History is the number of past runs kept for inspection.
+	History int
+	Logger  *zap.Logger
+}
+
+// Reconciler periodically compares running containers with what each
+// provider actually holds and corrects any drift.
+type Reconciler struct {
+	lister  ContainerLister
+	manager *dns.Manager
+	opts    Options
+	logger  *zap.Logger
+	now     func() time.Time
+
+	mu   sync.Mutex
+	runs []ReconciliationRun
+	seq  int
+}
+
+// New returns a reconciler for manager that discovers containers with lister.
+func New(lister ContainerLister, manager *dns.Manager, opts Options) *Reconciler {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.History <= 0 {
+		opts.History = defaultHistory
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Reconciler{
+		lister:  lister,
+		manager: manager,
+		opts:    opts,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Run reconciles once immediately and then on every interval until ctx is
+// cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs a single reconciliation pass and records it.
+func (r *Reconciler) RunOnce(ctx context.Context) ReconciliationRun {
+	run := ReconciliationRun{
+		RunID:     r.nextRunID(),
+		StartedAt: r.now(),
+	}
+
+	attempted, err := r.reconcile(ctx, &run)
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+	}
+
+	run.CompletedAt = r.now()
+	run.Duration = run.CompletedAt.Sub(run.StartedAt)
+	run.Status = runStatus(err, attempted, len(run.DiffsApplied), len(run.Errors))
+
+	r.record(run)
+	r.manager.UpdateMetrics()
+	observeRun(run)
+
+	fields := []zap.Field{
+		zap.String("run_id", run.RunID),
+		zap.String("status", string(run.Status)),
+		zap.Int("diffs", len(run.DiffsApplied)),
+		zap.Int("errors", len(run.Errors)),
+		zap.Duration("duration", run.Duration),
+	}
+	if run.Status == StatusSuccess {
+		r.logger.Debug("reconciliation finished", fields...)
+	} else {
+		r.logger.Warn("reconciliation finished with errors", append(fields, zap.Strings("error_details", run.Errors))...)
+	}
+
+	return run
+}
+
+// LastRun returns the most recent run, if any.
+func (r *Reconciler) LastRun() (ReconciliationRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.runs) == 0 {
+		return ReconciliationRun{}, false
+	}
+	return r.runs[len(r.runs)-1], true
+}
+
+// Runs returns the retained run history, oldest first.
+func (r *Reconciler) Runs() []ReconciliationRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := make([]ReconciliationRun, len(r.runs))
+	copy(runs, r.runs)
+	return runs
+}
+
+// reconcile fills run with the diffs it applied and the per-diff errors. It
+// returns the number of diffs attempted, and an error when the run could not
+// even start.
+func (r *Reconciler) reconcile(ctx context.Context, run *ReconciliationRun) (int, error) {
+	containers, err := r.lister.ListRunning(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list containers: %w", err)
+	}
+
+	desired, err := r.manager.ComputeDesiredState(containers, r.opts.LabelPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("compute desired state: %w", err)
+	}
+	desired = r.manager.ResolveConflicts(desired)
+	tracked := r.manager.GetRecords()
+
+	actual, fetchErrs := r.fetchZones(ctx, desired, tracked)
+	for _, fetchErr := range fetchErrs {
+		run.Errors = append(run.Errors, fetchErr.Error())
+	}
+
+	diffs := allowedDiffs(computeDiffs(desired, tracked, actual, r.manager.ZoneForHostname, r.manager.OwnsRecord), r.manager.Policy())
+	for _, diff := range diffs {
+		if err := r.apply(ctx, diff); err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s %s (%s): %v", diff.Action, diff.Hostname, diff.Provider, err))
+			continue
+		}
+		run.DiffsApplied = append(run.DiffsApplied, diff)
+	}
+
+	return len(diffs), nil
+}
+
+// fetchZones reads the current records for every zone that has a desired or
+// tracked record. Zones that cannot be read, or whose provider cannot list
+// records, are left out so the tracked state is used for them instead.
+func (r *Reconciler) fetchZones(ctx context.Context, desired []dns.SyncRequest, tracked []dns.DNSRecord) (map[zoneRef]zoneState, []error) {
+	refs := make(map[zoneRef]struct{})
+	for _, req := range desired {
+		if zone := r.manager.ZoneForHostname(req.Hostname, req.ProviderName); zone != "" {
+			refs[zoneRef{provider: req.ProviderName, zone: zone}] = struct{}{}
+		}
+	}
+	for _, record := range tracked {
+		if zone := r.manager.ZoneForHostname(record.Hostname, record.ProviderName); zone != "" {
+			refs[zoneRef{provider: record.ProviderName, zone: zone}] = struct{}{}
+		}
+	}
+
+	actual := make(map[zoneRef]zoneState, len(refs))
+	var errs []error
+	for ref := range refs {
+		provider, ok := r.manager.Provider(ref.provider)
+		if !ok || !providers.SupportsListing(provider) {
+			continue
+		}
+		records, err := provider.Adapter().GetRecords(ctx, ref.zone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("get records for zone %q (%s): %w", ref.zone, ref.provider, err))
+			continue
+		}
+		actual[ref] = zoneState{records: records, known: true}
+	}
+
+	return actual, errs
+}
+
+// allowedDiffs drops the updates a create-only policy forbids. Deletes are
+// kept because the manager forgets records it may not delete.
+func allowedDiffs(diffs []Diff, policy dns.Policy) []Diff {
+	if policy.AllowsUpdate() {
+		return diffs
+	}
+	allowed := diffs[:0]
+	for _, diff := range diffs {
+		if diff.Action != DiffUpdate {
+			allowed = append(allowed, diff)
+		}
+	}
+	return allowed
+}
+
+func (r *Reconciler) apply(ctx context.Context, diff Diff) error {
+	switch diff.Action {
+	case DiffCreate:
+		return r.manager.CreateRecord(ctx, diff.request)
+	case DiffUpdate:
+		return r.manager.UpdateRecordSet(ctx, diff.set)
+	case DiffAdopt:
+		r.manager.AdoptRecord(diff.request)
+		return nil
+	case DiffDelete:
+		return r.manager.DeleteRecordSet(ctx, diff.Hostname, diff.Provider, dns.RecordType(diff.RecordType), diff.SourceID)
+	default:
+		return errors.New("unknown diff action")
+	}
+}
+
+func (r *Reconciler) nextRunID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	return fmt.Sprintf("%s-%d", r.now().UTC().Format("20060102T150405Z"), r.seq)
+}
+
+func (r *Reconciler) record(run ReconciliationRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runs = append(r.runs, run)
+	if len(r.runs) > r.opts.History {
+		r.runs = r.runs[len(r.runs)-r.opts.History:]
+	}
+}
+
+func runStatus(fatal error, attempted, applied, errCount int) Status {
+	switch {
+	case fatal != nil:
+		return StatusFailed
+	case errCount == 0:
+		return StatusSuccess
+	case attempted > 0 && applied == 0:
+		return StatusFailed
+	default:
+		return StatusPartial
+	}
+}
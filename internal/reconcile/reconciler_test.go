@@ -0,0 +1,393 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/libdns/libdns"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+	"github.com/cpritchett/caddy-dns-plugin/internal/providers"
+)
+
+func TestReconcileRecreatesHandDeletedRecord(t *testing.T) {
+	zone := newFakeZone()
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	ctx := context.Background()
+	first := reconciler.RunOnce(ctx)
+	if first.Status != StatusSuccess || len(first.DiffsApplied) != 1 || first.DiffsApplied[0].Action != DiffCreate {
+		t.Fatalf("first run = %+v, want one create", first)
+	}
+
+	// Someone deletes the record by hand.
+	zone.clear()
+
+	second := reconciler.RunOnce(ctx)
+	if len(second.DiffsApplied) != 1 || second.DiffsApplied[0].Action != DiffCreate {
+		t.Fatalf("second run diffs = %+v, want one create", second.DiffsApplied)
+	}
+	if got := zone.values("app"); len(got) != 1 || got[0] != "192.0.2.10" {
+		t.Fatalf("zone values = %v, want [192.0.2.10]", got)
+	}
+
+	third := reconciler.RunOnce(ctx)
+	if len(third.DiffsApplied) != 0 || third.Status != StatusSuccess {
+		t.Fatalf("third run = %+v, want no diffs", third)
+	}
+}
+
+func TestReconcileFixesWrongValue(t *testing.T) {
+	zone := newFakeZone()
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("198.51.100.1")})
+
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	run := reconciler.RunOnce(context.Background())
+	if len(run.DiffsApplied) != 1 {
+		t.Fatalf("diffs = %+v, want one", run.DiffsApplied)
+	}
+	diff := run.DiffsApplied[0]
+	if diff.Action != DiffUpdate || diff.Actual != "198.51.100.1" || diff.Desired != "192.0.2.10" {
+		t.Fatalf("diff = %+v, want update from 198.51.100.1 to 192.0.2.10", diff)
+	}
+	if zone.setCalls() != 1 {
+		t.Fatalf("set calls = %d, want 1", zone.setCalls())
+	}
+	if got := zone.values("app"); len(got) != 1 || got[0] != "192.0.2.10" {
+		t.Fatalf("zone values = %v, want [192.0.2.10]", got)
+	}
+}
+
+func TestReconcileReplacesRecordSetWithStaleValue(t *testing.T) {
+	zone := newFakeZone()
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")})
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("198.51.100.1")})
+
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+	web := container("web", "app.example.com", "192.0.2.10")
+	web.IPV4 = append(web.IPV4, "192.0.2.11")
+	reconciler := New(fakeLister{containers: []dns.ContainerInfo{web}}, manager, Options{LabelPrefix: "caddy_dns"})
+
+	run := reconciler.RunOnce(context.Background())
+	if len(run.DiffsApplied) != 1 || run.DiffsApplied[0].Action != DiffUpdate {
+		t.Fatalf("diffs = %+v, want one update", run.DiffsApplied)
+	}
+	if zone.setCalls() != 1 {
+		t.Fatalf("set calls = %d, want 1", zone.setCalls())
+	}
+	if got := zone.values("app"); len(got) != 2 || got[0] != "192.0.2.10" || got[1] != "192.0.2.11" {
+		t.Fatalf("zone values = %v, want [192.0.2.10 192.0.2.11]", got)
+	}
+	if records := manager.GetRecords(); len(records) != 2 {
+		t.Fatalf("tracked = %+v, want both addresses", records)
+	}
+
+	again := reconciler.RunOnce(context.Background())
+	if len(again.DiffsApplied) != 0 {
+		t.Fatalf("second run diffs = %+v, want none", again.DiffsApplied)
+	}
+}
+
+func TestReconcileAdoptsExistingRecord(t *testing.T) {
+	zone := newFakeZone()
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("192.0.2.10")})
+
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	run := reconciler.RunOnce(context.Background())
+	if len(run.DiffsApplied) != 1 || run.DiffsApplied[0].Action != DiffAdopt {
+		t.Fatalf("diffs = %+v, want one adopt", run.DiffsApplied)
+	}
+	if zone.writeCalls() != 0 {
+		t.Fatalf("write calls = %d, want 0 when adopting", zone.writeCalls())
+	}
+	if records := manager.GetRecords(); len(records) != 1 || records[0].SourceID != "web" {
+		t.Fatalf("tracked = %+v, want adopted record", records)
+	}
+}
+
+func TestReconcileLeavesUnownedRecordsAlone(t *testing.T) {
+	zone := newFakeZone()
+	zone.put(libdns.Address{Name: "app", IP: netip.MustParseAddr("198.51.100.1")})
+
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}}, dns.WithOwnerID("edge-1"))
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	run := reconciler.RunOnce(context.Background())
+	if len(run.DiffsApplied) != 0 || run.Status != StatusSuccess {
+		t.Fatalf("run = %+v, want no diffs for a record without an ownership marker", run)
+	}
+	if zone.writeCalls() != 0 {
+		t.Fatalf("write calls = %d, want 0", zone.writeCalls())
+	}
+}
+
+func TestReconcileDeletesRecordsOfGoneContainers(t *testing.T) {
+	zone := newFakeZone()
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+
+	lister := &fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+	reconciler.RunOnce(context.Background())
+
+	lister.containers = nil
+	run := reconciler.RunOnce(context.Background())
+
+	if len(run.DiffsApplied) != 1 || run.DiffsApplied[0].Action != DiffDelete {
+		t.Fatalf("diffs = %+v, want one delete", run.DiffsApplied)
+	}
+	if got := zone.values("app"); len(got) != 0 {
+		t.Fatalf("zone values = %v, want none", got)
+	}
+	if records := manager.GetRecords(); len(records) != 0 {
+		t.Fatalf("tracked = %d, want 0", len(records))
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	t.Run("failed when containers cannot be listed", func(t *testing.T) {
+		manager := dns.NewManager(nil)
+		reconciler := New(fakeLister{err: errors.New("docker unavailable")}, manager, Options{LabelPrefix: "caddy_dns"})
+
+		run := reconciler.RunOnce(context.Background())
+		if run.Status != StatusFailed || len(run.Errors) != 1 {
+			t.Fatalf("run = %+v, want failed with one error", run)
+		}
+	})
+
+	t.Run("partial when some diffs fail", func(t *testing.T) {
+		zone := newFakeZone()
+		zone.failAppend = map[string]bool{"bad": true}
+		manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: zone}})
+		lister := fakeLister{containers: []dns.ContainerInfo{
+			container("good", "good.example.com", "192.0.2.10"),
+			container("bad", "bad.example.com", "192.0.2.11"),
+		}}
+		reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+		run := reconciler.RunOnce(context.Background())
+		if run.Status != StatusPartial || len(run.DiffsApplied) != 1 || len(run.Errors) != 1 {
+			t.Fatalf("run = %+v, want partial with one diff and one error", run)
+		}
+	})
+
+	t.Run("history is retained", func(t *testing.T) {
+		reconciler := New(fakeLister{}, dns.NewManager(nil), Options{History: 2})
+		for i := 0; i < 3; i++ {
+			reconciler.RunOnce(context.Background())
+		}
+		runs := reconciler.Runs()
+		if len(runs) != 2 {
+			t.Fatalf("runs = %d, want 2", len(runs))
+		}
+		last, ok := reconciler.LastRun()
+		if !ok || last.RunID != runs[1].RunID {
+			t.Fatalf("last run = %+v, want %q", last, runs[1].RunID)
+		}
+	})
+}
+
+func TestReconcileTrustsTrackedStateWhenZoneIsUnreadable(t *testing.T) {
+	adapter := &unreadableAdapter{}
+	manager := dns.NewManager([]providers.Provider{&fakeProvider{adapter: adapter}})
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	reconciler.RunOnce(context.Background())
+	run := reconciler.RunOnce(context.Background())
+
+	if len(run.DiffsApplied) != 0 {
+		t.Fatalf("diffs = %+v, want none once tracked", run.DiffsApplied)
+	}
+	if len(run.Errors) != 1 {
+		t.Fatalf("errors = %v, want the get records failure", run.Errors)
+	}
+	if adapter.appends != 1 {
+		t.Fatalf("appends = %d, want 1", adapter.appends)
+	}
+}
+
+func TestReconcileTrustsTrackedStateWhenProviderCannotList(t *testing.T) {
+	adapter := &unreadableAdapter{}
+	manager := dns.NewManager([]providers.Provider{&writeOnlyProvider{fakeProvider{adapter: adapter}}})
+	lister := fakeLister{containers: []dns.ContainerInfo{container("web", "app.example.com", "192.0.2.10")}}
+	reconciler := New(lister, manager, Options{LabelPrefix: "caddy_dns"})
+
+	reconciler.RunOnce(context.Background())
+	run := reconciler.RunOnce(context.Background())
+
+	if len(run.DiffsApplied) != 0 || len(run.Errors) != 0 {
+		t.Fatalf("diffs = %+v, errors = %v, want neither once tracked", run.DiffsApplied, run.Errors)
+	}
+	if adapter.appends != 1 {
+		t.Fatalf("appends = %d, want 1", adapter.appends)
+	}
+}
+
+func container(id, hostname, ip string) dns.ContainerInfo {
+	return dns.ContainerInfo{
+		ID:        id,
+		Name:      id,
+		IsRunning: true,
+		IPV4:      []string{ip},
+		Labels: map[string]string{
+			"caddy_dns.hostname": hostname,
+			"caddy_dns.provider": "fake",
+		},
+	}
+}
+
+type fakeLister struct {
+	containers []dns.ContainerInfo
+	err        error
+}
+
+func (f fakeLister) ListRunning(context.Context) ([]dns.ContainerInfo, error) {
+	return f.containers, f.err
+}
+
+type fakeProvider struct {
+	adapter providers.Adapter
+}
+
+func (p *fakeProvider) Name() string               { return "fake" }
+func (p *fakeProvider) Type() string               { return "fake" }
+func (p *fakeProvider) ZoneFilters() []string      { return []string{"example.com"} }
+func (p *fakeProvider) Adapter() providers.Adapter { return p.adapter }
+
+// writeOnlyProvider cannot list records, like Caddy modules made for ACME.
+type writeOnlyProvider struct {
+	fakeProvider
+}
+
+func (p *writeOnlyProvider) SupportsListing() bool { return false }
+
+// fakeZone is a single example.com zone keyed by relative name.
+type fakeZone struct {
+	mu         sync.Mutex
+	records    map[string][]libdns.Record
+	failAppend map[string]bool
+	appends    int
+	sets       int
+}
+
+func newFakeZone() *fakeZone {
+	return &fakeZone{records: make(map[string][]libdns.Record)}
+}
+
+func (z *fakeZone) put(record libdns.Record) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	name := record.RR().Name
+	z.records[name] = append(z.records[name], record)
+}
+
+func (z *fakeZone) clear() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.records = make(map[string][]libdns.Record)
+}
+
+func (z *fakeZone) values(name string) []string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var values []string
+	for _, record := range z.records[name] {
+		values = append(values, record.RR().Data)
+	}
+	return values
+}
+
+func (z *fakeZone) setCalls() int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.sets
+}
+
+func (z *fakeZone) writeCalls() int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.appends + z.sets
+}
+
+func (z *fakeZone) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var all []libdns.Record
+	for _, records := range z.records {
+		all = append(all, records...)
+	}
+	return all, nil
+}
+
+func (z *fakeZone) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.appends++
+	for _, record := range records {
+		if z.failAppend[record.RR().Name] {
+			return nil, errors.New("provider rejected record")
+		}
+	}
+	for _, record := range records {
+		name := record.RR().Name
+		z.records[name] = append(z.records[name], record)
+	}
+	return records, nil
+}
+
+func (z *fakeZone) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.sets++
+	for _, record := range records {
+		z.records[record.RR().Name] = nil
+	}
+	for _, record := range records {
+		name := record.RR().Name
+		z.records[name] = append(z.records[name], record)
+	}
+	return records, nil
+}
+
+func (z *fakeZone) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, record := range records {
+		delete(z.records, record.RR().Name)
+	}
+	return records, nil
+}
+
+// unreadableAdapter accepts writes but fails to report what the provider holds.
+type unreadableAdapter struct {
+	appends int
+}
+
+func (a *unreadableAdapter) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, errors.New("listing not permitted")
+}
+
+func (a *unreadableAdapter) AppendRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	a.appends++
+	return records, nil
+}
+
+func (a *unreadableAdapter) SetRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
+
+func (a *unreadableAdapter) DeleteRecords(_ context.Context, _ string, records []libdns.Record) ([]libdns.Record, error) {
+	return records, nil
+}
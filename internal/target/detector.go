@@ -0,0 +1,190 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultPollInterval is how often a Detector checks the public address.
+const DefaultPollInterval = 5 * time.Minute
+
+// Detector tracks the public address the configured sources agree on and
+// reports when it changes, for dynamic DNS on connections whose address the
+// ISP reassigns. It serves the current address as a dns.TargetResolver.
+type Detector struct {
+	sources  []IPSource
+	interval time.Duration
+	logger   *zap.Logger
+	onChange func(ctx context.Context, old, new netip.Addr) error
+
+	mu      sync.Mutex
+	current netip.Addr
+}
+
+// NewDetector creates a detector polling sources.
+func NewDetector(sources []IPSource, opts Options) *Detector {
+	d := &Detector{
+		sources:  sources,
+		interval: opts.Interval,
+		logger:   opts.Logger,
+		onChange: opts.OnChange,
+	}
+	if d.interval <= 0 {
+		d.interval = DefaultPollInterval
+	}
+	if d.logger == nil {
+		d.logger = zap.NewNop()
+	}
+	return d
+}
+
+// Addresses returns the current public address, detecting it first if no
+// poll has succeeded yet.
+func (d *Detector) Addresses(ctx context.Context) ([]netip.Addr, error) {
+	d.mu.Lock()
+	current := d.current
+	d.mu.Unlock()
+	if current.IsValid() {
+		return []netip.Addr{current}, nil
+	}
+
+	// Detect without the lock so callers don't queue behind slow sources
+	addr, err := d.detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.current.IsValid() {
+		d.current = addr
+		d.logger.Info("public ip detected", zap.Stringer("address", addr))
+	}
+	return []netip.Addr{d.current}, nil
+}
+
+// Run polls until ctx is done.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks the public address once. When it changed, OnChange is called
+// with the old and new address.
+func (d *Detector) Poll(ctx context.Context) {
+	addr, err := d.detect(ctx)
+	if err != nil {
+		publicIPChecks.WithLabelValues("error").Inc()
+		d.logger.Warn("public ip check failed", zap.Error(err))
+		return
+	}
+	publicIPChecks.WithLabelValues("ok").Inc()
+
+	d.mu.Lock()
+	old := d.current
+	d.current = addr
+	d.mu.Unlock()
+
+	switch {
+	case !old.IsValid():
+		d.logger.Info("public ip detected", zap.Stringer("address", addr))
+		return
+	case old == addr:
+		return
+	}
+
+	publicIPChanges.Inc()
+	d.logger.Info("public ip changed",
+		zap.Stringer("old", old),
+		zap.Stringer("new", addr),
+	)
+	if d.onChange == nil {
+		return
+	}
+	if err := d.onChange(ctx, old, addr); err != nil {
+		d.logger.Error("could not move records to the new public ip",
+			zap.Stringer("old", old),
+			zap.Stringer("new", addr),
+			zap.Error(err),
+		)
+	}
+}
+
+// detect asks every source and returns the address they agree on. Sources
+// that fail are ignored as long as at least half of them answer, but any
+// disagreement between answers is an error.
+func (d *Detector) detect(ctx context.Context) (netip.Addr, error) {
+	if len(d.sources) == 0 {
+		return netip.Addr{}, errors.New("no public ip sources configured")
+	}
+
+	type answer struct {
+		addr netip.Addr
+		err  error
+	}
+	answers := make([]answer, len(d.sources))
+	var wg sync.WaitGroup
+	for i, source := range d.sources {
+		wg.Add(1)
+		go func(i int, source IPSource) {
+			defer wg.Done()
+			addr, err := source.PublicIP(ctx)
+			if err == nil && !isPublic(addr.Unmap()) {
+				err = fmt.Errorf("%s is not a public address", addr)
+			}
+			answers[i] = answer{addr: addr.Unmap(), err: err}
+		}(i, source)
+	}
+	wg.Wait()
+
+	var (
+		agreed netip.Addr
+		seen   = make(map[netip.Addr][]string)
+		errs   []error
+	)
+	for i, a := range answers {
+		name := d.sources[i].Name()
+		if a.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, a.err))
+			continue
+		}
+		seen[a.addr] = append(seen[a.addr], name)
+		agreed = a.addr
+	}
+
+	if len(seen) > 1 {
+		publicIPDisagreements.Inc()
+		var parts []string
+		for addr, names := range seen {
+			parts = append(parts, fmt.Sprintf("%s from %s", addr, strings.Join(names, ", ")))
+		}
+		sort.Strings(parts)
+		return netip.Addr{}, fmt.Errorf("public ip sources disagree: %s", strings.Join(parts, "; "))
+	}
+	answered := len(d.sources) - len(errs)
+	if answered == 0 || answered*2 < len(d.sources) {
+		return netip.Addr{}, fmt.Errorf("only %d of %d public ip sources answered: %w", answered, len(d.sources), errors.Join(errs...))
+	}
+	return agreed, nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
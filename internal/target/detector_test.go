@@ -0,0 +1,158 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource answers with whatever address it was last given.
+type fakeSource struct {
+	name string
+	mu   sync.Mutex
+	addr netip.Addr
+	err  error
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) PublicIP(context.Context) (netip.Addr, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr, s.err
+}
+
+func (s *fakeSource) set(addr string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addr, s.err = netip.Addr{}, err
+	if addr != "" {
+		s.addr = netip.MustParseAddr(addr)
+	}
+}
+
+func TestDetectorReportsChanges(t *testing.T) {
+	echo := &fakeSource{name: "echo"}
+	stun := &fakeSource{name: "stun"}
+	echo.set("203.0.113.1", nil)
+	stun.set("203.0.113.1", nil)
+
+	var changes [][2]netip.Addr
+	detector := NewDetector([]IPSource{echo, stun}, Options{
+		OnChange: func(_ context.Context, old, new netip.Addr) error {
+			changes = append(changes, [2]netip.Addr{old, new})
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	detector.Poll(ctx)
+	if len(changes) != 0 {
+		t.Fatalf("changes after first detection = %v, want none", changes)
+	}
+	addrs, err := detector.Addresses(ctx)
+	if err != nil || len(addrs) != 1 || addrs[0].String() != "203.0.113.1" {
+		t.Fatalf("addresses = %v, %v; want 203.0.113.1", addrs, err)
+	}
+
+	// One source failing is fine while the others agree
+	echo.set("203.0.113.2", nil)
+	stun.set("", errors.New("timeout"))
+	detector.Poll(ctx)
+	detector.Poll(ctx)
+	if len(changes) != 1 || changes[0][0].String() != "203.0.113.1" || changes[0][1].String() != "203.0.113.2" {
+		t.Fatalf("changes = %v, want one change from 203.0.113.1 to 203.0.113.2", changes)
+	}
+}
+
+// gatedSource answers like fakeSource but waits for gate to close once it
+// is set.
+type gatedSource struct {
+	fakeSource
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+func (s *gatedSource) PublicIP(ctx context.Context) (netip.Addr, error) {
+	if s.gate != nil {
+		close(s.entered)
+		<-s.gate
+	}
+	return s.fakeSource.PublicIP(ctx)
+}
+
+func TestDetectorServesAddressDuringSlowPoll(t *testing.T) {
+	source := &gatedSource{fakeSource: fakeSource{name: "stun"}}
+	source.set("203.0.113.1", nil)
+	detector := NewDetector([]IPSource{source}, Options{})
+	ctx := context.Background()
+	detector.Poll(ctx)
+
+	source.gate = make(chan struct{})
+	source.entered = make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		detector.Poll(ctx)
+		close(polled)
+	}()
+	<-source.entered
+
+	defer func() {
+		close(source.gate)
+		<-polled
+	}()
+
+	done := make(chan struct{})
+	var addrs []netip.Addr
+	var err error
+	go func() {
+		addrs, err = detector.Addresses(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Addresses waited for the poll in progress")
+	}
+	if err != nil || len(addrs) != 1 || addrs[0].String() != "203.0.113.1" {
+		t.Fatalf("addresses = %v, %v; want 203.0.113.1", addrs, err)
+	}
+}
+
+func TestDetectorRequiresAgreement(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		wantErr string
+	}{
+		{name: "disagreement", answers: []string{"203.0.113.1", "203.0.113.2", "203.0.113.1"}, wantErr: "disagree"},
+		{name: "too few answers", answers: []string{"203.0.113.1", "", ""}, wantErr: "only 1 of 3"},
+		{name: "private address", answers: []string{"192.168.1.10"}, wantErr: "not a public address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []IPSource
+			for i, answer := range tt.answers {
+				source := &fakeSource{name: string(rune('a' + i))}
+				if answer == "" {
+					source.set("", errors.New("unreachable"))
+				} else {
+					source.set(answer, nil)
+				}
+				sources = append(sources, source)
+			}
+
+			_, err := NewDetector(sources, Options{}).Addresses(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package target
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	publicIPChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_public_ip_checks_total",
+			Help: "Total number of public IP checks by outcome",
+		},
+		[]string{"status"},
+	)
+
+	publicIPChanges = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_public_ip_changes_total",
+			Help: "Total number of detected public IP address changes",
+		},
+	)
+
+	publicIPDisagreements = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "caddy_dns_public_ip_disagreements_total",
+			Help: "Total number of public IP checks where sources reported different addresses",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(publicIPChecks)
+	prometheus.MustRegister(publicIPChanges)
+	prometheus.MustRegister(publicIPDisagreements)
+}
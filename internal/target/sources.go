@@ -0,0 +1,299 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+)
+
+const (
+	// DefaultEchoURL returns the caller's public address as plain text.
+	DefaultEchoURL = "https://api.ipify.org"
+
+	sourceTimeout = 10 * time.Second
+	maxEchoBody   = 1024
+)
+
+// IPSource reports the public address one outside observer sees.
+type IPSource interface {
+	Name() string
+	PublicIP(ctx context.Context) (netip.Addr, error)
+}
+
+// Sources builds the IP sources a public-ip target config lists, falling
+// back to DefaultEchoURL when it lists none.
+func Sources(cfg *config.TargetConfig) []IPSource {
+	var sources []IPSource
+	for _, echoURL := range cfg.EchoURLs {
+		sources = append(sources, NewHTTPSource(echoURL, nil))
+	}
+	for _, server := range cfg.STUNServers {
+		sources = append(sources, NewSTUNSource(server))
+	}
+	if cfg.UPnPURL != "" {
+		sources = append(sources, NewUPnPSource(cfg.UPnPURL, nil))
+	}
+	if len(sources) == 0 {
+		sources = append(sources, NewHTTPSource(DefaultEchoURL, nil))
+	}
+	return sources
+}
+
+// HTTPSource asks an HTTP echo service, which answers with the caller's
+// address as plain text.
+type HTTPSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSource queries url. A nil client uses one with a short timeout.
+func NewHTTPSource(url string, client *http.Client) *HTTPSource {
+	if client == nil {
+		client = &http.Client{Timeout: sourceTimeout}
+	}
+	return &HTTPSource{url: url, client: client}
+}
+
+// Name returns the echo URL
+func (s *HTTPSource) Name() string {
+	return s.url
+}
+
+// PublicIP fetches the address from the echo service
+func (s *HTTPSource) PublicIP(ctx context.Context) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxEchoBody))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	text := strings.TrimSpace(string(body))
+	addr, err := netip.ParseAddr(text)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("response %q is not an IP address", text)
+	}
+	return addr, nil
+}
+
+// STUN (RFC 5389) binding requests ask a server which address and port our
+// packets arrive from.
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunMappedAddress   = 0x0001
+	stunXORMapped       = 0x0020
+	stunHeaderLen       = 20
+)
+
+// STUNSource asks a STUN server for our mapped address.
+type STUNSource struct {
+	server string
+}
+
+// NewSTUNSource queries server, given as host:port.
+func NewSTUNSource(server string) *STUNSource {
+	return &STUNSource{server: server}
+}
+
+// Name returns the STUN server address
+func (s *STUNSource) Name() string {
+	return "stun:" + s.server
+}
+
+// PublicIP sends a binding request and returns the mapped address
+func (s *STUNSource) PublicIP(ctx context.Context) (netip.Addr, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", s.server)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sourceTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return netip.Addr{}, err
+	}
+
+	request := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return netip.Addr{}, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return netip.Addr{}, err
+	}
+
+	response := make([]byte, 1500)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		// Ignore stray packets that do not answer our transaction
+		if n < stunHeaderLen || !bytes.Equal(response[8:20], request[8:20]) {
+			continue
+		}
+		return parseSTUNResponse(response[:n])
+	}
+}
+
+// parseSTUNResponse extracts the mapped address from a binding response,
+// preferring XOR-MAPPED-ADDRESS over the legacy MAPPED-ADDRESS.
+func parseSTUNResponse(msg []byte) (netip.Addr, error) {
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse {
+		return netip.Addr{}, fmt.Errorf("unexpected STUN message type %#04x", binary.BigEndian.Uint16(msg[0:2]))
+	}
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if stunHeaderLen+length > len(msg) {
+		return netip.Addr{}, errors.New("truncated STUN response")
+	}
+
+	var mapped netip.Addr
+	attrs := msg[stunHeaderLen : stunHeaderLen+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+attrLen > len(attrs) {
+			return netip.Addr{}, errors.New("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case stunXORMapped:
+			return stunAddress(value, msg[4:20])
+		case stunMappedAddress:
+			mapped, _ = stunAddress(value, nil)
+		}
+		// Attributes are padded to a multiple of four bytes
+		attrs = attrs[4+(attrLen+3)&^3:]
+	}
+	if mapped.IsValid() {
+		return mapped, nil
+	}
+	return netip.Addr{}, errors.New("STUN response has no mapped address")
+}
+
+// stunAddress decodes a (XOR-)MAPPED-ADDRESS value. A non-nil key (the magic
+// cookie and transaction ID) XORs the address.
+func stunAddress(value, key []byte) (netip.Addr, error) {
+	if len(value) < 4 {
+		return netip.Addr{}, errors.New("short STUN address")
+	}
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = 4
+	case 0x02:
+		size = 16
+	default:
+		return netip.Addr{}, fmt.Errorf("unknown STUN address family %#02x", value[1])
+	}
+	if len(value) < 4+size {
+		return netip.Addr{}, errors.New("short STUN address")
+	}
+	ip := make([]byte, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr, nil
+}
+
+// UPnPSource asks the internet gateway for its WAN address through the
+// WANIPConnection service's GetExternalIPAddress action.
+type UPnPSource struct {
+	controlURL string
+	client     *http.Client
+}
+
+// NewUPnPSource queries the service at controlURL, as listed in the
+// gateway's device description. A nil client uses one with a short timeout.
+func NewUPnPSource(controlURL string, client *http.Client) *UPnPSource {
+	if client == nil {
+		client = &http.Client{Timeout: sourceTimeout}
+	}
+	return &UPnPSource{controlURL: controlURL, client: client}
+}
+
+// Name returns the control URL
+func (s *UPnPSource) Name() string {
+	return "upnp:" + s.controlURL
+}
+
+const upnpGetExternalIP = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetExternalIPAddress xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"/></s:Body>
+</s:Envelope>`
+
+// PublicIP calls GetExternalIPAddress on the gateway
+func (s *UPnPSource) PublicIP(ctx context.Context) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.controlURL, strings.NewReader(upnpGetExternalIP))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"`)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Address string `xml:"NewExternalIPAddress"`
+			} `xml:"GetExternalIPAddressResponse"`
+		} `xml:"Body"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&envelope); err != nil {
+		return netip.Addr{}, fmt.Errorf("decode response: %w", err)
+	}
+	text := strings.TrimSpace(envelope.Body.Response.Address)
+	addr, err := netip.ParseAddr(text)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("external address %q is not an IP address", text)
+	}
+	return addr, nil
+}
+
+// Interface guards
+var (
+	_ IPSource = (*HTTPSource)(nil)
+	_ IPSource = (*STUNSource)(nil)
+	_ IPSource = (*UPnPSource)(nil)
+)
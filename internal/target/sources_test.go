@@ -0,0 +1,91 @@
+package target
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.Write([]byte("<html>"))
+			return
+		}
+		w.Write([]byte("203.0.113.7\n"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	addr, err := NewHTTPSource(server.URL, server.Client()).PublicIP(ctx)
+	if err != nil || addr.String() != "203.0.113.7" {
+		t.Fatalf("public ip = %v, %v; want 203.0.113.7", addr, err)
+	}
+	if _, err := NewHTTPSource(server.URL+"/broken", server.Client()).PublicIP(ctx); err == nil {
+		t.Fatal("expected error for a non-address response")
+	}
+}
+
+func TestSTUNSource(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil || n < stunHeaderLen {
+			return
+		}
+		// Binding success response with XOR-MAPPED-ADDRESS 203.0.113.7:4242
+		resp := make([]byte, stunHeaderLen+12)
+		binary.BigEndian.PutUint16(resp[0:2], stunBindingResponse)
+		binary.BigEndian.PutUint16(resp[2:4], 12)
+		copy(resp[4:20], buf[4:20])
+		binary.BigEndian.PutUint16(resp[20:22], stunXORMapped)
+		binary.BigEndian.PutUint16(resp[22:24], 8)
+		resp[25] = 0x01
+		binary.BigEndian.PutUint16(resp[26:28], 4242^uint16(stunMagicCookie>>16))
+		for i, b := range []byte{203, 0, 113, 7} {
+			resp[28+i] = b ^ resp[4+i]
+		}
+		conn.WriteTo(resp, peer)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, err := NewSTUNSource(conn.LocalAddr().String()).PublicIP(ctx)
+	if err != nil || addr.String() != "203.0.113.7" {
+		t.Fatalf("public ip = %v, %v; want 203.0.113.7", addr, err)
+	}
+}
+
+func TestUPnPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(r.Header.Get("SOAPAction"), "#GetExternalIPAddress") || !strings.Contains(string(body), "GetExternalIPAddress") {
+			http.Error(w, "unexpected action", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse>
+</s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	addr, err := NewUPnPSource(server.URL, server.Client()).PublicIP(context.Background())
+	if err != nil || addr.String() != "203.0.113.7" {
+		t.Fatalf("public ip = %v, %v; want 203.0.113.7", addr, err)
+	}
+}
@@ -0,0 +1,129 @@
+// Package target resolves the address a provider's records point at when it
+// should not be the container's own address, for example because Caddy
+// reverse-proxies the container and only the proxy is reachable.
+package target
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+	"github.com/cpritchett/caddy-dns-plugin/internal/dns"
+)
+
+// Options configures a Detector.
+type Options struct {
+	// Interval between polls. Zero means DefaultPollInterval.
+	Interval time.Duration
+	Logger   *zap.Logger
+
+	// OnChange is called when the detected address changes. Records it
+	// fails to move are corrected by the next reconciliation.
+	OnChange func(ctx context.Context, old, new netip.Addr) error
+}
+
+// New builds the resolver for a provider's target_mode. It returns nil for
+// the container mode, which needs no resolver. The public-ip mode returns a
+// *Detector configured by opts, which must be run to follow address changes.
+func New(cfg *config.TargetConfig, opts Options) (dns.TargetResolver, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	switch cfg.Mode {
+	case "", config.TargetModeContainer:
+		return nil, nil
+	case config.TargetModeStatic:
+		static, err := NewStatic(cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		return static, nil
+	case config.TargetModeHostInterface:
+		return NewHostInterface(cfg.Interface), nil
+	case config.TargetModePublicIP:
+		if cfg.PollInterval > 0 {
+			opts.Interval = time.Duration(cfg.PollInterval)
+		}
+		return NewDetector(Sources(cfg), opts), nil
+	default:
+		return nil, fmt.Errorf("unknown target_mode %q", cfg.Mode)
+	}
+}
+
+// Static always resolves to the same address.
+type Static struct {
+	addr netip.Addr
+}
+
+// NewStatic parses addr as the fixed target address.
+func NewStatic(addr string) (*Static, error) {
+	parsed, err := netip.ParseAddr(strings.TrimSpace(addr))
+	if err != nil {
+		return nil, fmt.Errorf("static target: %w", err)
+	}
+	return &Static{addr: parsed.Unmap()}, nil
+}
+
+// Addresses returns the configured address.
+func (s *Static) Addresses(context.Context) ([]netip.Addr, error) {
+	return []netip.Addr{s.addr}, nil
+}
+
+// HostInterface resolves to the global unicast addresses of a host network
+// interface, read on every call so address changes are picked up.
+type HostInterface struct {
+	name  string
+	addrs func(name string) ([]net.Addr, error)
+}
+
+// NewHostInterface resolves to the addresses of the named interface.
+func NewHostInterface(name string) *HostInterface {
+	return &HostInterface{name: name, addrs: interfaceAddrs}
+}
+
+// Addresses returns the interface's addresses, skipping loopback and
+// link-local ones.
+func (h *HostInterface) Addresses(context.Context) ([]netip.Addr, error) {
+	addrs, err := h.addrs(h.name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", h.name, err)
+	}
+
+	var result []netip.Addr
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		if !ip.IsGlobalUnicast() {
+			continue
+		}
+		result = append(result, ip)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("interface %s has no usable address", h.name)
+	}
+	return result, nil
+}
+
+func interfaceAddrs(name string) ([]net.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs()
+}
+
+// Interface guards
+var (
+	_ dns.TargetResolver = (*Static)(nil)
+	_ dns.TargetResolver = (*HostInterface)(nil)
+	_ dns.TargetResolver = (*Detector)(nil)
+)
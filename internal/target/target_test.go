@@ -0,0 +1,63 @@
+package target
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+
+	"github.com/cpritchett/caddy-dns-plugin/internal/config"
+)
+
+func TestNewResolvers(t *testing.T) {
+	if resolver, err := New(&config.TargetConfig{Mode: config.TargetModeContainer}, Options{}); err != nil || resolver != nil {
+		t.Fatalf("container mode = %v, %v; want no resolver", resolver, err)
+	}
+	if _, err := New(&config.TargetConfig{Mode: config.TargetModeStatic, Address: "edge"}, Options{}); err == nil {
+		t.Fatal("expected error for static target without an IP")
+	}
+
+	resolver, err := New(&config.TargetConfig{Mode: config.TargetModeStatic, Address: "203.0.113.5"}, Options{})
+	if err != nil {
+		t.Fatalf("static: %v", err)
+	}
+	addrs, err := resolver.Addresses(context.Background())
+	if err != nil || len(addrs) != 1 || addrs[0] != netip.MustParseAddr("203.0.113.5") {
+		t.Fatalf("static addresses = %v, %v; want 203.0.113.5", addrs, err)
+	}
+
+	resolver, err = New(&config.TargetConfig{Mode: config.TargetModePublicIP, PollInterval: caddy.Duration(time.Minute)}, Options{})
+	if err != nil {
+		t.Fatalf("public-ip: %v", err)
+	}
+	detector, ok := resolver.(*Detector)
+	if !ok || detector.interval != time.Minute || len(detector.sources) != 1 || detector.sources[0].Name() != DefaultEchoURL {
+		t.Fatalf("public-ip resolver = %#v, want a detector polling %s every minute", resolver, DefaultEchoURL)
+	}
+}
+
+func TestHostInterfaceSkipsLocalAddresses(t *testing.T) {
+	resolver := NewHostInterface("eth0")
+	resolver.addrs = func(name string) ([]net.Addr, error) {
+		if name != "eth0" {
+			t.Fatalf("interface = %q, want eth0", name)
+		}
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("2001:db8::2"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+
+	addrs, err := resolver.Addresses(context.Background())
+	if err != nil {
+		t.Fatalf("addresses: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0].String() != "192.168.1.2" || addrs[1].String() != "2001:db8::2" {
+		t.Fatalf("addresses = %v, want 192.168.1.2 and 2001:db8::2", addrs)
+	}
+}